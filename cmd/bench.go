@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/script"
+	"github.com/spf13/cobra"
+)
+
+var (
+	benchIterations int
+	benchRestore    string
+)
+
+// benchCmd represents the script bench command
+var benchCmd = &cobra.Command{
+	Use:   "bench [vmid] [script]",
+	Short: "Run a script repeatedly and report reliability statistics",
+	Long: `Run a script several times and report the success rate, the duration
+distribution and the lines that failed, marking lines that both passed and
+failed as flaky. Use this to quantify how reliable an automation is before
+relying on it in CI.
+
+With --restore the VM is rolled back to the named snapshot (see
+'qmp snapshot') before every iteration, so each run starts from the same state.
+
+Example:
+  qmp script bench 106 install.txt --iterations 20 --restore clean`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, scriptFile := args[0], args[1]
+		if benchIterations < 1 {
+			exitWithError("Error: --iterations must be at least 1")
+		}
+
+		source := loadScriptSource(scriptFile)
+
+		client := newQMPClient(vmid)
+		configureKeyboard(client)
+		attachRecorder(client)
+
+		conn := newConnectionManager(client)
+		if err := conn.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer conn.Close()
+
+		// Ctrl+C stops after the running line and reports the completed iterations
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		var results []*script.Result
+		for i := 1; i <= benchIterations && ctx.Err() == nil; i++ {
+			if benchRestore != "" {
+				logging.Info("Restoring snapshot", "name", benchRestore, "iteration", i)
+				if err := conn.Do(func(c *qmp.Client) error { return c.LoadSnapshot(benchRestore) }); err != nil {
+					exitWithError("Error restoring snapshot %s: %v", benchRestore, err)
+				}
+			}
+
+			executor := newScriptExecutor(vmid, conn)
+			executor.Output = os.Stderr
+			result, err := executor.RunContext(ctx, bytes.NewReader(source))
+			executor.Close()
+			if err != nil {
+				exitWithError("%v", err)
+			}
+			if result.Interrupted {
+				break
+			}
+
+			results = append(results, result)
+			logging.Info("Iteration finished", "iteration", i, "success", result.Success, "duration", result.Duration)
+		}
+
+		summary := script.Summarize(results)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":    vmid,
+				"script":  scriptFile,
+				"summary": summary,
+			})
+			return
+		}
+
+		if summary.Iterations == 0 {
+			fmt.Printf("No iterations completed for VM %s\n", vmid)
+			return
+		}
+
+		fmt.Printf("Benchmark of %s on VM %s:\n", scriptFile, vmid)
+		fmt.Printf("  Iterations:   %d\n", summary.Iterations)
+		fmt.Printf("  Success rate: %.1f%% (%d/%d)\n", summary.SuccessRate*100, summary.Successes, summary.Iterations)
+		fmt.Printf("  Duration:     min %v, mean %v, median %v, p95 %v, max %v\n",
+			summary.Min.Truncate(time.Millisecond), summary.Mean.Truncate(time.Millisecond),
+			summary.Median.Truncate(time.Millisecond), summary.P95.Truncate(time.Millisecond),
+			summary.Max.Truncate(time.Millisecond))
+
+		if len(summary.FailingLines) > 0 {
+			fmt.Printf("Failing lines:\n")
+			fmt.Printf("  %-6s %-9s %-6s %-16s %s\n", "LINE", "FAILURES", "FLAKY", "DIRECTIVE", "TEXT")
+			for _, line := range summary.FailingLines {
+				fmt.Printf("  %-6d %-9s %-6t %-16s %s\n", line.Line,
+					fmt.Sprintf("%d/%d", line.Failures, line.Runs), line.Flaky, line.Directive, logging.Mask(line.Text))
+			}
+		}
+	},
+}
+
+func init() {
+	scriptCmd.AddCommand(benchCmd)
+	benchCmd.Flags().IntVarP(&benchIterations, "iterations", "n", 10, "number of times to run the script")
+	benchCmd.Flags().StringVar(&benchRestore, "restore", "", "restore this snapshot before every iteration")
+}
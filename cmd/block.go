@@ -0,0 +1,276 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	blockFormat string
+	blockForce  bool
+)
+
+// blockCmd represents the block command
+var blockCmd = &cobra.Command{
+	Use:   "block",
+	Short: "Manage block devices",
+	Long: `Manage block devices (disks and CD-ROM drives) attached to the VM.
+
+Device names are the QEMU drive names shown by 'qmp block list', e.g.
+drive-scsi0 or drive-ide2 on Proxmox.`,
+}
+
+// blockListCmd represents the block list command
+var blockListCmd = &cobra.Command{
+	Use:   "list [vmid]",
+	Short: "List block devices",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		devices, err := client.QueryBlock()
+		if err != nil {
+			exitWithError("Error listing block devices: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":    vmid,
+				"devices": devices,
+			})
+			return
+		}
+
+		fmt.Printf("Block devices for VM %s:\n", vmid)
+		for _, dev := range devices {
+			fmt.Printf("  %-16s %s\n", dev.Device, describeMedium(dev))
+		}
+	},
+}
+
+// describeMedium describes the medium and flags of a block device
+func describeMedium(dev qmp.BlockDevice) string {
+	medium := "(empty)"
+	if dev.Inserted != nil {
+		medium = fmt.Sprintf("%s [%s]", dev.Inserted.File, dev.Inserted.Driver)
+		if dev.Inserted.ReadOnly {
+			medium += " ro"
+		}
+	}
+	if dev.Removable {
+		medium += " removable"
+		if dev.TrayOpen {
+			medium += " tray-open"
+		}
+	}
+	return medium
+}
+
+// blockSnapshotCmd represents the block snapshot command
+var blockSnapshotCmd = &cobra.Command{
+	Use:   "snapshot [vmid] [device] [snapshot-file]",
+	Short: "Create an external snapshot of a device",
+	Long: `Create an external snapshot: the current image becomes read-only and
+new writes go to the snapshot file.
+
+Example:
+  qmp block snapshot 106 drive-scsi0 /var/lib/vz/images/106/pre-install.qcow2`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, device, file := args[0], args[1], args[2]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.BlockSnapshot(device, file, blockFormat); err != nil {
+			exitWithError("Error creating snapshot of %s: %v", device, err)
+		}
+
+		printBlockResult(vmid, "snapshot", device, fmt.Sprintf("Created snapshot of %s in %s", device, file))
+	},
+}
+
+// blockCommitCmd represents the block commit command
+var blockCommitCmd = &cobra.Command{
+	Use:   "commit [vmid] [device]",
+	Short: "Merge a snapshot overlay back into its backing image",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, device := args[0], args[1]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.BlockCommit(device); err != nil {
+			exitWithError("Error committing %s: %v", device, err)
+		}
+
+		printBlockResult(vmid, "commit", device, fmt.Sprintf("Started commit job for %s", device))
+	},
+}
+
+// blockResizeCmd represents the block resize command
+var blockResizeCmd = &cobra.Command{
+	Use:   "resize [vmid] [device] [size]",
+	Short: "Resize a device",
+	Long: `Resize a device to an absolute size. The size accepts K, M, G and T
+suffixes (powers of 1024).
+
+Example:
+  qmp block resize 106 drive-scsi0 64G`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, device := args[0], args[1]
+		size, err := parseSize(args[2])
+		if err != nil {
+			exitWithError("Invalid size '%s': %v", args[2], err)
+		}
+
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.BlockResize(device, size); err != nil {
+			exitWithError("Error resizing %s: %v", device, err)
+		}
+
+		printBlockResult(vmid, "resize", device, fmt.Sprintf("Resized %s to %d bytes", device, size))
+	},
+}
+
+// blockEjectCmd represents the block eject command
+var blockEjectCmd = &cobra.Command{
+	Use:   "eject [vmid] [device]",
+	Short: "Eject the medium from a removable device",
+	Long: `Eject the medium from a removable device. The device defaults to the
+CD-ROM drive (block.cdrom_device in the config, drive-ide2 by default).`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		device := getCDROMDevice()
+		if len(args) == 2 {
+			device = args[1]
+		}
+
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.Eject(device, blockForce); err != nil {
+			exitWithError("Error ejecting %s: %v", device, err)
+		}
+
+		printBlockResult(vmid, "eject", device, fmt.Sprintf("Ejected medium from %s", device))
+	},
+}
+
+// blockChangeCmd represents the block change command
+var blockChangeCmd = &cobra.Command{
+	Use:   "change [vmid] [file] [device]",
+	Short: "Insert a new medium into a removable device",
+	Long: `Insert a new medium (e.g. an ISO image) into a removable device. The
+device defaults to the CD-ROM drive.
+
+Example:
+  qmp block change 106 /var/lib/vz/template/iso/debian-12.iso`,
+	Args: cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, file := args[0], args[1]
+		device := getCDROMDevice()
+		if len(args) == 3 {
+			device = args[2]
+		}
+
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.ChangeMedium(device, file, blockFormat); err != nil {
+			exitWithError("Error changing medium of %s: %v", device, err)
+		}
+
+		printBlockResult(vmid, "change", device, fmt.Sprintf("Inserted %s into %s", file, device))
+	},
+}
+
+// printBlockResult reports a completed block operation
+func printBlockResult(vmid string, action string, device string, message string) {
+	if isJSONOutput() {
+		printJSON(map[string]interface{}{
+			"vmid":    vmid,
+			"action":  action,
+			"device":  device,
+			"message": message,
+		})
+		return
+	}
+
+	fmt.Println(message)
+}
+
+// connectBlockClient connects to the VM or exits on failure
+func connectBlockClient(vmid string) *qmp.Client {
+	client := newQMPClient(vmid)
+
+	if err := client.Connect(); err != nil {
+		exitWithError("Error connecting to VM %s: %v", vmid, err)
+	}
+
+	return client
+}
+
+// getCDROMDevice returns the default CD-ROM device name from config
+func getCDROMDevice() string {
+	if viper.IsSet("block.cdrom_device") {
+		return viper.GetString("block.cdrom_device")
+	}
+
+	// Default to the Proxmox CD-ROM drive
+	return "drive-ide2"
+}
+
+// parseSize parses a size such as 512M or 64G into bytes
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		factor int64
+	}{
+		{"T", 1 << 40},
+		{"G", 1 << 30},
+		{"M", 1 << 20},
+		{"K", 1 << 10},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.factor
+			s = strings.TrimSuffix(s, unit.suffix)
+			break
+		}
+	}
+
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if value <= 0 {
+		return 0, fmt.Errorf("size must be positive")
+	}
+	return value * multiplier, nil
+}
+
+func init() {
+	rootCmd.AddCommand(blockCmd)
+	blockCmd.AddCommand(blockListCmd)
+	blockCmd.AddCommand(blockSnapshotCmd)
+	blockCmd.AddCommand(blockCommitCmd)
+	blockCmd.AddCommand(blockResizeCmd)
+	blockCmd.AddCommand(blockEjectCmd)
+	blockCmd.AddCommand(blockChangeCmd)
+
+	blockSnapshotCmd.Flags().StringVarP(&blockFormat, "format", "f", "qcow2", "snapshot image format")
+	blockChangeCmd.Flags().StringVarP(&blockFormat, "format", "f", "", "medium format (default autodetect)")
+	blockEjectCmd.Flags().BoolVar(&blockForce, "force", false, "eject even if the guest has locked the tray")
+}
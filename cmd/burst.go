@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+var (
+	burstCount    int
+	burstInterval time.Duration
+	burstFormat   string
+	burstOutDir   string
+	burstGIF      string
+)
+
+// burstCmd represents the screenshot burst command
+var burstCmd = &cobra.Command{
+	Use:   "burst [vmid]",
+	Short: "Capture a numbered series of screenshots",
+	Long: `Capture a series of screenshots at a fixed interval over a single QMP
+connection, e.g. to document a boot sequence. Frames are written to the
+output directory as frame-0001.png, frame-0002.png, ... and can optionally
+be combined into an animated GIF.
+
+Examples:
+  # 30 frames, one every 500ms
+  qmp screenshot burst 106 --count 30 --interval 500ms --out boot/
+
+  # Also write an animated GIF
+  qmp screenshot burst 106 --count 60 --interval 1s --out boot/ --gif boot.gif`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		if burstCount <= 0 || burstInterval <= 0 {
+			exitWithError("Error: --count and --interval must be positive")
+		}
+		format := strings.ToLower(burstFormat)
+		if format != "png" && format != "ppm" {
+			exitWithError("Error: unsupported format %s (use png or ppm)", burstFormat)
+		}
+		if err := os.MkdirAll(burstOutDir, 0755); err != nil {
+			exitWithError("Error creating output directory: %v", err)
+		}
+
+		client := newQMPClient(vmid)
+
+		if err := client.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer client.Close()
+		attachRecorder(client)
+
+		files, err := captureBurst(client, format)
+		if err != nil {
+			exitWithError("Error capturing screenshots: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":   vmid,
+				"files":  files,
+				"format": format,
+				"gif":    burstGIF,
+			})
+			return
+		}
+
+		fmt.Printf("Saved %d screenshots to %s\n", len(files), burstOutDir)
+		if burstGIF != "" {
+			fmt.Printf("Animated GIF saved to %s\n", burstGIF)
+		}
+	},
+}
+
+// burstFrame is a captured frame waiting to be converted
+type burstFrame struct {
+	index int
+	path  string
+}
+
+// captureBurst captures the frames and converts them on a worker pool so
+// that conversion does not delay the next capture
+func captureBurst(client *qmp.Client, format string) ([]string, error) {
+	files := make([]string, burstCount)
+	var images []image.Image
+	if burstGIF != "" {
+		images = make([]image.Image, burstCount)
+	}
+
+	frames := make(chan burstFrame, burstCount)
+	errs := make(chan error, burstCount)
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for frame := range frames {
+				img, err := convertBurstFrame(frame, format, files)
+				if err != nil {
+					errs <- err
+					continue
+				}
+				if images != nil {
+					images[frame.index] = img
+				}
+			}
+		}()
+	}
+
+	ticker := time.NewTicker(burstInterval)
+	defer ticker.Stop()
+
+	var captureErr error
+	for i := 0; i < burstCount; i++ {
+		if i > 0 {
+			<-ticker.C
+		}
+
+		path := filepath.Join(burstOutDir, fmt.Sprintf("frame-%04d.ppm", i+1))
+		logging.Debug("Capturing burst frame", "frame", i+1, "path", path)
+		if err := client.ScreenDump(path, ""); err != nil {
+			captureErr = fmt.Errorf("frame %d: %v", i+1, err)
+			break
+		}
+		frames <- burstFrame{index: i, path: path}
+	}
+	close(frames)
+	wg.Wait()
+	close(errs)
+
+	if captureErr != nil {
+		return nil, captureErr
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+
+	if burstGIF != "" {
+		if err := screen.SaveGIF(images, burstInterval, burstGIF); err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// convertBurstFrame converts a captured PPM frame to the output format
+func convertBurstFrame(frame burstFrame, format string, files []string) (image.Image, error) {
+	files[frame.index] = frame.path
+	if format == "ppm" && burstGIF == "" {
+		return nil, nil
+	}
+
+	img, err := screen.LoadImage(frame.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "png" {
+		pngPath := strings.TrimSuffix(frame.path, ".ppm") + ".png"
+		if err := screen.SaveImage(img, pngPath, "png"); err != nil {
+			return nil, err
+		}
+		os.Remove(frame.path)
+		files[frame.index] = pngPath
+	}
+	return img, nil
+}
+
+func init() {
+	screenshotCmd.AddCommand(burstCmd)
+	burstCmd.Flags().IntVarP(&burstCount, "count", "n", 10, "number of screenshots to capture")
+	burstCmd.Flags().DurationVarP(&burstInterval, "interval", "i", time.Second, "interval between screenshots")
+	burstCmd.Flags().StringVarP(&burstFormat, "format", "f", "png", "frame format (png, ppm)")
+	burstCmd.Flags().StringVar(&burstOutDir, "out", ".", "output directory")
+	burstCmd.Flags().StringVar(&burstGIF, "gif", "", "also write an animated GIF to this file")
+}
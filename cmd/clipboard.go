@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jstein/qmp/internal/clipboard"
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	clipboardRate      string
+	clipboardChunk     int
+	clipboardChunkWait time.Duration
+	clipboardCopy      bool
+)
+
+// clipboardCmd represents the clipboard command
+var clipboardCmd = &cobra.Command{
+	Use:   "clipboard",
+	Short: "Copy text between the host clipboard and the VM",
+	Long: `Copy text between the host clipboard and the VM during interactive work.
+
+The host clipboard is accessed with pbpaste/pbcopy, wl-paste/wl-copy, xclip,
+xsel or the Windows clipboard tools, whichever is installed.`,
+}
+
+// clipboardPushCmd represents the clipboard push command
+var clipboardPushCmd = &cobra.Command{
+	Use:   "push [vmid]",
+	Short: "Type the host clipboard into the VM console",
+	Long: `Type the contents of the host clipboard into the VM console.
+Use --rate and --chunk to slow down large pastes so the guest does not drop keys.
+
+Example:
+  qmp clipboard push 106 --rate 200cps --chunk 64`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		text, err := clipboard.Read()
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+		if text == "" {
+			exitWithError("Error: the host clipboard is empty")
+		}
+
+		delay := getKeyDelay()
+		if clipboardRate != "" {
+			if delay, err = qmp.ParseRate(clipboardRate); err != nil {
+				exitWithError("Error: %v", err)
+			}
+		}
+
+		client := newQMPClient(vmid)
+
+		if err := client.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer client.Close()
+		configureKeyboard(client)
+		attachRecorder(client)
+
+		logging.Debug("Typing clipboard", "characters", len([]rune(text)), "delay", delay)
+		if err := client.PasteText(text, delay, clipboardChunk, clipboardChunkWait); err != nil {
+			exitWithError("Error typing clipboard to VM %s: %v", vmid, err)
+		}
+		checkVMRunning(client)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":       vmid,
+				"characters": len([]rune(text)),
+				"delay_ms":   delay.Milliseconds(),
+			})
+			return
+		}
+
+		fmt.Printf("Typed %d characters from the clipboard to VM %s\n", len([]rune(text)), vmid)
+	},
+}
+
+// clipboardPullCmd represents the clipboard pull command
+var clipboardPullCmd = &cobra.Command{
+	Use:   "pull [vmid]",
+	Short: "Read the guest clipboard through the guest agent",
+	Long: `Read the clipboard of a Linux guest's graphical session through the
+QEMU guest agent and print it. The guest needs wl-paste, xclip or xsel.
+Use --copy to place it on the host clipboard instead.
+
+Example:
+  qmp clipboard pull 106 --copy`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		agent := connectGuestAgent(vmid)
+		defer agent.Close()
+
+		result, err := agent.Exec(clipboard.GuestReadCommand, 10*time.Second)
+		if err != nil {
+			exitWithError("Error reading clipboard on VM %s: %v", vmid, err)
+		}
+		if result.ExitCode != 0 {
+			agent.Close()
+			exitWithError("Error reading clipboard on VM %s: no clipboard tool succeeded (exit code %d) %s", vmid, result.ExitCode, result.Stderr)
+		}
+
+		if clipboardCopy {
+			if err := clipboard.Write(result.Stdout); err != nil {
+				agent.Close()
+				exitWithError("Error: %v", err)
+			}
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":      vmid,
+				"clipboard": result.Stdout,
+				"copied":    clipboardCopy,
+			})
+			return
+		}
+
+		if clipboardCopy {
+			fmt.Printf("Copied %d characters from the clipboard of VM %s\n", len([]rune(result.Stdout)), vmid)
+			return
+		}
+		fmt.Print(result.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(clipboardCmd)
+	clipboardCmd.AddCommand(clipboardPushCmd)
+	clipboardCmd.AddCommand(clipboardPullCmd)
+
+	clipboardPushCmd.Flags().StringVar(&clipboardRate, "rate", "", "typing rate in characters per second, e.g. 200cps")
+	clipboardPushCmd.Flags().IntVar(&clipboardChunk, "chunk", 0, "pause after every N characters (0 disables chunking)")
+	clipboardPushCmd.Flags().DurationVar(&clipboardChunkWait, "chunk-pause", 250*time.Millisecond, "pause between chunks")
+	clipboardPullCmd.Flags().BoolVar(&clipboardCopy, "copy", false, "copy the guest clipboard to the host clipboard instead of printing it")
+	clipboardPullCmd.Flags().StringVar(&guestSocketPath, "ga-socket", "", "custom guest agent socket path")
+}
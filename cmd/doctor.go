@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/jstein/qmp/internal/clipboard"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/qmp/keymap"
+	"github.com/jstein/qmp/internal/screen"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// Check outcomes
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// doctorCheck is one line of the doctor checklist
+type doctorCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [vmid]",
+	Short: "Check the environment for common problems",
+	Long: `Check the local environment and print a pass/fail checklist: config
+file and settings, temporary directory, optional tools and terminal support.
+
+With a VM ID the QMP socket is also checked: that it exists and is
+accessible, that QMP responds, whether the guest agent is reachable and
+whether the display resolution is a whole number of character cells.
+
+Exits with status 1 if any check fails; warnings only affect optional
+features.
+
+Examples:
+  qmp doctor
+  qmp doctor 106`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		checks := environmentChecks()
+		if len(args) == 1 {
+			checks = append(checks, vmChecks(args[0])...)
+		}
+
+		failed := 0
+		for _, check := range checks {
+			if check.Status == checkFail {
+				failed++
+			}
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"checks": checks,
+				"ok":     failed == 0,
+			})
+		} else {
+			printDoctorChecks(checks)
+		}
+
+		if failed > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// printDoctorChecks prints the checklist and a summary
+func printDoctorChecks(checks []doctorCheck) {
+	symbols := map[string]string{
+		checkPass: color.New(color.FgGreen).Sprint("✓"),
+		checkWarn: color.New(color.FgYellow).Sprint("!"),
+		checkFail: color.New(color.FgRed).Sprint("✗"),
+	}
+
+	counts := map[string]int{}
+	for _, check := range checks {
+		counts[check.Status]++
+		fmt.Printf("  %s %-16s %s\n", symbols[check.Status], check.Name, check.Detail)
+	}
+	fmt.Printf("\n%d passed, %d warnings, %d failed\n", counts[checkPass], counts[checkWarn], counts[checkFail])
+}
+
+// environmentChecks checks the local setup
+func environmentChecks() []doctorCheck {
+	var checks []doctorCheck
+	add := func(name string, status string, format string, a ...interface{}) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	if path := viper.ConfigFileUsed(); path != "" {
+		add("config", checkPass, "using %s", path)
+	} else {
+		add("config", checkWarn, "no config file found, using defaults")
+	}
+
+	// Settings are validated without exiting so every problem is listed
+	keymapSetting := firstSetting(keymapName, viper.GetString("keyboard.keymap"), "us")
+	if _, err := keymap.Get(keymapSetting); err != nil {
+		add("keymap", checkFail, "%v", err)
+	} else {
+		add("keymap", checkPass, "%s", keymapSetting)
+	}
+
+	unicodeSetting := firstSetting(unicodeModeName, viper.GetString("keyboard.unicode"), string(qmp.UnicodeSkip))
+	if _, err := qmp.ParseUnicodeMode(unicodeSetting); err != nil {
+		add("unicode mode", checkFail, "%v", err)
+	} else {
+		add("unicode mode", checkPass, "%s", unicodeSetting)
+	}
+
+	timingSetting := firstSetting(timingProfileName, viper.GetString("keyboard.timing_profile"), qmp.DefaultTimingProfile)
+	if _, err := qmp.GetTimingProfile(timingSetting); err != nil {
+		add("timing profile", checkFail, "%v", err)
+	} else {
+		add("timing profile", checkPass, "%s", timingSetting)
+	}
+
+	cellSetting := firstSetting(viper.GetString("screen.cell_size"), "8x16")
+	if _, _, err := screen.ParseCellSize(cellSetting); err != nil {
+		add("cell size", checkFail, "%v", err)
+	} else {
+		add("cell size", checkPass, "%s", cellSetting)
+	}
+
+	if file := firstSetting(zonesFile, viper.GetString("screen.zones_file")); file != "" {
+		if zones, err := screen.LoadZones(file); err != nil {
+			add("zones", checkFail, "%v", err)
+		} else {
+			add("zones", checkPass, "%d zones in %s", len(zones), file)
+		}
+	}
+
+	if tmp, err := os.CreateTemp("", "qmp-doctor-*"); err != nil {
+		add("temp dir", checkFail, "%s is not writable: %v", os.TempDir(), err)
+	} else {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		add("temp dir", checkPass, "%s is writable", os.TempDir())
+	}
+
+	for _, tool := range []struct{ name, purpose string }{
+		{"convert", "PNG screenshots on QEMU without PNG screendump"},
+		{"ffmpeg", "MP4 session rendering"},
+	} {
+		if path, err := exec.LookPath(tool.name); err != nil {
+			add(tool.name, checkWarn, "not found, needed for %s", tool.purpose)
+		} else {
+			add(tool.name, checkPass, "%s", path)
+		}
+	}
+
+	if remote := getRemoteHost(); remote != "" {
+		if _, err := exec.LookPath("ssh"); err != nil {
+			add("ssh", checkFail, "not found, needed for --remote %s", remote)
+		} else {
+			add("ssh", checkPass, "remote host %s", remote)
+		}
+	}
+
+	if err := clipboard.Available(); err != nil {
+		add("clipboard", checkWarn, "%v", err)
+	} else {
+		add("clipboard", checkPass, "clipboard tools found")
+	}
+
+	switch term := os.Getenv("TERM"); {
+	case !isatty.IsTerminal(os.Stdout.Fd()):
+		add("terminal", checkWarn, "output is not a terminal, interactive views are unavailable")
+	case term == "" || term == "dumb":
+		add("terminal", checkWarn, "TERM is %q, interactive views may not render", term)
+	case os.Getenv("COLORTERM") != "truecolor" && os.Getenv("COLORTERM") != "24bit":
+		add("terminal", checkWarn, "%s without 24-bit colour, 'console attach' colours will be approximate", term)
+	default:
+		add("terminal", checkPass, "%s with 24-bit colour", term)
+	}
+
+	return checks
+}
+
+// vmChecks checks the QMP socket, guest agent and display of a VM
+func vmChecks(vmid string) []doctorCheck {
+	var checks []doctorCheck
+	add := func(name string, status string, format string, a ...interface{}) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	client := newQMPClient(vmid)
+	path := client.SocketPath()
+
+	// The socket on a remote host is checked by connecting to it
+	if getRemoteHost() == "" {
+		info, err := os.Stat(path)
+		switch {
+		case os.IsNotExist(err):
+			add("qmp socket", checkFail, "%s does not exist (is VM %s running? see --socket)", path, vmid)
+			return checks
+		case os.IsPermission(err):
+			add("qmp socket", checkFail, "%s is not accessible: permission denied (try sudo)", path)
+			return checks
+		case err != nil:
+			add("qmp socket", checkFail, "%v", err)
+			return checks
+		case info.Mode()&os.ModeSocket == 0:
+			add("qmp socket", checkFail, "%s is not a socket", path)
+			return checks
+		default:
+			add("qmp socket", checkPass, "%s", path)
+		}
+	}
+
+	if err := client.Connect(); err != nil {
+		if os.IsPermission(err) {
+			add("qmp", checkFail, "%v (try sudo)", err)
+		} else {
+			add("qmp", checkFail, "%v", err)
+		}
+		return checks
+	}
+	defer client.Close()
+
+	status, err := client.QueryStatus()
+	if err != nil {
+		add("qmp", checkFail, "connected but query-status failed: %v", err)
+		return checks
+	}
+	add("qmp", checkPass, "VM %s is %v", vmid, status["status"])
+
+	agent := newGuestAgent(vmid)
+	agent.Timeout = 3 * time.Second
+	if err := agent.Connect(); err != nil {
+		add("guest agent", checkWarn, "not reachable: %v", err)
+	} else {
+		if err := agent.Ping(); err != nil {
+			add("guest agent", checkWarn, "not responding: %v", err)
+		} else {
+			add("guest agent", checkPass, "responding")
+		}
+		agent.Close()
+	}
+
+	img, err := client.CaptureImage()
+	if err != nil {
+		add("display", checkWarn, "screendump failed: %v", err)
+		return checks
+	}
+	if client.SupportsPNGScreendump() {
+		add("screendump", checkPass, "QEMU writes PNG directly")
+	} else {
+		add("screendump", checkPass, "PPM only, PNG screenshots are converted with ImageMagick")
+	}
+
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	cellWidth, cellHeight, err := screen.ParseCellSize(firstSetting(viper.GetString("screen.cell_size"), "8x16"))
+	switch {
+	case err != nil:
+		add("display", checkPass, "%dx%d", width, height)
+	case width%cellWidth != 0 || height%cellHeight != 0:
+		add("display", checkWarn, "%dx%d is not a whole number of %dx%d cells (see screen.cell_size)", width, height, cellWidth, cellHeight)
+	default:
+		add("display", checkPass, "%dx%d, %dx%d cells of %dx%d", width, height, width/cellWidth, height/cellHeight, cellWidth, cellHeight)
+	}
+
+	return checks
+}
+
+// firstSetting returns the first non-empty value
+func firstSetting(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
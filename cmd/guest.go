@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/ga"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	guestSocketPath  string
+	guestExecTimeout time.Duration
+)
+
+// guestCmd represents the guest command
+var guestCmd = &cobra.Command{
+	Use:   "guest",
+	Short: "Run commands through the QEMU guest agent",
+	Long: `Run commands inside the VM through the QEMU guest agent.
+The guest must have qemu-guest-agent installed and running.
+
+By default the Proxmox guest agent socket (/var/run/qemu-server/<vmid>.qga)
+is used; use --ga-socket to override it.`,
+}
+
+// guestPingCmd represents the guest ping command
+var guestPingCmd = &cobra.Command{
+	Use:   "ping [vmid]",
+	Short: "Check that the guest agent responds",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		client := connectGuestAgent(vmid)
+		defer client.Close()
+
+		if err := client.Ping(); err != nil {
+			exitWithError("Error pinging guest agent on VM %s: %v", vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{"vmid": vmid, "agent": "ok"})
+			return
+		}
+
+		fmt.Printf("Guest agent on VM %s is responding\n", vmid)
+	},
+}
+
+// guestExecCmd represents the guest exec command
+var guestExecCmd = &cobra.Command{
+	Use:   "exec [vmid] [command...]",
+	Short: "Run a shell command inside the guest",
+	Long: `Run a shell command inside the guest with /bin/sh -c and print its output.
+The exit code of the command is used as the exit code of qmp.
+
+Example:
+  qmp guest exec 106 "ip -br a"`,
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		commandLine := strings.Join(args[1:], " ")
+
+		client := connectGuestAgent(vmid)
+		defer client.Close()
+
+		result, err := client.Exec(commandLine, guestExecTimeout)
+		if err != nil {
+			exitWithError("Error running command on VM %s: %v", vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(result)
+		} else {
+			fmt.Print(result.Stdout)
+			fmt.Fprint(os.Stderr, result.Stderr)
+		}
+
+		if result.ExitCode != 0 {
+			client.Close()
+			os.Exit(result.ExitCode)
+		}
+	},
+}
+
+// guestCatCmd represents the guest cat command
+var guestCatCmd = &cobra.Command{
+	Use:   "cat [vmid] [path]",
+	Short: "Print a file from the guest filesystem",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		path := args[1]
+
+		client := connectGuestAgent(vmid)
+		defer client.Close()
+
+		content, err := client.ReadFile(path)
+		if err != nil {
+			exitWithError("Error reading %s on VM %s: %v", path, vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{"vmid": vmid, "path": path, "content": string(content)})
+			return
+		}
+
+		os.Stdout.Write(content)
+	},
+}
+
+// newGuestAgent creates a guest agent client using the socket from flag or config
+func newGuestAgent(vmid string) *ga.Client {
+	// Priority 1: Command line flag
+	// Priority 2: Config file
+	socket := guestSocketPath
+	if socket == "" {
+		socket = viper.GetString("guest.socket")
+	}
+
+	if socket != "" {
+		return ga.NewWithSocketPath(vmid, socket)
+	}
+	return ga.New(vmid)
+}
+
+// connectGuestAgent connects to the guest agent or exits on failure
+func connectGuestAgent(vmid string) *ga.Client {
+	client := newGuestAgent(vmid)
+	if err := client.Connect(); err != nil {
+		exitWithError("Error connecting to guest agent on VM %s: %v", vmid, err)
+	}
+	return client
+}
+
+func init() {
+	rootCmd.AddCommand(guestCmd)
+	guestCmd.AddCommand(guestPingCmd)
+	guestCmd.AddCommand(guestExecCmd)
+	guestCmd.AddCommand(guestCatCmd)
+
+	guestCmd.PersistentFlags().StringVar(&guestSocketPath, "ga-socket", "", "custom guest agent socket path")
+	guestExecCmd.Flags().DurationVarP(&guestExecTimeout, "timeout", "t", 60*time.Second, "maximum time to wait for the command")
+
+	// Bind flags to viper
+	viper.BindPFlag("guest.socket", guestCmd.PersistentFlags().Lookup("ga-socket"))
+}
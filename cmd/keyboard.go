@@ -8,19 +8,27 @@ import (
 
 	"github.com/jstein/qmp/internal/logging"
 	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/qmp/keymap"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	keyDelay time.Duration
+	keyDelay      time.Duration
+	typeFile      string
+	typeRate      string
+	typeChunk     int
+	typeChunkWait time.Duration
+	rawScancodes  string
+	rawPress      time.Duration
 )
 
 // keyboardCmd represents the keyboard command
 var keyboardCmd = &cobra.Command{
-	Use:   "keyboard",
-	Short: "Send keyboard input to the VM",
-	Long:  `Send keyboard input to the VM, including key presses and text.`,
+	Use:     "keyboard",
+	Aliases: []string{"key"},
+	Short:   "Send keyboard input to the VM",
+	Long:    `Send keyboard input to the VM, including key presses and text.`,
 }
 
 // sendKeyCmd represents the keyboard send command
@@ -41,22 +49,26 @@ Examples:
 		vmid := args[0]
 		key := args[1]
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
-		}
+		client := newQMPClient(vmid)
 
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
+		configureKeyboard(client)
+		attachRecorder(client)
 
 		if err := client.SendKey(key); err != nil {
-			fmt.Printf("Error sending key '%s' to VM %s: %v\n", key, vmid, err)
-			os.Exit(1)
+			exitWithError("Error sending key '%s' to VM %s: %v", key, vmid, err)
+		}
+		checkVMRunning(client)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid": vmid,
+				"key":  key,
+			})
+			return
 		}
 
 		fmt.Printf("Sent key '%s' to VM %s\n", key, vmid)
@@ -69,64 +81,282 @@ var typeTextCmd = &cobra.Command{
 	Short: "Type a string of text",
 	Long: `Type a string of text to the VM.
 
-Example:
-  qmp keyboard type 106 "Hello World"`,
-	Args: cobra.MinimumNArgs(2),
+Large payloads (SSH keys, cloud-init YAML) can be typed from a file with
+--file. Use --rate to set the typing speed in characters per second and
+--chunk to pause after every N characters so the guest does not drop keys.
+
+Examples:
+  qmp keyboard type 106 "Hello World"
+
+  # Paste a file at 200 characters per second in 64 character chunks
+  qmp keyboard type 106 --file payload.txt --rate 200cps --chunk 64`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if typeFile != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.MinimumNArgs(2)(cmd, args)
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		vmid := args[0]
 		// Join all remaining args to form the text
 		text := strings.Join(args[1:], " ")
-
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
+		if typeFile != "" {
+			data, err := os.ReadFile(typeFile)
+			if err != nil {
+				exitWithError("Error reading file: %v", err)
+			}
+			text = string(data)
 		}
 
+		client := newQMPClient(vmid)
+
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
+		configureKeyboard(client)
+		attachRecorder(client)
 
-		// Get the key delay from flag or config
+		// Get the key delay from flag or config, or derive it from --rate
 		delay := getKeyDelay()
+		if typeRate != "" {
+			var err error
+			if delay, err = qmp.ParseRate(typeRate); err != nil {
+				exitWithError("Error: %v", err)
+			}
+		}
 		logging.Debug("Using key delay", "delay", delay)
 
-		if err := client.SendString(text, delay); err != nil {
-			fmt.Printf("Error typing text to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+		// Chunking follows the timing profile unless set explicitly
+		chunk, chunkPause := typeChunk, typeChunkWait
+		if profile := getTimingProfile(); timingProfileSelected() {
+			if !cmd.Flags().Changed("chunk") {
+				chunk = profile.ChunkSize
+			}
+			if !cmd.Flags().Changed("chunk-pause") {
+				chunkPause = profile.ChunkPause
+			}
 		}
 
+		if err := client.PasteText(text, delay, chunk, chunkPause); err != nil {
+			exitWithError("Error typing text to VM %s: %v", vmid, err)
+		}
+		checkVMRunning(client)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":     vmid,
+				"text":     text,
+				"delay_ms": delay.Milliseconds(),
+			})
+			return
+		}
+
+		if typeFile != "" {
+			fmt.Printf("Typed %d characters from %s to VM %s with delay %v\n", len([]rune(text)), typeFile, vmid, delay)
+			return
+		}
 		fmt.Printf("Typed '%s' to VM %s with delay %v\n", text, vmid, delay)
 	},
 }
 
-// getKeyDelay determines the key delay to use based on flag or config
+// rawKeysCmd represents the keyboard raw command
+var rawKeysCmd = &cobra.Command{
+	Use:   "raw [vmid]",
+	Short: "Send raw scancodes",
+	Long: `Send raw XT scancodes (hex) with explicit press and release events.
+
+Scancodes separated by spaces are pressed together; commas separate
+successive presses. Extended keys use an e0 prefix. This gives BIOS/UEFI
+setup screens and boot loaders the precise key timing they need.
+
+Examples:
+  # Ctrl+Alt+Delete
+  qmp key raw 106 --scancodes "1d 38 e0 53"
+
+  # F2 then Enter, each held for 200ms
+  qmp key raw 106 --scancodes "3c, 1c" --press 200ms`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		chords, err := qmp.ParseScancodes(rawScancodes)
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+
+		client := newQMPClient(vmid)
+
+		if err := client.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer client.Close()
+		attachRecorder(client)
+
+		if err := client.SendScancodes(chords, rawPress); err != nil {
+			exitWithError("Error sending scancodes to VM %s: %v", vmid, err)
+		}
+		checkVMRunning(client)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":      vmid,
+				"scancodes": rawScancodes,
+				"press_ms":  rawPress.Milliseconds(),
+			})
+			return
+		}
+
+		fmt.Printf("Sent scancodes '%s' to VM %s\n", rawScancodes, vmid)
+	},
+}
+
+// getKeyDelay determines the key delay to use based on flag, timing profile or config
 func getKeyDelay() time.Duration {
 	// Priority 1: Command line flag
 	if keyDelay > 0 {
 		return keyDelay
 	}
 
-	// Priority 2: Config file
+	return profileKeyDelay()
+}
+
+// profileKeyDelay returns the key delay of an explicitly selected timing
+// profile, then keyboard.delay from config, then the default profile's delay
+func profileKeyDelay() time.Duration {
+	// Priority 2: Timing profile from flag or config
+	if timingProfileSelected() {
+		return getTimingProfile().KeyDelay
+	}
+
+	// Priority 3: Config file
 	if viper.IsSet("keyboard.delay") {
 		// Convert milliseconds from config to time.Duration
 		return time.Duration(viper.GetInt("keyboard.delay")) * time.Millisecond
 	}
 
-	// Default to 50ms
-	return 50 * time.Millisecond
+	// Default to the default profile (50ms)
+	return getTimingProfile().KeyDelay
+}
+
+// configureKeyboard applies the keymap, unicode mode and key hold time to a client
+func configureKeyboard(client *qmp.Client) {
+	client.SetKeymap(getKeymap())
+	client.SetUnicodeMode(getUnicodeMode())
+	client.SetHoldTime(getTimingProfile().HoldTime)
+}
+
+// getFailOnPaused determines whether to verify the VM is running after
+// sending keys based on flag or config
+func getFailOnPaused() bool {
+	// Priority 1: Command line flag
+	if failOnPaused {
+		return true
+	}
+
+	// Priority 2: Config file
+	return viper.GetBool("keyboard.fail_on_paused")
+}
+
+// checkVMRunning exits with guidance when --fail-on-paused is set and the
+// VM did not receive the keys because it is paused
+func checkVMRunning(client *qmp.Client) {
+	if !getFailOnPaused() {
+		return
+	}
+	if err := client.CheckRunning(); err != nil {
+		exitWithError("Error: %v", err)
+	}
+}
+
+// timingProfileSelected reports whether a timing profile was chosen by flag or config
+func timingProfileSelected() bool {
+	return timingProfileName != "" || viper.GetString("keyboard.timing_profile") != ""
+}
+
+// getTimingProfile determines the key timing profile based on flag or config
+func getTimingProfile() qmp.TimingProfile {
+	// Priority 1: Command line flag
+	name := timingProfileName
+
+	// Priority 2: Config file
+	if name == "" {
+		name = viper.GetString("keyboard.timing_profile")
+	}
+
+	if name == "" {
+		name = qmp.DefaultTimingProfile
+	}
+
+	profile, err := qmp.GetTimingProfile(name)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return profile
+}
+
+// getUnicodeMode determines how to type characters missing from the keymap based on flag or config
+func getUnicodeMode() qmp.UnicodeMode {
+	// Priority 1: Command line flag
+	name := unicodeModeName
+
+	// Priority 2: Config file
+	if name == "" && viper.IsSet("keyboard.unicode") {
+		name = viper.GetString("keyboard.unicode")
+	}
+
+	// Default to skipping with a warning
+	if name == "" {
+		name = string(qmp.UnicodeSkip)
+	}
+
+	mode, err := qmp.ParseUnicodeMode(name)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return mode
+}
+
+// getKeymap determines the guest keyboard layout based on flag or config
+func getKeymap() *keymap.Layout {
+	// Priority 1: Command line flag
+	name := keymapName
+
+	// Priority 2: Config file
+	if name == "" && viper.IsSet("keyboard.keymap") {
+		name = viper.GetString("keyboard.keymap")
+	}
+
+	// Default to US
+	if name == "" {
+		name = "us"
+	}
+
+	layout, err := keymap.Get(name)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+
+	logging.Debug("Using keymap", "keymap", layout.Name)
+	return layout
 }
 
 func init() {
 	rootCmd.AddCommand(keyboardCmd)
 	keyboardCmd.AddCommand(sendKeyCmd)
 	keyboardCmd.AddCommand(typeTextCmd)
+	keyboardCmd.AddCommand(rawKeysCmd)
 
 	// Add flags for keyboard commands - use "l" as shorthand for delay
 	typeTextCmd.Flags().DurationVarP(&keyDelay, "delay", "l", 0, "delay between key presses (default 50ms)")
+	typeTextCmd.Flags().StringVar(&typeFile, "file", "", "type the contents of this file")
+	typeTextCmd.Flags().StringVar(&typeRate, "rate", "", "typing rate in characters per second, e.g. 200cps (overrides --delay)")
+	typeTextCmd.Flags().IntVar(&typeChunk, "chunk", 0, "pause after every N characters (0 disables chunking)")
+	typeTextCmd.Flags().DurationVar(&typeChunkWait, "chunk-pause", 250*time.Millisecond, "pause between chunks")
+
+	rawKeysCmd.Flags().StringVar(&rawScancodes, "scancodes", "", "hex scancodes, e.g. \"1d 38 e0 53\" (commas separate presses)")
+	rawKeysCmd.Flags().DurationVar(&rawPress, "press", qmp.DefaultPressDuration, "how long each press is held")
+	rawKeysCmd.MarkFlagRequired("scancodes")
 
 	// Bind flags to viper
 	viper.BindPFlag("keyboard.delay", typeTextCmd.Flags().Lookup("delay"))
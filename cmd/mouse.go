@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	mouseButton       string
+	mouseRelative     bool
+	mouseScreenWidth  int
+	mouseScreenHeight int
+)
+
+// mouseCmd represents the mouse command
+var mouseCmd = &cobra.Command{
+	Use:   "mouse",
+	Short: "Send mouse input to the VM",
+	Long: `Send mouse input to the VM, including pointer movement, clicks,
+drags and wheel scrolling.
+
+Absolute positions are given in screen pixels and are scaled using the
+screen size (--screen-width/--screen-height, default 1024x768). Absolute
+movement requires an absolute pointing device in the guest (e.g. usb-tablet).`,
+}
+
+// mouseMoveCmd represents the mouse move command
+var mouseMoveCmd = &cobra.Command{
+	Use:   "move [vmid] [x] [y]",
+	Short: "Move the mouse pointer",
+	Long: `Move the mouse pointer to an absolute position, or by a relative
+offset when --relative is set.
+
+Examples:
+  # Move the pointer to 120,480
+  qmp mouse move 106 120 480
+
+  # Move the pointer 10 pixels right and 5 pixels up
+  qmp mouse move 106 10 -5 --relative`,
+	Args: cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		x, y := parseMouseCoords(args[1], args[2])
+
+		client := connectMouseClient(vmid)
+		defer client.Close()
+
+		var err error
+		if mouseRelative {
+			err = client.MouseMoveRel(x, y)
+		} else {
+			width, height := getMouseScreenSize()
+			err = client.MouseMove(x, y, width, height)
+		}
+
+		if err != nil {
+			exitWithError("Error moving mouse on VM %s: %v", vmid, err)
+		}
+
+		printMouseResult(vmid, "move", fmt.Sprintf("Moved mouse to %d,%d on VM %s", x, y, vmid))
+	},
+}
+
+// mouseClickCmd represents the mouse click command
+var mouseClickCmd = &cobra.Command{
+	Use:   "click [vmid] [x y]",
+	Short: "Click a mouse button",
+	Long: `Click a mouse button, optionally moving the pointer to an absolute
+position first.
+
+Examples:
+  # Left click at the current position
+  qmp mouse click 106
+
+  # Right click at 120,480
+  qmp mouse click 106 120 480 --button right`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 && len(args) != 3 {
+			return fmt.Errorf("accepts either [vmid] or [vmid] [x] [y], received %d arg(s)", len(args))
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		client := connectMouseClient(vmid)
+		defer client.Close()
+
+		if len(args) == 3 {
+			x, y := parseMouseCoords(args[1], args[2])
+			width, height := getMouseScreenSize()
+			if err := client.MouseMove(x, y, width, height); err != nil {
+				exitWithError("Error moving mouse on VM %s: %v", vmid, err)
+			}
+		}
+
+		if err := client.MouseClick(mouseButton); err != nil {
+			exitWithError("Error clicking %s button on VM %s: %v", mouseButton, vmid, err)
+		}
+
+		printMouseResult(vmid, "click", fmt.Sprintf("Clicked %s button on VM %s", mouseButton, vmid))
+	},
+}
+
+// mouseDragCmd represents the mouse drag command
+var mouseDragCmd = &cobra.Command{
+	Use:   "drag [vmid] [x1] [y1] [x2] [y2]",
+	Short: "Drag the mouse between two positions",
+	Long: `Press a mouse button at one absolute position, move to another and
+release it.
+
+Example:
+  qmp mouse drag 106 100 100 400 300`,
+	Args: cobra.ExactArgs(5),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		fromX, fromY := parseMouseCoords(args[1], args[2])
+		toX, toY := parseMouseCoords(args[3], args[4])
+
+		client := connectMouseClient(vmid)
+		defer client.Close()
+
+		width, height := getMouseScreenSize()
+		if err := client.MouseDrag(mouseButton, fromX, fromY, toX, toY, width, height); err != nil {
+			exitWithError("Error dragging mouse on VM %s: %v", vmid, err)
+		}
+
+		printMouseResult(vmid, "drag", fmt.Sprintf("Dragged from %d,%d to %d,%d on VM %s", fromX, fromY, toX, toY, vmid))
+	},
+}
+
+// mouseScrollCmd represents the mouse scroll command
+var mouseScrollCmd = &cobra.Command{
+	Use:   "scroll [vmid] [steps]",
+	Short: "Scroll the mouse wheel",
+	Long: `Scroll the mouse wheel by a number of steps.
+Positive values scroll down, negative values scroll up.
+
+Examples:
+  qmp mouse scroll 106 3
+  qmp mouse scroll 106 -- -3`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		steps, err := strconv.Atoi(args[1])
+		if err != nil {
+			exitWithError("Invalid scroll steps '%s': %v", args[1], err)
+		}
+
+		client := connectMouseClient(vmid)
+		defer client.Close()
+
+		if err := client.MouseScroll(steps); err != nil {
+			exitWithError("Error scrolling on VM %s: %v", vmid, err)
+		}
+
+		printMouseResult(vmid, "scroll", fmt.Sprintf("Scrolled %d step(s) on VM %s", steps, vmid))
+	},
+}
+
+// printMouseResult reports a completed mouse action
+func printMouseResult(vmid string, action string, message string) {
+	if isJSONOutput() {
+		printJSON(map[string]interface{}{
+			"vmid":    vmid,
+			"action":  action,
+			"message": message,
+		})
+		return
+	}
+
+	fmt.Println(message)
+}
+
+// connectMouseClient connects to the VM or exits on failure
+func connectMouseClient(vmid string) *qmp.Client {
+	client := newQMPClient(vmid)
+	attachRecorder(client)
+
+	if err := client.Connect(); err != nil {
+		exitWithError("Error connecting to VM %s: %v", vmid, err)
+	}
+
+	return client
+}
+
+// parseMouseCoords parses an x/y pair or exits on failure
+func parseMouseCoords(xArg, yArg string) (int, int) {
+	x, err := strconv.Atoi(xArg)
+	if err != nil {
+		exitWithError("Invalid x coordinate '%s': %v", xArg, err)
+	}
+	y, err := strconv.Atoi(yArg)
+	if err != nil {
+		exitWithError("Invalid y coordinate '%s': %v", yArg, err)
+	}
+	return x, y
+}
+
+// getMouseScreenSize determines the screen size used to scale absolute positions
+func getMouseScreenSize() (int, int) {
+	width, height := 1024, 768
+
+	// Priority 1: Command line flags
+	// Priority 2: Config file
+	if mouseScreenWidth > 0 {
+		width = mouseScreenWidth
+	} else if viper.IsSet("mouse.screen_width") {
+		width = viper.GetInt("mouse.screen_width")
+	}
+
+	if mouseScreenHeight > 0 {
+		height = mouseScreenHeight
+	} else if viper.IsSet("mouse.screen_height") {
+		height = viper.GetInt("mouse.screen_height")
+	}
+
+	logging.Debug("Using screen size for mouse", "width", width, "height", height)
+	return width, height
+}
+
+func init() {
+	rootCmd.AddCommand(mouseCmd)
+	mouseCmd.AddCommand(mouseMoveCmd)
+	mouseCmd.AddCommand(mouseClickCmd)
+	mouseCmd.AddCommand(mouseDragCmd)
+	mouseCmd.AddCommand(mouseScrollCmd)
+
+	mouseCmd.PersistentFlags().IntVar(&mouseScreenWidth, "screen-width", 0, "screen width used to scale absolute positions (default 1024)")
+	mouseCmd.PersistentFlags().IntVar(&mouseScreenHeight, "screen-height", 0, "screen height used to scale absolute positions (default 768)")
+	mouseMoveCmd.Flags().BoolVar(&mouseRelative, "relative", false, "move relative to the current position")
+	mouseClickCmd.Flags().StringVarP(&mouseButton, "button", "b", "left", "mouse button (left, middle, right)")
+	mouseDragCmd.Flags().StringVarP(&mouseButton, "button", "b", "left", "mouse button (left, middle, right)")
+
+	// Bind flags to viper
+	viper.BindPFlag("mouse.screen_width", mouseCmd.PersistentFlags().Lookup("screen-width"))
+	viper.BindPFlag("mouse.screen_height", mouseCmd.PersistentFlags().Lookup("screen-height"))
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/jstein/qmp/internal/netwait"
+	"github.com/spf13/cobra"
+)
+
+var (
+	netPort     int
+	netTimeout  time.Duration
+	netInterval time.Duration
+)
+
+// netCmd represents the net command
+var netCmd = &cobra.Command{
+	Use:   "net",
+	Short: "Check guest network reachability",
+}
+
+// netWaitCmd represents the net wait command
+var netWaitCmd = &cobra.Command{
+	Use:   "wait [host]",
+	Short: "Wait until a TCP port on the guest is reachable",
+	Long: `Probe a TCP port on the guest from this host until a connection
+succeeds, so automation can hand over to SSH or Ansible as soon as the
+service is up instead of sleeping a fixed time.
+
+Exits with status 1 if the port is not reachable within the timeout.
+
+Examples:
+  qmp net wait 192.168.1.50
+  qmp net wait 192.168.1.50 --port 5986 --timeout 10m`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		address := netwait.Address(args[0], netPort)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if !isJSONOutput() {
+			fmt.Printf("Waiting for %s (timeout %v)...\n", address, netTimeout)
+		}
+
+		result, err := netwait.Wait(ctx, address, netTimeout, netInterval)
+		if err != nil {
+			if isJSONOutput() {
+				printJSON(map[string]interface{}{
+					"address":   address,
+					"reachable": false,
+					"error":     err.Error(),
+				})
+			} else {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			}
+			os.Exit(1)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"address":    address,
+				"reachable":  true,
+				"attempts":   result.Attempts,
+				"elapsed_ms": result.Elapsed.Milliseconds(),
+			})
+			return
+		}
+
+		fmt.Printf("%s is reachable after %v (%d attempts)\n", address, result.Elapsed.Round(time.Millisecond), result.Attempts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(netCmd)
+	netCmd.AddCommand(netWaitCmd)
+
+	netWaitCmd.Flags().IntVarP(&netPort, "port", "p", 22, "TCP port to probe")
+	netWaitCmd.Flags().DurationVarP(&netTimeout, "timeout", "t", 300*time.Second, "how long to wait")
+	netWaitCmd.Flags().DurationVar(&netInterval, "interval", 2*time.Second, "delay between attempts")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// isJSONOutput reports whether machine-readable JSON output was requested
+func isJSONOutput() bool {
+	if outputFormat != "" {
+		return strings.ToLower(outputFormat) == "json"
+	}
+	return strings.ToLower(viper.GetString("output")) == "json"
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON output: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// exitWithError reports an error and exits with status 1. With JSON output
+// the error is printed as {"error": "..."} on stdout so callers can always
+// parse it; otherwise it goes to stderr.
+func exitWithError(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if isJSONOutput() {
+		printJSON(map[string]string{"error": message})
+	} else {
+		fmt.Fprintln(os.Stderr, message)
+	}
+	os.Exit(1)
+}
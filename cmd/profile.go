@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jstein/qmp/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileSettings []string
+)
+
+// profileCmd represents the profile command
+var profileCmd = &cobra.Command{
+	Use:   "profile",
+	Short: "Manage configuration profiles",
+	Long: `Manage named configuration profiles, e.g. one per Proxmox host or cluster.
+
+Profiles are stored in ~/.config/qmp/profiles.yaml. Each profile holds
+config keys (the same keys as .qmp.yaml) that override the base config when
+the profile is active. Select a profile with --profile NAME, the
+QMP_PROFILE environment variable, or 'qmp profile use NAME'.
+
+The socket key may contain %s, which is replaced by the VM ID.
+
+Example profiles.yaml:
+  current: lab
+  profiles:
+    lab:
+      socket: /mnt/pve1/qemu-server/%s.qmp
+      proxmox:
+        url: https://pve1:8006
+        token_id: root@pam!qmp
+      mouse:
+        screen_width: 1280
+        screen_height: 800`,
+}
+
+// profileListCmd represents the profile list command
+var profileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List profiles",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, _ := loadProfiles()
+		active := activeProfileName(store)
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"active":   active,
+				"profiles": store.Names(),
+			})
+			return
+		}
+
+		if len(store.Profiles) == 0 {
+			fmt.Println("No profiles configured")
+			return
+		}
+
+		for _, name := range store.Names() {
+			marker := " "
+			if name == active {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+	},
+}
+
+// profileAddCmd represents the profile add command
+var profileAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add or update a profile",
+	Long: `Add a profile, or update an existing one, with --set KEY=VALUE for each
+config key.
+
+Example:
+  qmp profile add lab --set socket=/mnt/pve1/%s.qmp --set proxmox.url=https://pve1:8006`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		store, path := loadProfiles()
+
+		for _, setting := range profileSettings {
+			key, value, ok := strings.Cut(setting, "=")
+			if !ok || key == "" {
+				exitWithError("Invalid setting '%s' (use KEY=VALUE)", setting)
+			}
+			store.Set(name, key, value)
+		}
+		if _, ok := store.Profiles[name]; !ok {
+			store.Profiles[name] = map[string]interface{}{}
+		}
+
+		if err := store.Save(path); err != nil {
+			exitWithError("Error saving profiles: %v", err)
+		}
+		fmt.Printf("Saved profile %s to %s\n", name, path)
+	},
+}
+
+// profileUseCmd represents the profile use command
+var profileUseCmd = &cobra.Command{
+	Use:   "use [name]",
+	Short: "Make a profile the default",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		store, path := loadProfiles()
+
+		if _, err := store.Get(name); err != nil {
+			exitWithError("Error: %v", err)
+		}
+
+		store.Current = name
+		if err := store.Save(path); err != nil {
+			exitWithError("Error saving profiles: %v", err)
+		}
+		fmt.Printf("Using profile %s\n", name)
+	},
+}
+
+// loadProfiles loads the profile store and returns it with its path, or exits on failure
+func loadProfiles() (*profile.Store, string) {
+	path, err := profile.DefaultPath()
+	if err != nil {
+		exitWithError("Error locating profiles: %v", err)
+	}
+
+	store, err := profile.Load(path)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return store, path
+}
+
+// activeProfileName determines the active profile based on flag, env or the profiles file
+func activeProfileName(store *profile.Store) string {
+	// Priority 1: Command line flag
+	if profileName != "" {
+		return profileName
+	}
+
+	// Priority 2: Environment variable
+	if name := os.Getenv("QMP_PROFILE"); name != "" {
+		return name
+	}
+
+	// Priority 3: Current profile in the profiles file
+	return store.Current
+}
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileAddCmd)
+	profileCmd.AddCommand(profileUseCmd)
+
+	profileAddCmd.Flags().StringArrayVar(&profileSettings, "set", nil, "config setting KEY=VALUE (repeatable)")
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rawFile string
+	rawArgs []string
+)
+
+// rawCmd represents the raw command
+var rawCmd = &cobra.Command{
+	Use:   "raw [vmid] [command]",
+	Short: "Send an arbitrary QMP command",
+	Long: `Send an arbitrary QMP command and print the pretty-printed response.
+Use this for QMP commands the CLI has no wrapper for.
+
+The command is given as JSON on the command line or read from --file.
+--arg NAME=VALUE sets an argument; VALUE is parsed as JSON when possible
+and used as a string otherwise.
+
+Examples:
+  qmp raw 106 '{"execute":"query-block"}'
+  qmp raw 106 --file cmd.json
+  qmp raw 106 '{"execute":"set_link"}' --arg name=net0 --arg up=false`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if rawFile != "" {
+			return cobra.ExactArgs(1)(cmd, args)
+		}
+		return cobra.ExactArgs(2)(cmd, args)
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		var data []byte
+		if rawFile != "" {
+			var err error
+			if data, err = os.ReadFile(rawFile); err != nil {
+				exitWithError("Error reading command file: %v", err)
+			}
+		} else {
+			data = []byte(args[1])
+		}
+
+		command, err := qmp.ParseCommand(data)
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+		if err := applyRawArgs(&command, rawArgs); err != nil {
+			exitWithError("Error: %v", err)
+		}
+
+		client := newQMPClient(vmid)
+
+		if err := client.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer client.Close()
+
+		result, err := client.Execute(command)
+		if err != nil {
+			exitWithError("Error executing %s on VM %s: %v", command.Execute, vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":    vmid,
+				"command": command,
+				"return":  result,
+			})
+			return
+		}
+
+		// String returns (e.g. human-monitor-command output) are printed as text
+		if text, ok := result.(string); ok {
+			fmt.Print(text)
+			return
+		}
+		printJSON(result)
+	},
+}
+
+// applyRawArgs sets NAME=VALUE arguments on a command
+func applyRawArgs(command *qmp.Command, args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+
+	arguments, ok := command.Arguments.(map[string]interface{})
+	if command.Arguments != nil && !ok {
+		return fmt.Errorf("command arguments must be a JSON object")
+	}
+	if arguments == nil {
+		arguments = map[string]interface{}{}
+	}
+
+	for _, arg := range args {
+		name, value, found := strings.Cut(arg, "=")
+		if !found || name == "" {
+			return fmt.Errorf("invalid argument %q (use NAME=VALUE)", arg)
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		arguments[name] = parsed
+	}
+	command.Arguments = arguments
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(rawCmd)
+	rawCmd.Flags().StringVar(&rawFile, "file", "", "read the JSON command from this file")
+	rawCmd.Flags().StringArrayVar(&rawArgs, "arg", nil, "set a command argument (NAME=VALUE, repeatable)")
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/recording"
+	"github.com/spf13/viper"
+)
+
+var (
+	recordDir string
+
+	// sessionRecorder is created on first use when recording is enabled
+	sessionRecorder *recording.Recorder
+)
+
+// getRecorder returns the session recorder, or nil when recording is disabled
+func getRecorder() *recording.Recorder {
+	if sessionRecorder != nil {
+		return sessionRecorder
+	}
+
+	// Priority 1: Command line flag
+	// Priority 2: Config file
+	dir := recordDir
+	if dir == "" {
+		dir = viper.GetString("record")
+	}
+	if dir == "" {
+		return nil
+	}
+
+	recorder, err := recording.New(dir)
+	if err != nil {
+		exitWithError("Error starting session recording: %v", err)
+	}
+
+	logging.Info("Recording session", "dir", dir)
+	sessionRecorder = recorder
+	return sessionRecorder
+}
+
+// attachRecorder makes the client record its inputs and screenshots
+func attachRecorder(client *qmp.Client) {
+	if recorder := getRecorder(); recorder != nil {
+		client.SetRecorder(recorder)
+	}
+}
+
+// closeRecorder finishes the session recording, if any
+func closeRecorder() {
+	if sessionRecorder != nil {
+		sessionRecorder.Close()
+		sessionRecorder = nil
+	}
+}
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jstein/qmp/internal/keyrec"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/spf13/cobra"
+)
+
+var (
+	recordKeysOut   string
+	recordKeysPause time.Duration
+)
+
+// recordKeysCmd represents the record-keys command
+var recordKeysCmd = &cobra.Command{
+	Use:   "record-keys [vmid]",
+	Short: "Forward local key presses to the VM and record them as a script",
+	Long: `Open an interactive session where every key pressed locally is sent to
+the VM and written to a script file, so a task can be done once by hand and
+then replayed with 'qmp script'.
+
+Completed lines are written as script lines. Special keys are written as
+<key NAME> directives, with any text typed before them on the same line
+written as <type "TEXT">. Pauses longer than --pause between lines are
+recorded as <sleep N>. Press Ctrl+] to stop recording.
+
+Example:
+  qmp record-keys 106 --out macro.txt`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		client := newQMPClient(vmid)
+
+		if err := client.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer client.Close()
+		configureKeyboard(client)
+		attachRecorder(client)
+
+		model := keyrec.New(vmid, keySender{client}, recordKeysPause)
+		if _, err := tea.NewProgram(model).Run(); err != nil {
+			exitWithError("Error running recorder: %v", err)
+		}
+
+		lines := model.Lines()
+		content := strings.Join(lines, "\n")
+		if len(lines) > 0 {
+			content += "\n"
+		}
+		if err := os.WriteFile(recordKeysOut, []byte(content), 0644); err != nil {
+			exitWithError("Error writing script: %v", err)
+		}
+
+		fmt.Printf("Recorded %d line(s) to %s\n", len(lines), recordKeysOut)
+	},
+}
+
+// keySender adapts a QMP client to the key recorder
+type keySender struct {
+	client *qmp.Client
+}
+
+// SendText implements keyrec.Sender
+func (s keySender) SendText(text string) error {
+	return s.client.SendString(text, 0)
+}
+
+// SendCombo implements keyrec.Sender
+func (s keySender) SendCombo(combo string) error {
+	return s.client.SendCombo(combo)
+}
+
+func init() {
+	rootCmd.AddCommand(recordKeysCmd)
+	recordKeysCmd.Flags().StringVar(&recordKeysOut, "out", "macro.txt", "script file to write")
+	recordKeysCmd.Flags().DurationVar(&recordKeysPause, "pause", 2*time.Second, "record pauses longer than this between lines as <sleep> (0 disables)")
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// replCmd represents the script repl command
+var replCmd = &cobra.Command{
+	Use:   "repl [vmid]",
+	Short: "Run script lines interactively",
+	Long: `Open an interactive prompt where script lines and <command> directives
+are executed against the VM as soon as they are entered.
+
+REPL commands:
+  :help          - Show this help
+  :history       - Show the lines entered so far
+  :save FILE     - Save the executed lines as a script file
+  :quit          - Leave the REPL (Ctrl+D also works)
+
+Example:
+  qmp script repl 106`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+
+		client := newQMPClient(vmid)
+
+		configureKeyboard(client)
+		attachRecorder(client)
+
+		conn := newConnectionManager(client)
+		if err := conn.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer conn.Close()
+
+		executor := newScriptExecutor(vmid, conn)
+		defer executor.Close()
+
+		fmt.Printf("Connected to VM %s. Type :help for help, :quit to exit.\n", vmid)
+
+		var history []string
+		scanner := bufio.NewScanner(os.Stdin)
+		for {
+			fmt.Printf("qmp:%s> ", vmid)
+			if !scanner.Scan() {
+				fmt.Println()
+				break
+			}
+
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			// REPL commands start with ':'
+			if strings.HasPrefix(line, ":") {
+				fields := strings.Fields(line)
+				switch fields[0] {
+				case ":quit", ":q", ":exit":
+					return
+				case ":help", ":h":
+					fmt.Println(cmd.Long)
+				case ":history":
+					for i, entry := range history {
+						fmt.Printf("%4d  %s\n", i+1, entry)
+					}
+				case ":save":
+					if len(fields) != 2 {
+						fmt.Println("Usage: :save FILE")
+						continue
+					}
+					if err := saveReplHistory(fields[1], history); err != nil {
+						fmt.Printf("Error saving script: %v\n", err)
+						continue
+					}
+					fmt.Printf("Saved %d line(s) to %s\n", len(history), fields[1])
+				default:
+					fmt.Printf("Unknown REPL command: %s\n", fields[0])
+				}
+				continue
+			}
+
+			if err := executor.ExecuteLine(line); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			history = append(history, line)
+		}
+
+		if err := scanner.Err(); err != nil {
+			exitWithError("Error reading input: %v", err)
+		}
+	},
+}
+
+// saveReplHistory writes the executed REPL lines to a script file
+func saveReplHistory(filename string, history []string) error {
+	content := strings.Join(history, "\n")
+	if len(history) > 0 {
+		content += "\n"
+	}
+	return os.WriteFile(filename, []byte(content), 0644)
+}
+
+func init() {
+	scriptCmd.AddCommand(replCmd)
+}
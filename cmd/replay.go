@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/jstein/qmp/internal/recording"
+	"github.com/jstein/qmp/internal/replay"
+	"github.com/spf13/cobra"
+)
+
+var (
+	replayList bool
+)
+
+// replayCmd represents the replay command
+var replayCmd = &cobra.Command{
+	Use:   "replay [session-dir]",
+	Short: "Play back a recorded session",
+	Long: `Play back a session recorded with --record in an interactive timeline
+showing keystrokes, script lines, screenshots and timings.
+
+Use --list to print the timeline instead of opening the interactive view.
+
+Examples:
+  qmp replay ./sessions/install-106
+  qmp replay ./sessions/install-106 --list`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+
+		events, err := recording.Load(dir)
+		if err != nil {
+			exitWithError("Error loading session: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(events)
+			return
+		}
+
+		if replayList {
+			for _, event := range events {
+				fmt.Printf("%12s  %-10s %s\n", event.Elapsed.Truncate(time.Millisecond), event.Type, event.Describe())
+			}
+			return
+		}
+
+		program := tea.NewProgram(replay.New(dir, events), tea.WithAltScreen())
+		if _, err := program.Run(); err != nil {
+			exitWithError("Error running replay: %v", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(replayCmd)
+	replayCmd.Flags().BoolVar(&replayList, "list", false, "print the timeline instead of opening the interactive view")
+}
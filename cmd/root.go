@@ -6,111 +6,234 @@ import (
 	"path/filepath"
 
 	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/profile"
+	"github.com/jstein/qmp/internal/qmp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-    cfgFile    string
-    debug      bool
-    socketPath string
+	cfgFile           string
+	debug             bool
+	socketPath        string
+	outputFormat      string
+	keymapName        string
+	unicodeModeName   string
+	timingProfileName string
+	failOnPaused      bool
+	profileName       string
+	remoteHost        string
+	logFile           string
+	logKeep           int
 )
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-    Use:   "qmp",
-    Short: "QMP Controller is a CLI tool for managing QEMU virtual machines",
-    Long: `QMP Controller provides a command-line interface to interact with
+	Use:   "qmp",
+	Short: "QMP Controller is a CLI tool for managing QEMU virtual machines",
+	Long: `QMP Controller provides a command-line interface to interact with
 QEMU's QMP (QEMU Machine Protocol) for managing virtual machines.`,
-    PersistentPreRun: func(cmd *cobra.Command, args []string) {
-        // Initialize logging based on debug flag
-        logging.Init(debug)
-
-        if debug {
-            logging.Debug("Debug mode enabled")
-            logging.Debug("Using socket path", "path", GetSocketPath())
-        }
-    },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Initialize logging based on debug flag
+		logging.Init(debug)
+
+		// Keep stdout clean for machine-readable output
+		if isJSONOutput() {
+			logging.SetOutput(os.Stderr)
+		}
+
+		if debug {
+			logging.Debug("Debug mode enabled")
+			logging.Debug("Using socket path", "path", GetSocketPath())
+		}
+	},
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {
+		closeRecorder()
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() error {
-    return rootCmd.Execute()
+	return rootCmd.Execute()
 }
 
 func init() {
-    cobra.OnInitialize(initConfig)
-
-    // Global flags
-    rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.qmp.yaml)")
-    rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug output")
-    rootCmd.PersistentFlags().StringVarP(&socketPath, "socket", "s", "", "custom socket path (for SSH tunneling)")
-
-    // Bind flags to Viper
-    viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
-    viper.BindPFlag("socket", rootCmd.PersistentFlags().Lookup("socket"))
+	cobra.OnInitialize(initConfig)
+
+	// Global flags
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.qmp.yaml)")
+	rootCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug output")
+	rootCmd.PersistentFlags().StringVarP(&socketPath, "socket", "s", "", "custom socket path (for SSH tunneling; %s is replaced by the VM ID)")
+	rootCmd.PersistentFlags().StringVar(&remoteHost, "remote", "", "reach the QMP socket on a remote hypervisor over SSH (e.g. root@pve1)")
+	rootCmd.PersistentFlags().StringVar(&profileName, "profile", "", "configuration profile to use (see 'qmp profile')")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", "", "output format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&keymapName, "keymap", "", "guest keyboard layout (us, uk, de, fr, dvorak)")
+	rootCmd.PersistentFlags().StringVar(&unicodeModeName, "unicode", "", "how to type characters missing from the keymap (skip, compose, hex)")
+	rootCmd.PersistentFlags().StringVar(&timingProfileName, "timing-profile", "", "key timing profile for the guest (bios, grub, installer, os)")
+	rootCmd.PersistentFlags().BoolVar(&failOnPaused, "fail-on-paused", false, "check the VM is running after sending keys and fail if it is paused")
+	rootCmd.PersistentFlags().StringVar(&recordDir, "record", "", "record all inputs and screenshots into this session directory")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "also write the log of each script run to this file ({vmid} and {time} are expanded)")
+	rootCmd.PersistentFlags().IntVar(&logKeep, "log-keep", 5, "number of rotated log files to keep")
+	rootCmd.PersistentFlags().StringVar(&zonesFile, "zones", "", "YAML file of named screen regions")
+
+	// Bind flags to Viper
+	viper.BindPFlag("debug", rootCmd.PersistentFlags().Lookup("debug"))
+	viper.BindPFlag("socket", rootCmd.PersistentFlags().Lookup("socket"))
+	viper.BindPFlag("output", rootCmd.PersistentFlags().Lookup("output"))
+	viper.BindPFlag("keyboard.keymap", rootCmd.PersistentFlags().Lookup("keymap"))
+	viper.BindPFlag("keyboard.unicode", rootCmd.PersistentFlags().Lookup("unicode"))
+	viper.BindPFlag("keyboard.timing_profile", rootCmd.PersistentFlags().Lookup("timing-profile"))
+	viper.BindPFlag("keyboard.fail_on_paused", rootCmd.PersistentFlags().Lookup("fail-on-paused"))
+	viper.BindPFlag("remote", rootCmd.PersistentFlags().Lookup("remote"))
+	viper.BindPFlag("record", rootCmd.PersistentFlags().Lookup("record"))
+	viper.BindPFlag("log.file", rootCmd.PersistentFlags().Lookup("log-file"))
+	viper.BindPFlag("log.keep", rootCmd.PersistentFlags().Lookup("log-keep"))
+	viper.BindPFlag("screen.zones_file", rootCmd.PersistentFlags().Lookup("zones"))
 }
 
 // initConfig reads in config file and ENV variables if set.
 func initConfig() {
-    // Set environment variable prefix for our app
-    viper.SetEnvPrefix("QMP")
-
-    // Enable automatic environment variable binding (QMP_DEBUG, QMP_SOCKET, etc.)
-    viper.AutomaticEnv()
-
-    // Set default values
-    viper.SetDefault("debug", false)
-    viper.SetDefault("socket", "")
-
-    // Config file setup
-    if cfgFile != "" {
-        // Use config file from the flag
-        viper.SetConfigFile(cfgFile)
-    } else {
-        // Search for config in standard locations
-
-        // 1. Current directory
-        viper.AddConfigPath(".")
-
-        // 2. User's home directory
-        home, err := os.UserHomeDir()
-        if err == nil {
-            viper.AddConfigPath(filepath.Join(home))
-        }
-
-        // 3. System config directories
-        viper.AddConfigPath("/etc/qmp")
-
-        // Set config name and type
-        viper.SetConfigType("yaml")
-        viper.SetConfigName(".qmp")
-    }
-
-    // Read the config file
-    if err := viper.ReadInConfig(); err != nil {
-        if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-            // Config file was found but another error occurred
-            fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
-        }
-        // It's okay if no config file is found - we'll use defaults and env vars
-    } else if debug {
-        logging.Debug("Using config file", "path", viper.ConfigFileUsed())
-    }
-
-    // Update the debug and socketPath variables from viper
-    // This ensures they reflect values from config file or env vars
-    debug = viper.GetBool("debug")
-    socketPath = viper.GetString("socket")
+	// Set environment variable prefix for our app
+	viper.SetEnvPrefix("QMP")
+
+	// Enable automatic environment variable binding (QMP_DEBUG, QMP_SOCKET, etc.)
+	viper.AutomaticEnv()
+
+	// Set default values
+	viper.SetDefault("debug", false)
+	viper.SetDefault("socket", "")
+	viper.SetDefault("output", "text")
+
+	// Config file setup
+	if cfgFile != "" {
+		// Use config file from the flag
+		viper.SetConfigFile(cfgFile)
+	} else {
+		// Search for config in standard locations
+
+		// 1. Current directory
+		viper.AddConfigPath(".")
+
+		// 2. User's home directory
+		home, err := os.UserHomeDir()
+		if err == nil {
+			viper.AddConfigPath(filepath.Join(home))
+		}
+
+		// 3. System config directories
+		viper.AddConfigPath("/etc/qmp")
+
+		// Set config name and type
+		viper.SetConfigType("yaml")
+		viper.SetConfigName(".qmp")
+	}
+
+	// Read the config file
+	if err := viper.ReadInConfig(); err != nil {
+		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
+			// Config file was found but another error occurred
+			fmt.Fprintf(os.Stderr, "Error reading config file: %v\n", err)
+		}
+		// It's okay if no config file is found - we'll use defaults and env vars
+	} else if debug {
+		logging.Debug("Using config file", "path", viper.ConfigFileUsed())
+	}
+
+	// Apply the active profile on top of the config file
+	applyProfile()
+
+	// Update the debug and socketPath variables from viper
+	// This ensures they reflect values from config file or env vars
+	debug = viper.GetBool("debug")
+	socketPath = viper.GetString("socket")
+}
+
+// applyProfile merges the settings of the active profile into the config
+func applyProfile() {
+	path, err := profile.DefaultPath()
+	if err != nil {
+		return
+	}
+	store, err := profile.Load(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading profiles: %v\n", err)
+		return
+	}
+
+	name := activeProfileName(store)
+	if name == "" {
+		return
+	}
+
+	settings, err := store.Get(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := viper.MergeConfigMap(settings); err != nil {
+		fmt.Fprintf(os.Stderr, "Error applying profile %s: %v\n", name, err)
+		os.Exit(1)
+	}
+	if debug {
+		logging.Debug("Using profile", "profile", name)
+	}
 }
 
 // GetSocketPath returns the socket path from config, env var, or flag
 func GetSocketPath() string {
-    // First check if the flag was explicitly set
-    if socketPath != "" {
-        return socketPath
-    }
+	// First check if the flag was explicitly set
+	if socketPath != "" {
+		return socketPath
+	}
+
+	// Otherwise return from viper (which includes env vars and config file)
+	return viper.GetString("socket")
+}
+
+// newQMPClient creates a QMP client for the VM using the configured socket
+// path and remote host
+func newQMPClient(vmid string) *qmp.Client {
+	var client *qmp.Client
+	if socketPath := GetSocketPath(); socketPath != "" {
+		client = qmp.NewWithSocketPath(vmid, socketPath)
+	} else {
+		client = qmp.New(vmid)
+	}
+
+	if remote := getRemoteHost(); remote != "" {
+		client.SetRemote(remote)
+	}
+	return client
+}
+
+// newConnectionManager wraps a client in a managed connection configured
+// from the config file
+func newConnectionManager(client *qmp.Client) *qmp.Manager {
+	conn := qmp.NewManager(client)
+	if viper.IsSet("qmp.max_in_flight") {
+		conn.MaxInFlight = viper.GetInt("qmp.max_in_flight")
+	}
+	return conn
+}
+
+// getRemoteHost returns the SSH destination of a remote hypervisor from flag, env var or config
+func getRemoteHost() string {
+	// Priority 1: Command line flag
+	if remoteHost != "" {
+		return remoteHost
+	}
+
+	// Priority 2: Environment variable or config file
+	return viper.GetString("remote")
+}
+
+// getLogFile determines the log file path template based on flag or config
+func getLogFile() string {
+	// Priority 1: Command line flag
+	if logFile != "" {
+		return logFile
+	}
 
-    // Otherwise return from viper (which includes env vars and config file)
-    return viper.GetString("socket")
+	// Priority 2: Environment variable or config file
+	return viper.GetString("log.file")
 }
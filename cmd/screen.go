@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"os"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/screen"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	screenRows      string
+	screenCols      string
+	screenCellSize  string
+	screenTolerance string
+	screenThreshold int
+	screenZone      string
+	zonesFile       string
+)
+
+// screenCmd represents the screen command
+var screenCmd = &cobra.Command{
+	Use:   "screen",
+	Short: "Inspect and compare the VM screen",
+	Long: `Inspect and compare the VM screen at the pixel level.
+
+Regions are given in character cells with --rows START:END and
+--cols START:END (end exclusive). Cells are converted to pixels using
+--cell-size (default 8x16, or screen.cell_size in the config). Without
+--rows/--cols the whole screen is used.
+
+Named regions can be defined in a zones file (--zones, or screen.zones_file
+in the config) and selected with --zone:
+
+  statusbar:
+    rows: "0:1"
+    cols: "0:80"`,
+}
+
+// screenCompareCmd represents the screen compare command
+var screenCompareCmd = &cobra.Command{
+	Use:   "compare [vmid] [reference]",
+	Short: "Compare a screen region against a reference image",
+	Long: `Capture the screen, crop the region and compare it against a reference
+image (PNG or PPM). Exits with status 1 if the fraction of differing pixels
+exceeds --tolerance.
+
+Examples:
+  # Create a reference image of the GRUB menu
+  qmp screen crop 106 grub.png --rows 10:20 --cols 5:40
+
+  # Later, check the screen still matches
+  qmp screen compare 106 grub.png --rows 10:20 --cols 5:40 --tolerance 2%`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, reference := args[0], args[1]
+
+		tolerance, err := screen.ParseTolerance(screenTolerance)
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+
+		ref, err := screen.LoadImage(reference)
+		if err != nil {
+			exitWithError("Error loading reference image: %v", err)
+		}
+
+		region := captureScreenRegion(vmid)
+
+		diff, err := screen.Compare(region, ref, screenThreshold)
+		if err != nil {
+			exitWithError("Error comparing images: %v", err)
+		}
+		match := diff <= tolerance
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":      vmid,
+				"reference": reference,
+				"diff":      diff,
+				"tolerance": tolerance,
+				"match":     match,
+			})
+		} else if match {
+			fmt.Printf("Screen matches %s (%.2f%% different, tolerance %.2f%%)\n", reference, diff*100, tolerance*100)
+		} else {
+			fmt.Printf("Screen does not match %s (%.2f%% different, tolerance %.2f%%)\n", reference, diff*100, tolerance*100)
+		}
+
+		if !match {
+			os.Exit(1)
+		}
+	},
+}
+
+// screenCropCmd represents the screen crop command
+var screenCropCmd = &cobra.Command{
+	Use:   "crop [vmid] [output-file]",
+	Short: "Save a screen region as an image",
+	Long: `Capture the screen and save a region as a PNG or PPM image, e.g. to
+create reference images for 'qmp screen compare' and <assert-region>.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, outputFile := args[0], args[1]
+
+		region := captureScreenRegion(vmid)
+		format := getScreenshotFormat(outputFile)
+		if err := screen.SaveImage(region, outputFile, format); err != nil {
+			exitWithError("Error saving image: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":   vmid,
+				"file":   outputFile,
+				"width":  region.Bounds().Dx(),
+				"height": region.Bounds().Dy(),
+			})
+			return
+		}
+
+		fmt.Printf("Saved %dx%d region to %s\n", region.Bounds().Dx(), region.Bounds().Dy(), outputFile)
+	},
+}
+
+// captureScreenRegion captures the screen and crops the selected region, or exits on failure
+func captureScreenRegion(vmid string) image.Image {
+	client := newQMPClient(vmid)
+
+	if err := client.Connect(); err != nil {
+		exitWithError("Error connecting to VM %s: %v", vmid, err)
+	}
+	defer client.Close()
+
+	img, err := client.CaptureImage()
+	if err != nil {
+		exitWithError("Error taking screenshot: %v", err)
+	}
+
+	var region screen.Region
+	switch {
+	case screenZone != "":
+		region, err = getZones().Get(screenZone)
+	case screenRows != "" || screenCols != "":
+		region, err = screen.ParseRegion(screenRows, screenCols)
+	default:
+		return img
+	}
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+
+	cellWidth, cellHeight := getCellSize()
+	cropped, err := screen.Crop(img, region.Pixels(cellWidth, cellHeight))
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return cropped
+}
+
+// getZones loads the zones file based on flag or config, or exits on failure
+func getZones() screen.Zones {
+	// Priority 1: Command line flag
+	// Priority 2: Config file
+	filename := zonesFile
+	if filename == "" {
+		filename = viper.GetString("screen.zones_file")
+	}
+	if filename == "" {
+		return screen.Zones{}
+	}
+
+	zones, err := screen.LoadZones(filename)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	logging.Debug("Loaded zones file", "file", filename, "zones", len(zones))
+	return zones
+}
+
+// getCellSize determines the character cell size based on flag or config
+func getCellSize() (int, int) {
+	// Priority 1: Command line flag
+	size := screenCellSize
+
+	// Priority 2: Config file
+	if size == "" && viper.IsSet("screen.cell_size") {
+		size = viper.GetString("screen.cell_size")
+	}
+
+	// Default to the standard 8x16 console font
+	if size == "" {
+		size = "8x16"
+	}
+
+	width, height, err := screen.ParseCellSize(size)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return width, height
+}
+
+func init() {
+	rootCmd.AddCommand(screenCmd)
+	screenCmd.AddCommand(screenCompareCmd)
+	screenCmd.AddCommand(screenCropCmd)
+
+	screenCmd.PersistentFlags().StringVar(&screenRows, "rows", "", "row range in cells (START:END)")
+	screenCmd.PersistentFlags().StringVar(&screenCols, "cols", "", "column range in cells (START:END)")
+	screenCmd.PersistentFlags().StringVar(&screenZone, "zone", "", "named region from the zones file (instead of --rows/--cols)")
+	screenCmd.PersistentFlags().StringVar(&screenCellSize, "cell-size", "", "character cell size in pixels (default 8x16)")
+	screenCompareCmd.Flags().StringVar(&screenTolerance, "tolerance", "0%", "maximum fraction of differing pixels (e.g. 2%)")
+	screenCompareCmd.Flags().IntVar(&screenThreshold, "threshold", 16, "per-channel difference (0-255) above which a pixel counts as different")
+
+	// Bind flags to viper
+	viper.BindPFlag("screen.cell_size", screenCmd.PersistentFlags().Lookup("cell-size"))
+}
@@ -2,12 +2,15 @@ package cmd
 
 import (
 	"fmt"
+	"image"
+	"image/draw"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/jstein/qmp/internal/logging"
-	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/screen"
+	"github.com/jstein/qmp/internal/vnc"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -15,6 +18,9 @@ import (
 var (
 	screenshotFormat string
 	remoteTempPath   string
+	captureBackend   string
+	vncAddress       string
+	vncPassword      string
 )
 
 // screenshotCmd represents the screenshot command
@@ -28,6 +34,12 @@ Supported formats: ppm, png
 When using SSH tunneling with the --socket flag, you may need to specify
 a temporary path on the remote server using --remote-temp flag.
 
+The screen can be captured with QMP screendump (default) or by reading the
+framebuffer over VNC with --capture-backend vnc. The VNC backend does not
+need a temporary file or ImageMagick for PNG output. By default it connects
+to the Proxmox VNC socket (/var/run/qemu-server/<vmid>.vnc); use
+--vnc-address to connect to "host:port" or "unix:/path" instead.
+
 Examples:
   # Take a screenshot and save it as PNG
   qmp screenshot 106 screenshot.png
@@ -36,7 +48,10 @@ Examples:
   qmp screenshot 106 screenshot.ppm --format ppm
 
   # Take a screenshot with SSH tunneling
-  qmp screenshot 106 screenshot.png --socket /tmp/qmp-106.sock --remote-temp /tmp/qmp-screenshot.ppm`,
+  qmp screenshot 106 screenshot.png --socket /tmp/qmp-106.sock --remote-temp /tmp/qmp-screenshot.ppm
+
+  # Take a screenshot over VNC
+  qmp screenshot 106 screenshot.png --capture-backend vnc --vnc-address localhost:5906`,
 	Args: cobra.MinimumNArgs(2),
 	Run: func(cmd *cobra.Command, args []string) {
 		vmid := args[0]
@@ -46,26 +61,28 @@ Examples:
 		outputDir := filepath.Dir(outputFile)
 		if outputDir != "." {
 			if err := os.MkdirAll(outputDir, 0755); err != nil {
-				fmt.Printf("Error creating output directory: %v\n", err)
-				os.Exit(1)
+				exitWithError("Error creating output directory: %v", err)
 			}
 		}
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
+		// Get format from flag, config, or file extension
+		format := getScreenshotFormat(outputFile)
+
+		if getCaptureBackend() == "vnc" {
+			if err := captureVNCScreenshot(vmid, outputFile, format); err != nil {
+				exitWithError("Error taking screenshot: %v", err)
+			}
+			printScreenshotResult(vmid, outputFile, format)
+			return
 		}
 
+		client := newQMPClient(vmid)
+
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
-
-		// Get format from flag, config, or file extension
-		format := getScreenshotFormat(outputFile)
+		attachRecorder(client)
 
 		// Get remote temp path from flag or config
 		remotePath := getRemoteTempPath()
@@ -80,11 +97,10 @@ Examples:
 		}
 
 		if err != nil {
-			fmt.Printf("Error taking screenshot: %v\n", err)
-			os.Exit(1)
+			exitWithError("Error taking screenshot: %v", err)
 		}
 
-		fmt.Printf("Screenshot saved to %s\n", outputFile)
+		printScreenshotResult(vmid, outputFile, format)
 	},
 }
 
@@ -110,6 +126,118 @@ func getScreenshotFormat(outputFile string) string {
 	return "ppm"
 }
 
+// printScreenshotResult reports where a screenshot was saved
+func printScreenshotResult(vmid string, outputFile string, format string) {
+	if isJSONOutput() {
+		printJSON(map[string]interface{}{
+			"vmid":   vmid,
+			"file":   outputFile,
+			"format": format,
+		})
+		return
+	}
+
+	fmt.Printf("Screenshot saved to %s\n", outputFile)
+}
+
+// captureVNCScreenshot captures the screen over VNC and writes it to outputFile
+func captureVNCScreenshot(vmid string, outputFile string, format string) error {
+	address := getVNCAddress(vmid)
+	logging.Debug("Taking screenshot over VNC", "address", address, "output", outputFile, "format", format)
+
+	client := vnc.New(address, getVNCPassword())
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	defer client.Close()
+
+	img, err := client.Capture()
+	if err != nil {
+		return err
+	}
+
+	if err := screen.SaveImage(img, outputFile, format); err != nil {
+		return err
+	}
+
+	if recorder := getRecorder(); recorder != nil {
+		recorder.RecordScreenshot(vmid, outputFile)
+	}
+	return nil
+}
+
+// newVNCCapture returns a capture function that reads the screen over VNC.
+// The connection is opened on first use and again after a failure. Each
+// call returns a copy, as the client updates its framebuffer in place.
+func newVNCCapture(vmid string) func() (image.Image, error) {
+	address := getVNCAddress(vmid)
+	var client *vnc.Client
+
+	return func() (image.Image, error) {
+		if client == nil {
+			logging.Debug("Capturing screen over VNC", "address", address)
+			client = vnc.New(address, getVNCPassword())
+			if err := client.Connect(); err != nil {
+				client = nil
+				return nil, err
+			}
+		}
+
+		img, err := client.Capture()
+		if err != nil {
+			client.Close()
+			client = nil
+			return nil, err
+		}
+		frame := image.NewRGBA(img.Bounds())
+		draw.Draw(frame, frame.Bounds(), img, img.Bounds().Min, draw.Src)
+		return frame, nil
+	}
+}
+
+// getCaptureBackend determines the capture backend to use based on flag or config
+func getCaptureBackend() string {
+	// Priority 1: Command line flag
+	if captureBackend != "" {
+		return strings.ToLower(captureBackend)
+	}
+
+	// Priority 2: Config file
+	if viper.IsSet("screenshot.capture_backend") {
+		return strings.ToLower(viper.GetString("screenshot.capture_backend"))
+	}
+
+	// Default to QMP screendump
+	return "qmp"
+}
+
+// getVNCAddress determines the VNC address to use based on flag or config
+func getVNCAddress(vmid string) string {
+	// Priority 1: Command line flag
+	if vncAddress != "" {
+		return vncAddress
+	}
+
+	// Priority 2: Config file
+	if viper.IsSet("vnc.address") {
+		return viper.GetString("vnc.address")
+	}
+
+	// Default to the Proxmox VNC socket
+	return vnc.DefaultAddress(vmid)
+}
+
+// getVNCPassword determines the VNC password to use based on flag or config
+func getVNCPassword() string {
+	// Priority 1: Command line flag
+	if vncPassword != "" {
+		return vncPassword
+	}
+
+	// Priority 2: Config file
+	return viper.GetString("vnc.password")
+}
+
 // getRemoteTempPath determines the remote temp path to use based on flag or config
 func getRemoteTempPath() string {
 	// Priority 1: Command line flag
@@ -130,8 +258,14 @@ func init() {
 	rootCmd.AddCommand(screenshotCmd)
 	screenshotCmd.Flags().StringVarP(&screenshotFormat, "format", "f", "", "screenshot format (ppm, png)")
 	screenshotCmd.Flags().StringVarP(&remoteTempPath, "remote-temp", "r", "", "temporary path on remote server (for SSH tunneling)")
+	screenshotCmd.Flags().StringVar(&captureBackend, "capture-backend", "", "capture backend (qmp, vnc)")
+	screenshotCmd.Flags().StringVar(&vncAddress, "vnc-address", "", "VNC address for the vnc backend (host:port or unix:/path)")
+	screenshotCmd.Flags().StringVar(&vncPassword, "vnc-password", "", "VNC password for the vnc backend")
 
 	// Bind flags to viper
 	viper.BindPFlag("screenshot.format", screenshotCmd.Flags().Lookup("format"))
 	viper.BindPFlag("screenshot.remote_temp_path", screenshotCmd.Flags().Lookup("remote-temp"))
+	viper.BindPFlag("screenshot.capture_backend", screenshotCmd.Flags().Lookup("capture-backend"))
+	viper.BindPFlag("vnc.address", screenshotCmd.Flags().Lookup("vnc-address"))
+	viper.BindPFlag("vnc.password", screenshotCmd.Flags().Lookup("vnc-password"))
 }
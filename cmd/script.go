@@ -1,32 +1,229 @@
 package cmd
 
 import (
-	"bufio"
+	"bytes"
+	"context"
 	"fmt"
 	"os"
-	"strings"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 	"time"
 
+	"github.com/jstein/qmp/internal/ga"
 	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/metrics"
+	"github.com/jstein/qmp/internal/notify"
 	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/report"
+	"github.com/jstein/qmp/internal/script"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var (
-	scriptDelay time.Duration
+	scriptDelay          time.Duration
+	scriptAutoStart      bool
+	scriptCheckpointFile string
+	scriptResume         string
+	scriptDryRun         bool
+	scriptSecretsFile    string
+	scriptMetricsListen  string
+	scriptValuesFile     string
+	scriptReport         string
+	scriptReportFormat   string
+	scriptLineBudget     time.Duration
+	scriptTimings        bool
+	scriptFailureDir     string
+	scriptNoFailureShots bool
 )
 
+// defaultFailureDir is where failure screenshots are saved unless configured
+const defaultFailureDir = "qmp-failures"
+
 // scriptCmd represents the script command
 var scriptCmd = &cobra.Command{
 	Use:   "script [vmid] [file]",
 	Short: "Run a script of commands",
 	Long: `Run a script of commands on the VM.
 Each line in the script file is treated as a separate command to be executed.
-Empty lines and lines starting with # are ignored.
+Empty lines and lines starting with # are ignored. A line ending in a
+backslash continues on the next line, so long directives can be split up;
+errors are reported against the first line.
 
 Special commands can be included using <command> syntax:
-  <sleep N>    - Sleep for N seconds
+  <sleep N>                  - Sleep for N seconds
+  <mouse-move X Y>           - Move the mouse pointer to X,Y
+  <mouse-move-rel DX DY>     - Move the mouse pointer by DX,DY
+  <mouse-click X Y [button]> - Click a mouse button at X,Y (default left)
+  <mouse-scroll N>           - Scroll the mouse wheel N steps (negative scrolls up)
+  <key NAME>                 - Press a key or combination (e.g. esc, f2, ctrl+c, ctrl+alt+delete)
+  <hold KEY DURATION>        - Hold a key or combination down (e.g. <hold ctrl 2s>)
+  <key-down KEY>             - Press and keep holding a key until <key-up KEY>
+  <key-up KEY>               - Release a key pressed with <key-down KEY>
+  <keys "SEQUENCE">          - Send comma separated keys and waits (e.g. "ctrl+alt+del, wait 500ms, enter")
+  <qmp 'JSON'>               - Send a raw QMP command (e.g. <qmp '{"execute":"system_reset"}'>)
+  <notify "MESSAGE" [level=warn]>
+                             - Send a notification to the configured providers
+  <raw-keys CODES [press=D]> - Send hex scancodes with explicit press/release (e.g. 1d 38 e0 53)
+  <type "TEXT">              - Type TEXT without pressing Enter
+  <keymap NAME>              - Switch the guest keyboard layout (us, uk, de, fr, dvorak)
+  <timing PROFILE>           - Switch key timing (bios, grub, installer, os)
+  <checkpoint "NAME">        - Mark a safe point to resume from
+  <guest-exec "COMMAND">     - Run COMMAND through the guest agent (typed on the console if unavailable)
+  <eject [DEVICE]>           - Eject the medium from DEVICE (default: the CD-ROM drive)
+  <insert-iso "PATH" [DEV]>  - Insert an ISO image into DEV (default: the CD-ROM drive)
+  <connect-ssh HOST [user=USER] [key=PATH] [port=PORT]>
+                             - Run the following lines over SSH (with real exit codes)
+  <disconnect-ssh>           - Go back to typing lines on the console
+  <paste-file "FILE" [rate=200cps] [chunk=64] [pause=250ms]>
+                             - Type the contents of FILE in chunks
+  <wait-stable QUIET [timeout=120s] [interval=1s]>
+                             - Wait until the screen has not changed for QUIET (e.g. 5s)
+  <wait-for-boot [timeout=300s] [quiet=10s]>
+                             - Wait until the VM runs and the guest agent responds or the
+                               screen has not changed for the quiet period
+  <wait-net HOST [port=22] [timeout=300s]>
+                             - Wait until a TCP port on the guest is reachable from this host
+  <wait-until "HH:MM">       - Pause until the next occurrence of a local time (or an
+                               RFC 3339 timestamp)
+  <snapshot-save "NAME">     - Save an internal VM snapshot (RAM and qcow2 disks)
+  <snapshot-restore "NAME">  - Roll the VM back to a snapshot
+  <assert-region ROWS COLS REF [tolerance=N%]>
+                             - Compare a screen region (in character cells, e.g. 10:20 5:40)
+                               against the reference image REF; stops the script on mismatch.
+                               zone=NAME can replace ROWS COLS (see --zones)
+Screen polling (wait-stable, wait-for-boot, assert-region) uses QMP
+screendump; --capture-backend vnc reads incremental VNC updates instead.
+
+Time built-ins are replaced in every line when it runs:
+  $NOW                       - Current time in RFC 3339 format
+  $DATE                      - Current date (YYYY-MM-DD)
+  ${time:+FORMAT}            - Current time in a date(1) style format (e.g. ${time:+%H%M%S})
+  $ELAPSED                   - Seconds since the script started
+  $LINE_ELAPSED              - Seconds the previous line took
+
+Loops repeat a block with a counter or over a list:
+  <loop NAME from A to B [step S]> ... <end-loop>
+                             - Run the block for NAME = A..B (counting down
+                               when A > B); $NAME and ${NAME} are replaced
+                               inside the block
+  <for NAME in ITEM... | $LIST> ... <end-for>
+                             - Run the block once per item; $NAME is the item
+                               and $NAME_INDEX its index (from 0)
+  NAME=(ITEM ITEM "ITEM")    - Define a list for <for> loops (the line is not typed)
+  <break>                    - Leave the innermost loop
+  <continue>                 - Skip to the next iteration of the innermost loop
+Checkpoints inside a loop resume from the start of the outermost loop.
+
+Try blocks handle failing lines without failing the script:
+  <try> ... [<catch> ...] [<finally> ...] <end-try>
+                             - A failure in the try section skips to <catch>,
+                               where $ERROR_LINE and $ERROR_MESSAGE describe it
+                               and it no longer counts as a script failure.
+                               <finally> always runs afterwards. A failure that
+                               is not caught (no <catch>, or raised in <catch>)
+                               goes to the enclosing try block, or counts
+                               after <finally> has run
+Failed assertions are caught too. Checkpoints inside a try block resume
+from its start; <break> and <continue> skip <finally>.
+
+Macros define reusable blocks that are expanded before the script runs:
+  <macro NAME [PARAM[=DEFAULT]]...> ... <end-macro>
+                             - Define macro NAME; $PARAM and ${PARAM} are
+                               replaced in its lines
+  <NAME [PARAM=VALUE]...>    - Insert the lines of macro NAME
+Use --dry-run to print the script with all macros expanded:
+
+  <macro login user password=secret>
+  $user
+  <sleep 1>
+  $password
+  <end-macro>
+  <login user=root>
+
+Handler blocks run when the script ends and are skipped in the normal flow:
+  <on-error> ... <end>       - Runs if any line failed; $ERROR_LINE and
+                               $ERROR_MESSAGE describe the last failure
+  <on-exit> ... <end>        - Always runs last, even after Ctrl+C (e.g. to
+                               take a final screenshot or power the VM down)
+
+Logic that outgrows the directives can be written in Lua:
+  <script lua> ... <end-script>
+                             - Run the Lua code between the markers
+  <script lua "FILE">        - Run the Lua code in FILE
+Lua code can call sendText(text), sendLine(text), sendKeys(keys),
+sleep(seconds), run(line) (any script line or directive), log(message) and
+getenv(name), which only reads variables listed in script.lua_env. Only
+Lua's base, table, string and math libraries are available (no io, os,
+dofile or require). Globals persist between blocks of the same run:
+
+  <script lua>
+  for i = 1, 3 do
+    sendLine("echo attempt " .. i)
+    run("<wait-stable 2s>")
+  end
+  <end-script>
+
+Progress is written to a checkpoint file with --checkpoint-file. A failed
+or interrupted run can be continued with --resume CHECKPOINT, which skips
+to the last <checkpoint> reached (or the last completed line if the script
+has no checkpoints) and keeps updating the same file. Ctrl+C stops the
+script once the running line finishes, saves the checkpoint and prints a
+summary with the interrupted line.
+
+With --values FILE the script is first rendered as a Go template using the
+values from the YAML file, so one script can provision differently
+configured VMs:
+
+  {{ .Hostname }}
+  {{ range .Disks }}mkfs.ext4 /dev/{{ . }}
+  {{ end }}
+
+Secrets can be referenced as ${secret:NAME}. Values are read from the YAML
+file given with --secrets-file (NAME: value pairs), falling back to the
+environment variable NAME. Secret values are masked in log output, error
+messages and session recordings.
+
+Use --report FILE to write a JUnit XML (default) or TAP report with one
+test case per executed line, for CI test dashboards. The format is taken
+from --report-format or the file extension (.tap for TAP).
+
+When a line fails, a PNG screenshot of the screen is saved to the
+qmp-failures directory (--failure-dir or script.failure_dir) and its path is
+included in the JSON result, so unattended failures can be examined without
+re-running the script. Disable this with --no-failure-screenshots or
+script.failure_screenshots: false.
+
+With --fail-on-paused (or keyboard.fail_on_paused: true) the VM status is
+checked after every line that sends keys. QEMU silently drops key presses
+for a paused VM, so the script stops with an explanation instead of failing
+later on a screen that never changed.
+
+Use --metrics-listen ADDR to expose Prometheus metrics on ADDR/metrics
+while the script runs.
+
+Use --auto-start to start a stopped VM through the Proxmox API (see
+'qmp vm') before the script connects.
+
+When notification providers are configured, a notification is sent when the
+script completes, fails or is interrupted. With wait_milestone set, one is
+also sent each time wait-stable, wait-for-boot, wait-net or wait-until has
+been waiting for another interval:
+
+  notify:
+    level: info            # minimum level sent (info, warn, error)
+    wait_milestone: 30m    # report long waits every 30 minutes
+    slack:
+      webhook_url: https://hooks.slack.com/services/...
+    discord:
+      webhook_url: https://discord.com/api/webhooks/...
+    email:
+      smtp: smtp.example.com:587
+      username: qmp
+      password: secret
+      from: qmp@example.com
+      to: [ops@example.com]
 
 Example:
   qmp script 106 /path/to/script.txt`,
@@ -35,118 +232,389 @@ Example:
 		vmid := args[0]
 		scriptFile := args[1]
 
-		// Open the script file
-		file, err := os.Open(scriptFile)
-		if err != nil {
-			fmt.Printf("Error opening script file: %v\n", err)
-			os.Exit(1)
-		}
-		defer file.Close()
+		source := loadScriptSource(scriptFile)
 
-		// Connect to the VM
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
+		if scriptDryRun {
+			printExpandedScript(source)
+			return
 		}
 
-		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+		if addr := getScriptMetricsListen(); addr != "" {
+			metrics.Serve(addr)
 		}
-		defer client.Close()
 
-		// Get the key delay from flag or config
-		delay := getScriptDelay()
-		logging.Debug("Using key delay for script", "delay", delay)
+		// Start the VM through the Proxmox API if requested
+		if scriptAutoStart || viper.GetBool("script.auto_start") {
+			if err := ensureVMRunning(vmid); err != nil {
+				exitWithError("Error starting VM %s: %v", vmid, err)
+			}
+		}
 
-		// Process the script line by line
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
-		for scanner.Scan() {
-			lineNum++
-			line := strings.TrimSpace(scanner.Text())
+		// Connect to the VM
+		client := newQMPClient(vmid)
 
-			// Skip empty lines and comments
-			if line == "" || strings.HasPrefix(line, "#") {
-				continue
-			}
+		configureKeyboard(client)
+		attachRecorder(client)
 
-			// Check for special commands enclosed in <>
-			if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
-				command := line[1 : len(line)-1] // Remove < and >
-				parts := strings.Fields(command)
-				if len(parts) > 0 {
-					switch parts[0] {
-					case "sleep":
-						if len(parts) != 2 {
-							fmt.Printf("Line %d: Invalid sleep command format. Use <sleep N>\n", lineNum)
-							continue
-						}
-						var seconds float64
-						_, err := fmt.Sscanf(parts[1], "%f", &seconds)
-						if err != nil {
-							fmt.Printf("Line %d: Invalid sleep duration: %v\n", lineNum, err)
-							continue
-						}
-						sleepDuration := time.Duration(seconds * float64(time.Second))
-						logging.Debug("Sleeping", "duration", sleepDuration)
-						time.Sleep(sleepDuration)
-					default:
-						fmt.Printf("Line %d: Unknown special command: %s\n", lineNum, parts[0])
-					}
-					continue
+		// Use a managed connection so that socket hiccups during long
+		// scripts pause execution and reconnect instead of failing lines
+		conn := newConnectionManager(client)
+		conn.OnEvent(func(event qmp.ConnectionEvent) {
+			switch event.State {
+			case qmp.StateDisconnected:
+				logging.Warn("Connection lost, pausing script", "vmid", vmid)
+			case qmp.StateConnected:
+				if event.Attempt > 0 {
+					logging.Info("Reconnected, resuming script", "vmid", vmid)
 				}
+			case qmp.StateFailed:
+				logging.Error("Unable to reconnect", "vmid", vmid)
 			}
+		})
+
+		if err := conn.Connect(); err != nil {
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
+		}
+		defer conn.Close()
 
-			// Regular line - send as keyboard input
-			logging.Info("Executing line", "line", line)
-			if err := client.SendString(line, delay); err != nil {
-				fmt.Printf("Line %d: Error sending text: %v\n", lineNum, err)
-				continue
+		executor := newScriptExecutor(vmid, conn)
+		defer executor.Close()
+		executor.FailureDir = getScriptFailureDir()
+
+		// Set up checkpointing and resume
+		executor.Checkpoint = &script.Checkpoint{Script: scriptFile, VMID: vmid}
+		executor.CheckpointFile = scriptCheckpointFile
+		if scriptResume != "" {
+			checkpoint, err := script.LoadCheckpoint(scriptResume)
+			if err != nil {
+				exitWithError("Error loading checkpoint: %v", err)
+			}
+			if checkpoint.Script != scriptFile {
+				logging.Warn("Checkpoint was written for a different script", "checkpoint", checkpoint.Script, "script", scriptFile)
 			}
+			executor.Checkpoint = checkpoint
+			executor.Checkpoint.Script, executor.Checkpoint.VMID = scriptFile, vmid
+			executor.StartAfter, executor.StartAfterSub = checkpoint.ResumeLine()
+			if executor.CheckpointFile == "" {
+				executor.CheckpointFile = scriptResume
+			}
+			logging.Info("Resuming script", "after_line", executor.StartAfter, "after_sub", executor.StartAfterSub, "checkpoint", checkpoint.Name)
+		}
+		if isJSONOutput() {
+			executor.Output = os.Stderr
+		}
+
+		// Ctrl+C stops the script after the running line and saves the checkpoint
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		result, err := executor.RunContext(ctx, bytes.NewReader(source))
+		stop()
+		if err != nil {
+			exitWithError("%v", err)
+		}
+
+		notifyScriptResult(executor.Notifier, vmid, scriptFile, result)
 
-			// Send Enter after each command
-			if err := client.SendKey("ret"); err != nil {
-				fmt.Printf("Line %d: Error sending return key: %v\n", lineNum, err)
-				continue
+		if scriptReport != "" {
+			format := scriptReportFormat
+			if format == "" {
+				format = report.FormatForFile(scriptReport)
 			}
+			if err := report.WriteFile(scriptReport, format, filepath.Base(scriptFile), result); err != nil {
+				exitWithError("Error writing report: %v", err)
+			}
+			logging.Info("Wrote script report", "file", scriptReport, "format", format)
+		}
 
-			// Small delay between commands
-			time.Sleep(100 * time.Millisecond)
+		if !isJSONOutput() && (scriptTimings || len(result.OverBudget()) > 0) {
+			printSlowestLines(result, executor.LineBudget)
 		}
 
-		if err := scanner.Err(); err != nil {
-			fmt.Printf("Error reading script file: %v\n", err)
-			os.Exit(1)
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":   vmid,
+				"script": scriptFile,
+				"result": result,
+			})
+		} else if result.Interrupted {
+			fmt.Printf("Script execution interrupted at line %d for VM %s (%d lines executed, %d errors)\n",
+				result.InterruptedLine, vmid, result.LinesExecuted, len(result.Errors))
+			if executor.CheckpointFile != "" {
+				fmt.Printf("Resume with --resume %s\n", executor.CheckpointFile)
+			}
+		} else if result.Aborted {
+			fmt.Printf("Script execution aborted for VM %s\n", vmid)
+		} else {
+			fmt.Printf("Script execution completed for VM %s\n", vmid)
 		}
 
-		fmt.Printf("Script execution completed for VM %s\n", vmid)
+		if result.Aborted || result.Interrupted {
+			executor.Close()
+			conn.Close()
+			if result.Interrupted {
+				os.Exit(130)
+			}
+			os.Exit(1)
+		}
 	},
 }
 
-// getScriptDelay determines the key delay to use based on flag or config
-func getScriptDelay() time.Duration {
+// getNotifier creates a notifier from the notify section of the config, or exits on failure
+func getNotifier() *notify.Notifier {
+	var cfg notify.Config
+	if err := viper.UnmarshalKey("notify", &cfg); err != nil {
+		exitWithError("Error reading notify configuration: %v", err)
+	}
+
+	notifier, err := notify.New(cfg)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return notifier
+}
+
+// notifyScriptResult sends a notification when a script finishes, fails or is interrupted
+func notifyScriptResult(notifier *notify.Notifier, vmid string, scriptFile string, result *script.Result) {
+	if !notifier.Enabled() {
+		return
+	}
+
+	msg := notify.Message{Level: notify.LevelInfo, Title: fmt.Sprintf("Script %s completed on VM %s", filepath.Base(scriptFile), vmid)}
+	switch {
+	case result.Interrupted:
+		msg.Level = notify.LevelWarn
+		msg.Title = fmt.Sprintf("Script %s interrupted on VM %s at line %d", filepath.Base(scriptFile), vmid, result.InterruptedLine)
+	case !result.Success:
+		msg.Level = notify.LevelError
+		msg.Title = fmt.Sprintf("Script %s failed on VM %s", filepath.Base(scriptFile), vmid)
+	}
+
+	msg.Text = fmt.Sprintf("%d lines executed, %d errors in %v", result.LinesExecuted, len(result.Errors), result.Duration.Truncate(time.Second))
+	if len(result.Errors) > 0 {
+		first := result.Errors[0]
+		msg.Text += fmt.Sprintf("\nFirst error on line %d: %s", first.Line, first.Message)
+	}
+	notifier.Notify(msg)
+}
+
+// printExpandedScript prints the lines a script would run, with macros
+// expanded, without connecting to the VM
+func printExpandedScript(source []byte) {
+	lines, err := script.Expand(bytes.NewReader(source))
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+
+	if isJSONOutput() {
+		printJSON(lines)
+		return
+	}
+
+	for _, line := range lines {
+		fmt.Printf("%4d  %s\n", line.Line, line.Text)
+	}
+}
+
+// loadScriptSource reads a script file, rendering it as a template if
+// values were given, or exits on failure
+func loadScriptSource(scriptFile string) []byte {
+	source, err := os.ReadFile(scriptFile)
+	if err != nil {
+		exitWithError("Error reading script file: %v", err)
+	}
+
+	if valuesFile := getScriptValuesFile(); valuesFile != "" {
+		values, err := script.LoadValues(valuesFile)
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+		if source, err = script.Render(filepath.Base(scriptFile), source, values); err != nil {
+			exitWithError("Error: %v", err)
+		}
+		logging.Debug("Rendered script template", "values", valuesFile)
+	}
+	return source
+}
+
+// slowestLineCount is the number of lines shown by printSlowestLines
+const slowestLineCount = 10
+
+// printSlowestLines prints the slowest script lines, marking those over budget
+func printSlowestLines(result *script.Result, budget time.Duration) {
+	fmt.Printf("Slowest lines:\n")
+	fmt.Printf("  %-6s %12s  %-16s %s\n", "LINE", "DURATION", "DIRECTIVE", "TEXT")
+	for _, step := range result.Slowest(slowestLineCount) {
+		marker := ""
+		if step.OverBudget {
+			marker = fmt.Sprintf("  (over %v budget)", budget)
+		}
+		fmt.Printf("  %-6d %12s  %-16s %s%s\n", step.Line, step.Duration.Truncate(time.Millisecond), step.Directive, logging.Mask(step.Text), marker)
+	}
+}
+
+// getScriptLineBudget determines the per-line time budget based on flag or config
+func getScriptLineBudget() time.Duration {
 	// Priority 1: Command line flag
-	if scriptDelay > 0 {
-		return scriptDelay
+	if scriptLineBudget > 0 {
+		return scriptLineBudget
+	}
+
+	// Priority 2: Config file (0 disables the budget)
+	return viper.GetDuration("script.line_budget")
+}
+
+// getScriptFailureDir determines where failure screenshots are saved based
+// on flags or config; "" disables them
+func getScriptFailureDir() string {
+	// Priority 1: Command line flags
+	if scriptNoFailureShots {
+		return ""
+	}
+	if scriptFailureDir != "" {
+		return scriptFailureDir
+	}
+
+	// Priority 2: Config file
+	if viper.IsSet("script.failure_screenshots") && !viper.GetBool("script.failure_screenshots") {
+		return ""
+	}
+	if dir := viper.GetString("script.failure_dir"); dir != "" {
+		return dir
+	}
+
+	return defaultFailureDir
+}
+
+// newScriptExecutor creates an executor configured from flags and config
+func newScriptExecutor(vmid string, conn *qmp.Manager) *script.Executor {
+	// Get the key delay from flag or config
+	delay := getScriptDelay()
+	logging.Debug("Using key delay for script", "delay", delay)
+
+	executor := script.NewExecutor(conn, delay)
+	profile := getTimingProfile()
+	executor.ChunkSize, executor.ChunkPause = profile.ChunkSize, profile.ChunkPause
+	executor.ScreenWidth, executor.ScreenHeight = getMouseScreenSize()
+	executor.VMID = vmid
+	executor.CDROMDevice = getCDROMDevice()
+	executor.CellWidth, executor.CellHeight = getCellSize()
+	executor.Zones = getZones()
+	executor.Notifier = getNotifier()
+	executor.WaitMilestone = viper.GetDuration("notify.wait_milestone")
+	executor.LuaEnv = viper.GetStringSlice("script.lua_env")
+	executor.Recorder = getRecorder()
+	executor.Secrets = getScriptSecrets()
+	executor.LineBudget = getScriptLineBudget()
+	executor.FailOnPaused = getFailOnPaused()
+	if getCaptureBackend() == "vnc" {
+		executor.Capture = newVNCCapture(vmid)
+	}
+	executor.GuestAgent = func() (*ga.Client, error) {
+		// Use a short timeout for the first contact so a guest without a
+		// running agent falls back to typing quickly
+		agent := newGuestAgent(vmid)
+		agent.Timeout = 3 * time.Second
+		if err := agent.Connect(); err != nil {
+			return nil, err
+		}
+		agent.Timeout = 10 * time.Second
+		return agent, nil
+	}
+
+	// Write the log of this run to its own file if requested
+	if path := getLogFile(); path != "" {
+		path = logging.ExpandLogPath(path, vmid, time.Now())
+		run, err := logging.OpenRunFile(path, viper.GetInt("log.keep"))
+		if err != nil {
+			exitWithError("Error: %v", err)
+		}
+		executor.LogFile = run
+		conn.SetLogger(run.Logger())
+		run.Logger().Debug("Writing log file", "path", path)
 	}
 
+	return executor
+}
+
+// getScriptSecrets loads the secrets file based on flag or config, or exits on failure
+func getScriptSecrets() *script.Secrets {
+	// Priority 1: Command line flag
 	// Priority 2: Config file
-	if viper.IsSet("keyboard.delay") {
-		// Use the same delay setting as keyboard by default
-		return time.Duration(viper.GetInt("keyboard.delay")) * time.Millisecond
+	filename := scriptSecretsFile
+	if filename == "" {
+		filename = viper.GetString("script.secrets_file")
+	}
+	if filename == "" {
+		return script.NewSecrets()
+	}
+
+	secrets, err := script.LoadSecrets(filename)
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	logging.Debug("Loaded secrets file", "file", filename)
+	return secrets
+}
+
+// getScriptValuesFile determines the template values file based on flag or config
+func getScriptValuesFile() string {
+	// Priority 1: Command line flag
+	if scriptValuesFile != "" {
+		return scriptValuesFile
+	}
+
+	// Priority 2: Config file (empty disables templating)
+	return viper.GetString("script.values_file")
+}
+
+// getScriptMetricsListen determines the metrics listen address based on flag or config
+func getScriptMetricsListen() string {
+	// Priority 1: Command line flag
+	if scriptMetricsListen != "" {
+		return scriptMetricsListen
+	}
+
+	// Priority 2: Config file (empty disables metrics)
+	return viper.GetString("script.metrics_listen")
+}
+
+// getScriptDelay determines the key delay to use based on flag, timing profile or config
+func getScriptDelay() time.Duration {
+	// Priority 1: Command line flag
+	if scriptDelay > 0 {
+		return scriptDelay
 	}
 
-	// Default to 50ms
-	return 50 * time.Millisecond
+	// Use the same delay setting as keyboard by default
+	return profileKeyDelay()
 }
 
 func init() {
 	rootCmd.AddCommand(scriptCmd)
-	scriptCmd.Flags().DurationVarP(&scriptDelay, "delay", "l", 0, "delay between key presses (default 50ms)")
+	scriptCmd.PersistentFlags().DurationVarP(&scriptDelay, "delay", "l", 0, "delay between key presses (default 50ms)")
+	scriptCmd.PersistentFlags().StringVar(&scriptSecretsFile, "secrets-file", "", "YAML file with values for ${secret:NAME} references")
+	scriptCmd.Flags().StringVar(&scriptReport, "report", "", "write a test report for the run to this file")
+	scriptCmd.Flags().StringVar(&scriptReportFormat, "report-format", "", "report format (junit, tap; default from the file extension)")
+	scriptCmd.PersistentFlags().StringVar(&scriptValuesFile, "values", "", "YAML file of values used to render the script as a Go template")
+	scriptCmd.Flags().StringVar(&scriptMetricsListen, "metrics-listen", "", "serve Prometheus metrics on this address while the script runs (e.g. :9101)")
+	scriptCmd.Flags().DurationVar(&scriptLineBudget, "line-budget", 0, "warn about lines that take longer than this (e.g. 30s)")
+	scriptCmd.Flags().BoolVar(&scriptTimings, "timings", false, "print the slowest lines after the run")
+	scriptCmd.Flags().StringVar(&scriptCheckpointFile, "checkpoint-file", "", "write progress to this checkpoint file")
+	scriptCmd.Flags().StringVar(&scriptResume, "resume", "", "resume from a checkpoint file")
+	scriptCmd.Flags().BoolVar(&scriptDryRun, "dry-run", false, "print the script with macros expanded instead of running it")
+	scriptCmd.Flags().StringVar(&scriptFailureDir, "failure-dir", "", "save a screenshot of every failed line to this directory (default qmp-failures)")
+	scriptCmd.Flags().BoolVar(&scriptNoFailureShots, "no-failure-screenshots", false, "do not save screenshots of failed lines")
+	scriptCmd.PersistentFlags().StringVar(&captureBackend, "capture-backend", "", "capture backend for screen polling (qmp, vnc)")
+	scriptCmd.PersistentFlags().StringVar(&vncAddress, "vnc-address", "", "VNC address for the vnc backend (host:port or unix:/path)")
+	scriptCmd.PersistentFlags().StringVar(&vncPassword, "vnc-password", "", "VNC password for the vnc backend")
+	scriptCmd.Flags().BoolVar(&scriptAutoStart, "auto-start", false, "start the VM through the Proxmox API if it is not running")
 
 	// Bind flags to viper
-	viper.BindPFlag("script.delay", scriptCmd.Flags().Lookup("delay"))
+	viper.BindPFlag("script.delay", scriptCmd.PersistentFlags().Lookup("delay"))
+	viper.BindPFlag("script.values_file", scriptCmd.PersistentFlags().Lookup("values"))
+	viper.BindPFlag("script.metrics_listen", scriptCmd.Flags().Lookup("metrics-listen"))
+	viper.BindPFlag("script.line_budget", scriptCmd.Flags().Lookup("line-budget"))
+	viper.BindPFlag("script.failure_dir", scriptCmd.Flags().Lookup("failure-dir"))
+	viper.BindPFlag("script.secrets_file", scriptCmd.PersistentFlags().Lookup("secrets-file"))
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/server"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	serveListen     string
+	serveToken      string
+	serveScriptsDir string
+)
+
+// serveCmd represents the serve command
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Run an HTTP API server",
+	Long: `Run an HTTP API server exposing VM control to other tools.
+
+Endpoints:
+  GET  /vms/{id}/status   - Query VM status
+  POST /vms/{id}/keys     - Send key presses: {"keys": ["esc", "ret"], "delay_ms": 50}
+  POST /vms/{id}/text     - Type text: {"text": "root\n", "delay_ms": 50}
+  GET  /vms/{id}/ocr      - Not supported in this build (returns 501)
+  POST /scripts/run       - Start a script: {"vmid": "106", "script": "..."} or {"vmid": "106", "file": "install.txt"}
+  GET  /jobs              - List script jobs
+  GET  /jobs/{id}         - Poll a script job
+  GET  /metrics           - Prometheus metrics (QMP latency, script lines and failures)
+
+Requests for a VM that is running a script job return 409 Conflict until the
+job finishes.
+
+With --token (or serve.token, or the QMP_SERVE_TOKEN environment variable)
+every request must send "Authorization: Bearer TOKEN". A token is required
+to listen on anything other than a loopback address.
+
+Script files given as "file" are read from --scripts-dir (serve.scripts_dir)
+and must be relative paths inside it; without it only inline scripts are
+accepted.
+
+Scripts run restricted: <qmp>, <insert-iso> and <connect-ssh> are rejected,
+files named by <paste-file>, <assert-region> and <script lua "FILE"> are
+read from the scripts directory, and ${secret:NAME} does not fall back to
+the server's environment.
+
+Example:
+  qmp serve
+  QMP_SERVE_TOKEN=secret qmp serve --listen :8080 --scripts-dir /srv/qmp-scripts`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		layout, unicodeMode := getKeymap(), getUnicodeMode()
+		srv := server.New(func(vmid string) *qmp.Client {
+			client := newQMPClient(vmid)
+			client.SetKeymap(layout)
+			client.SetUnicodeMode(unicodeMode)
+			attachRecorder(client)
+			return client
+		})
+		srv.Delay = getKeyDelay()
+		srv.ScreenWidth, srv.ScreenHeight = getMouseScreenSize()
+		srv.Token = getServeToken()
+		srv.ScriptsDir = firstSetting(serveScriptsDir, viper.GetString("serve.scripts_dir"))
+		srv.LogFile, srv.LogKeep = getLogFile(), viper.GetInt("log.keep")
+
+		if err := srv.ListenAndServe(getServeListen()); err != nil {
+			exitWithError("Error running server: %v", err)
+		}
+	},
+}
+
+// getServeListen determines the listen address based on flag or config
+func getServeListen() string {
+	// Priority 1: Command line flag
+	if serveListen != "" {
+		return serveListen
+	}
+
+	// Priority 2: Config file
+	if viper.IsSet("serve.listen") {
+		return viper.GetString("serve.listen")
+	}
+
+	// Default to localhost only
+	return "127.0.0.1:8080"
+}
+
+// getServeToken determines the API token based on flag, config or environment
+func getServeToken() string {
+	// Priority 1: Command line flag
+	if serveToken != "" {
+		return serveToken
+	}
+
+	// Priority 2: Config file
+	if token := viper.GetString("serve.token"); token != "" {
+		return token
+	}
+
+	// Priority 3: Environment, which keeps the token out of the process list
+	return os.Getenv("QMP_SERVE_TOKEN")
+}
+
+func init() {
+	rootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringVar(&serveListen, "listen", "", "address to listen on (default 127.0.0.1:8080)")
+	serveCmd.Flags().StringVar(&serveToken, "token", "", "require this bearer token on every request (required for non-loopback addresses)")
+	serveCmd.Flags().StringVar(&serveScriptsDir, "scripts-dir", "", "directory script files are read from")
+
+	// Bind flags to viper
+	viper.BindPFlag("serve.listen", serveCmd.Flags().Lookup("listen"))
+	viper.BindPFlag("serve.scripts_dir", serveCmd.Flags().Lookup("scripts-dir"))
+}
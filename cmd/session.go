@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/recording"
+	"github.com/jstein/qmp/internal/screen"
+	"github.com/spf13/cobra"
+)
+
+var (
+	renderFormat string
+	renderSpeed  string
+	renderOutput string
+	renderPlain  bool
+)
+
+// sessionCmd represents the session command
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Work with recorded sessions",
+	Long: `Work with sessions recorded with --record.
+
+Use 'qmp replay' to step through a session interactively.`,
+}
+
+// sessionRenderCmd represents the session render command
+var sessionRenderCmd = &cobra.Command{
+	Use:   "render [session-dir]",
+	Short: "Render a recorded session as an animation",
+	Long: `Turn the screenshots of a recorded session into an animated GIF or MP4.
+
+Each screenshot is shown for as long as it was on screen during the session,
+divided by --speed, with the keys, text and script lines sent since the
+previous screenshot as a caption below it.
+
+GIFs are encoded without external tools. MP4 output requires ffmpeg in PATH.
+The format defaults to the extension of --out.
+
+Examples:
+  qmp session render ./sessions/install-106
+  qmp session render ./sessions/install-106 --speed 4x --out install.gif
+  qmp session render ./sessions/install-106 --format mp4 --out install.mp4`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir := args[0]
+
+		speed, err := parseSpeed(renderSpeed)
+		if err != nil {
+			exitWithError("Invalid speed '%s': %v", renderSpeed, err)
+		}
+
+		output := renderOutput
+		if output == "" {
+			format := renderFormat
+			if format == "" {
+				format = "gif"
+			}
+			output = filepath.Clean(dir) + "." + format
+		}
+
+		format := strings.ToLower(renderFormat)
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+		}
+		if format != "gif" && format != "mp4" {
+			exitWithError("Unsupported format '%s' (use gif or mp4)", format)
+		}
+
+		events, err := recording.Load(dir)
+		if err != nil {
+			exitWithError("Error loading session: %v", err)
+		}
+
+		frames := recording.Frames(dir, events)
+		if len(frames) == 0 {
+			exitWithError("Error: session %s contains no screenshots", dir)
+		}
+
+		images, delays, err := renderFrames(frames, speed, !renderPlain)
+		if err != nil {
+			exitWithError("Error rendering session: %v", err)
+		}
+
+		if format == "mp4" {
+			err = saveMP4(images, delays, output)
+		} else {
+			err = screen.SaveGIFWithDelays(images, delays, output)
+		}
+		if err != nil {
+			exitWithError("Error writing %s: %v", output, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"session": dir,
+				"output":  output,
+				"format":  format,
+				"frames":  len(images),
+			})
+			return
+		}
+
+		fmt.Printf("Rendered %d frames to %s\n", len(images), output)
+	},
+}
+
+// parseSpeed parses a playback speed such as 4x or 0.5
+func parseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "x"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if speed <= 0 {
+		return 0, fmt.Errorf("speed must be positive")
+	}
+	return speed, nil
+}
+
+// renderFrames loads, captions and pads the screenshots of a session
+func renderFrames(frames []recording.Frame, speed float64, captions bool) ([]image.Image, []time.Duration, error) {
+	images := make([]image.Image, 0, len(frames))
+	delays := make([]time.Duration, 0, len(frames))
+	width, height := 0, 0
+
+	for _, frame := range frames {
+		img, err := screen.LoadImage(frame.Image)
+		if err != nil {
+			return nil, nil, err
+		}
+		if captions {
+			img = screen.Caption(img, frame.Caption)
+		}
+
+		bounds := img.Bounds()
+		width = max(width, bounds.Dx())
+		height = max(height, bounds.Dy())
+		images = append(images, img)
+		delays = append(delays, time.Duration(float64(frame.Duration)/speed))
+	}
+
+	// The guest may change resolution during a session
+	for i, img := range images {
+		images[i] = screen.PadToSize(img, width, height)
+	}
+	return images, delays, nil
+}
+
+// saveMP4 encodes frames as an H.264 MP4 with ffmpeg
+func saveMP4(images []image.Image, delays []time.Duration, output string) error {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return fmt.Errorf("ffmpeg not found in PATH (use --format gif instead)")
+	}
+
+	tmpDir, err := os.MkdirTemp("", "qmp-render-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// The concat demuxer takes a per-file duration; the last file is
+	// listed twice so its duration is honoured
+	var list strings.Builder
+	var last string
+	for i, img := range images {
+		name := filepath.Join(tmpDir, fmt.Sprintf("frame-%05d.png", i))
+		if err := writePNG(name, img); err != nil {
+			return err
+		}
+		fmt.Fprintf(&list, "file '%s'\nduration %.3f\n", name, delays[i].Seconds())
+		last = name
+	}
+	fmt.Fprintf(&list, "file '%s'\n", last)
+
+	listFile := filepath.Join(tmpDir, "frames.txt")
+	if err := os.WriteFile(listFile, []byte(list.String()), 0644); err != nil {
+		return err
+	}
+
+	ffmpeg := exec.Command("ffmpeg", "-y", "-loglevel", "error",
+		"-f", "concat", "-safe", "0", "-i", listFile,
+		"-vf", "pad=ceil(iw/2)*2:ceil(ih/2)*2,format=yuv420p",
+		"-c:v", "libx264", output)
+	if out, err := ffmpeg.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// writePNG saves an image as a PNG file
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return png.Encode(file, img)
+}
+
+func init() {
+	rootCmd.AddCommand(sessionCmd)
+	sessionCmd.AddCommand(sessionRenderCmd)
+
+	sessionRenderCmd.Flags().StringVar(&renderFormat, "format", "", "output format: gif or mp4 (default from --out, else gif)")
+	sessionRenderCmd.Flags().StringVar(&renderSpeed, "speed", "1x", "playback speed, e.g. 4x")
+	sessionRenderCmd.Flags().StringVar(&renderOutput, "out", "", "output file (default <session-dir>.<format>)")
+	sessionRenderCmd.Flags().BoolVar(&renderPlain, "no-captions", false, "do not draw keystroke captions")
+}
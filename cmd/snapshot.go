@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage internal VM snapshots",
+	Long: `Save, restore and delete internal VM snapshots (savevm/loadvm). A
+snapshot includes the RAM and device state as well as all qcow2 disks, so
+restoring it rolls the VM back to exactly where it was.
+
+Internal snapshots require qcow2 disk images.`,
+}
+
+// snapshotSaveCmd represents the snapshot save command
+var snapshotSaveCmd = &cobra.Command{
+	Use:   "save [vmid] [name]",
+	Short: "Save a snapshot",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, name := args[0], args[1]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.SaveSnapshot(name); err != nil {
+			exitWithError("Error saving snapshot: %v", err)
+		}
+
+		printSnapshotResult(vmid, "save", name, fmt.Sprintf("Saved snapshot %s of VM %s", name, vmid))
+	},
+}
+
+// snapshotLoadCmd represents the snapshot load command
+var snapshotLoadCmd = &cobra.Command{
+	Use:   "load [vmid] [name]",
+	Short: "Restore a snapshot",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, name := args[0], args[1]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.LoadSnapshot(name); err != nil {
+			exitWithError("Error restoring snapshot: %v", err)
+		}
+
+		printSnapshotResult(vmid, "load", name, fmt.Sprintf("Restored snapshot %s of VM %s", name, vmid))
+	},
+}
+
+// snapshotDeleteCmd represents the snapshot delete command
+var snapshotDeleteCmd = &cobra.Command{
+	Use:   "delete [vmid] [name]",
+	Short: "Delete a snapshot",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid, name := args[0], args[1]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		if err := client.DeleteSnapshot(name); err != nil {
+			exitWithError("Error deleting snapshot: %v", err)
+		}
+
+		printSnapshotResult(vmid, "delete", name, fmt.Sprintf("Deleted snapshot %s of VM %s", name, vmid))
+	},
+}
+
+// snapshotListCmd represents the snapshot list command
+var snapshotListCmd = &cobra.Command{
+	Use:   "list [vmid]",
+	Short: "List snapshots",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		client := connectBlockClient(vmid)
+		defer client.Close()
+
+		snapshots, err := client.ListSnapshots()
+		if err != nil {
+			exitWithError("Error listing snapshots: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":      vmid,
+				"snapshots": snapshots,
+			})
+			return
+		}
+
+		if len(snapshots) == 0 {
+			fmt.Printf("No snapshots for VM %s\n", vmid)
+			return
+		}
+
+		fmt.Printf("Snapshots for VM %s:\n", vmid)
+		for _, snapshot := range snapshots {
+			fmt.Printf("  %-20s %s\n", snapshot.Tag, snapshot.Info)
+		}
+	},
+}
+
+// printSnapshotResult reports a completed snapshot operation
+func printSnapshotResult(vmid string, action string, name string, message string) {
+	if isJSONOutput() {
+		printJSON(map[string]interface{}{
+			"vmid":     vmid,
+			"action":   action,
+			"snapshot": name,
+			"message":  message,
+		})
+		return
+	}
+
+	fmt.Println(message)
+}
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotSaveCmd)
+	snapshotCmd.AddCommand(snapshotLoadCmd)
+	snapshotCmd.AddCommand(snapshotDeleteCmd)
+	snapshotCmd.AddCommand(snapshotListCmd)
+}
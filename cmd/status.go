@@ -2,9 +2,8 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/jstein/qmp/internal/qmp"
+	"github.com/fatih/color"
 	"github.com/spf13/cobra"
 )
 
@@ -12,33 +11,72 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status [vmid]",
 	Short: "Query VM status",
-	Long:  `Query the current status of a QEMU virtual machine using QMP.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Query the current status of a QEMU virtual machine using QMP.
+
+Besides the run state this reports the VCPU count, memory and balloon size,
+block devices with their media, NICs and the display resolution, so a VM
+can be sanity-checked before scripting against it.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		vmid := args[0]
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
-		}
+		client := newQMPClient(vmid)
 
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
 
 		status, err := client.QueryStatus()
 		if err != nil {
-			fmt.Printf("Error querying status for VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error querying status for VM %s: %v", vmid, err)
+		}
+
+		info, err := client.QueryInfo()
+		if err != nil {
+			exitWithError("Error querying VM %s: %v", vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":    vmid,
+				"running": status["running"],
+				"status":  status["status"],
+				"info":    info,
+				"raw":     status,
+			})
+			return
+		}
+
+		stateColor := color.New(color.FgRed).SprintFunc()
+		if info.Running {
+			stateColor = color.New(color.FgGreen).SprintFunc()
 		}
 
 		fmt.Printf("Status for VM %s:\n", vmid)
-		fmt.Printf("  Running: %v\n", status["running"])
-		fmt.Printf("  Status: %v\n", status["status"])
+		fmt.Printf("  Running: %s\n", stateColor(info.Running))
+		fmt.Printf("  Status:  %s\n", stateColor(info.Status))
+		fmt.Printf("  CPUs:    %d\n", info.CPUs)
+		fmt.Printf("  Memory:  %s", formatBytes(info.MemoryBytes))
+		if info.BalloonBytes > 0 {
+			fmt.Printf(" (balloon %s)", formatBytes(info.BalloonBytes))
+		}
+		fmt.Println()
+		if info.DisplayWidth > 0 {
+			fmt.Printf("  Display: %dx%d\n", info.DisplayWidth, info.DisplayHeight)
+		}
+		if len(info.BlockDevices) > 0 {
+			fmt.Printf("  Block devices:\n")
+			for _, dev := range info.BlockDevices {
+				fmt.Printf("    %-16s %s\n", dev.Device, describeMedium(dev))
+			}
+		}
+		if len(info.NICs) > 0 {
+			fmt.Printf("  NICs:\n")
+			for _, nic := range info.NICs {
+				fmt.Printf("    %-16s %s\n", nic.Name, nic.MAC)
+			}
+		}
 
 		if debug, _ := cmd.Flags().GetBool("debug"); debug {
 			fmt.Printf("Debug - Full status response: %+v\n", status)
@@ -46,6 +84,20 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+// formatBytes formats a byte count using binary units
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	// Here you will define your flags and configuration settings.
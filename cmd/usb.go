@@ -2,9 +2,7 @@ package cmd
 
 import (
 	"fmt"
-	"os"
 
-	"github.com/jstein/qmp/internal/qmp"
 	"github.com/spf13/cobra"
 )
 
@@ -22,23 +20,24 @@ var listUSBCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		vmid := args[0]
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
-		}
+		client := newQMPClient(vmid)
 
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
 
 		devices, err := client.QueryUSBDevices()
 		if err != nil {
-			fmt.Printf("Error listing USB devices: %v\n", err)
-			os.Exit(1)
+			exitWithError("Error listing USB devices: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":    vmid,
+				"devices": devices,
+			})
+			return
 		}
 
 		fmt.Printf("USB devices for VM %s:\n", vmid)
@@ -63,16 +62,10 @@ var addUSBCmd = &cobra.Command{
 		deviceType := args[1]
 		deviceID := args[2]
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
-		}
+		client := newQMPClient(vmid)
 
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
 
@@ -83,13 +76,21 @@ var addUSBCmd = &cobra.Command{
 		case "mouse":
 			err = client.AddUSBMouse(deviceID)
 		default:
-			fmt.Printf("Unknown device type: %s. Supported types: keyboard, mouse\n", deviceType)
-			os.Exit(1)
+			exitWithError("Unknown device type: %s. Supported types: keyboard, mouse", deviceType)
 		}
 
 		if err != nil {
-			fmt.Printf("Error adding USB %s: %v\n", deviceType, err)
-			os.Exit(1)
+			exitWithError("Error adding USB %s: %v", deviceType, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":   vmid,
+				"action": "add",
+				"type":   deviceType,
+				"id":     deviceID,
+			})
+			return
 		}
 
 		fmt.Printf("Added USB %s with ID %s to VM %s\n", deviceType, deviceID, vmid)
@@ -104,22 +105,24 @@ var removeUSBCmd = &cobra.Command{
 		vmid := args[0]
 		deviceID := args[1]
 
-		var client *qmp.Client
-		if socketPath := GetSocketPath(); socketPath != "" {
-			client = qmp.NewWithSocketPath(vmid, socketPath)
-		} else {
-			client = qmp.New(vmid)
-		}
+		client := newQMPClient(vmid)
 
 		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to VM %s: %v\n", vmid, err)
-			os.Exit(1)
+			exitWithError("Error connecting to VM %s: %v", vmid, err)
 		}
 		defer client.Close()
 
 		if err := client.RemoveDevice(deviceID); err != nil {
-			fmt.Printf("Error removing device %s: %v\n", deviceID, err)
-			os.Exit(1)
+			exitWithError("Error removing device %s: %v", deviceID, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(map[string]interface{}{
+				"vmid":   vmid,
+				"action": "remove",
+				"id":     deviceID,
+			})
+			return
 		}
 
 		fmt.Printf("Removed device %s from VM %s\n", deviceID, vmid)
@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/proxmox"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	proxmoxURL         string
+	proxmoxTokenID     string
+	proxmoxTokenSecret string
+	proxmoxInsecure    bool
+	vmWait             bool
+)
+
+// vmCmd represents the vm command
+var vmCmd = &cobra.Command{
+	Use:   "vm",
+	Short: "Discover and control VMs through the Proxmox API",
+	Long: `Discover and control VMs through the Proxmox VE REST API.
+
+Authentication uses an API token. The connection can be configured with
+flags or in the config file:
+
+  proxmox:
+    url: https://pve1:8006
+    token_id: root@pam!qmp
+    token_secret: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+    insecure: true`,
+}
+
+// vmListCmd represents the vm list command
+var vmListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List VMs in the cluster",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := mustProxmoxClient()
+
+		vms, err := client.ListVMs()
+		if err != nil {
+			exitWithError("Error listing VMs: %v", err)
+		}
+
+		if isJSONOutput() {
+			printJSON(vms)
+			return
+		}
+
+		if len(vms) == 0 {
+			fmt.Println("No VMs found")
+			return
+		}
+
+		fmt.Printf("%-8s %-24s %-12s %s\n", "VMID", "NAME", "NODE", "STATUS")
+		for _, vm := range vms {
+			fmt.Printf("%-8d %-24s %-12s %s\n", vm.VMID, vm.Name, vm.Node, vm.Status)
+		}
+	},
+}
+
+// vmStatusCmd represents the vm status command
+var vmStatusCmd = &cobra.Command{
+	Use:   "status [vmid]",
+	Short: "Show the run state of a VM",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		vmid := args[0]
+		client := mustProxmoxClient()
+
+		status, err := client.Status(vmid)
+		if err != nil {
+			exitWithError("Error querying status for VM %s: %v", vmid, err)
+		}
+
+		if isJSONOutput() {
+			printJSON(status)
+			return
+		}
+
+		fmt.Printf("Status for VM %s (%s):\n", vmid, status.Name)
+		fmt.Printf("  Status: %s\n", status.Status)
+		fmt.Printf("  QMP Status: %s\n", status.QMPStatus)
+		fmt.Printf("  Uptime: %v\n", time.Duration(status.Uptime)*time.Second)
+	},
+}
+
+// vmStartCmd represents the vm start command
+var vmStartCmd = &cobra.Command{
+	Use:   "start [vmid]",
+	Short: "Start a VM",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runVMAction(args[0], "start")
+	},
+}
+
+// vmStopCmd represents the vm stop command
+var vmStopCmd = &cobra.Command{
+	Use:   "stop [vmid]",
+	Short: "Stop a VM",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runVMAction(args[0], "stop")
+	},
+}
+
+// runVMAction starts or stops a VM and optionally waits for the new state
+func runVMAction(vmid string, action string) {
+	client := mustProxmoxClient()
+
+	var task string
+	var err error
+	want := "running"
+	if action == "start" {
+		task, err = client.Start(vmid)
+	} else {
+		task, err = client.Stop(vmid)
+		want = "stopped"
+	}
+	if err != nil {
+		exitWithError("Error running %s on VM %s: %v", action, vmid, err)
+	}
+	logging.Debug("Proxmox task started", "task", task)
+
+	if vmWait {
+		if err := client.WaitForStatus(vmid, want, 2*time.Minute); err != nil {
+			exitWithError("Error waiting for VM %s: %v", vmid, err)
+		}
+	}
+
+	if isJSONOutput() {
+		printJSON(map[string]interface{}{
+			"vmid":   vmid,
+			"action": action,
+			"task":   task,
+		})
+		return
+	}
+
+	fmt.Printf("Requested %s of VM %s (task %s)\n", action, vmid, task)
+}
+
+// getProxmoxClient creates a Proxmox API client from flags or config
+func getProxmoxClient() (*proxmox.Client, error) {
+	url := proxmoxURL
+	if url == "" {
+		url = viper.GetString("proxmox.url")
+	}
+	tokenID := proxmoxTokenID
+	if tokenID == "" {
+		tokenID = viper.GetString("proxmox.token_id")
+	}
+	tokenSecret := proxmoxTokenSecret
+	if tokenSecret == "" {
+		tokenSecret = viper.GetString("proxmox.token_secret")
+	}
+	insecure := proxmoxInsecure || viper.GetBool("proxmox.insecure")
+
+	if url == "" || tokenID == "" || tokenSecret == "" {
+		return nil, fmt.Errorf("Proxmox API is not configured (set proxmox.url, proxmox.token_id and proxmox.token_secret)")
+	}
+
+	return proxmox.New(url, tokenID, tokenSecret, insecure), nil
+}
+
+// mustProxmoxClient returns a Proxmox API client or exits on failure
+func mustProxmoxClient() *proxmox.Client {
+	client, err := getProxmoxClient()
+	if err != nil {
+		exitWithError("Error: %v", err)
+	}
+	return client
+}
+
+// ensureVMRunning starts the VM through the Proxmox API if it is stopped
+func ensureVMRunning(vmid string) error {
+	client, err := getProxmoxClient()
+	if err != nil {
+		return err
+	}
+
+	status, err := client.Status(vmid)
+	if err != nil {
+		return err
+	}
+	if status.Status == "running" {
+		return nil
+	}
+
+	logging.Info("VM is not running, starting it", "vmid", vmid, "status", status.Status)
+	if _, err := client.Start(vmid); err != nil {
+		return err
+	}
+	if err := client.WaitForStatus(vmid, "running", 2*time.Minute); err != nil {
+		return err
+	}
+
+	// Give QEMU a moment to create the QMP socket
+	time.Sleep(2 * time.Second)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(vmCmd)
+	vmCmd.AddCommand(vmListCmd)
+	vmCmd.AddCommand(vmStatusCmd)
+	vmCmd.AddCommand(vmStartCmd)
+	vmCmd.AddCommand(vmStopCmd)
+
+	vmCmd.PersistentFlags().StringVar(&proxmoxURL, "api-url", "", "Proxmox API URL (e.g. https://pve1:8006)")
+	vmCmd.PersistentFlags().StringVar(&proxmoxTokenID, "token-id", "", "Proxmox API token ID (USER@REALM!TOKEN)")
+	vmCmd.PersistentFlags().StringVar(&proxmoxTokenSecret, "token-secret", "", "Proxmox API token secret")
+	vmCmd.PersistentFlags().BoolVar(&proxmoxInsecure, "insecure", false, "skip TLS certificate verification")
+	vmStartCmd.Flags().BoolVarP(&vmWait, "wait", "w", false, "wait until the VM is running")
+	vmStopCmd.Flags().BoolVarP(&vmWait, "wait", "w", false, "wait until the VM is stopped")
+}
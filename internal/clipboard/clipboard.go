@@ -0,0 +1,92 @@
+// Package clipboard reads and writes the host clipboard using the platform's
+// command line tools
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// tool is a clipboard command line tool
+type tool struct {
+	name string
+	args []string
+}
+
+// readTools and writeTools are tried in order until one is installed
+var (
+	readTools = []tool{
+		{"pbpaste", nil},
+		{"wl-paste", []string{"--no-newline"}},
+		{"xclip", []string{"-selection", "clipboard", "-o"}},
+		{"xsel", []string{"--clipboard", "--output"}},
+		{"powershell.exe", []string{"-NoProfile", "-Command", "Get-Clipboard"}},
+	}
+	writeTools = []tool{
+		{"pbcopy", nil},
+		{"wl-copy", nil},
+		{"xclip", []string{"-selection", "clipboard", "-i"}},
+		{"xsel", []string{"--clipboard", "--input"}},
+		{"clip.exe", nil},
+	}
+)
+
+// find returns the first installed tool
+func find(tools []tool) (tool, error) {
+	var names []string
+	for _, t := range tools {
+		if _, err := exec.LookPath(t.name); err == nil {
+			return t, nil
+		}
+		names = append(names, t.name)
+	}
+	return tool{}, fmt.Errorf("no clipboard tool found (install one of %s)", strings.Join(names, ", "))
+}
+
+// Available reports whether tools to read and write the clipboard are installed
+func Available() error {
+	if _, err := find(readTools); err != nil {
+		return err
+	}
+	_, err := find(writeTools)
+	return err
+}
+
+// Read returns the contents of the host clipboard
+func Read() (string, error) {
+	t, err := find(readTools)
+	if err != nil {
+		return "", err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(t.name, t.args...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("failed to read clipboard with %s: %v %s", t.name, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// Write replaces the contents of the host clipboard
+func Write(text string) error {
+	t, err := find(writeTools)
+	if err != nil {
+		return err
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(t.name, t.args...)
+	cmd.Stdin, cmd.Stderr = strings.NewReader(text), &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to write clipboard with %s: %v %s", t.name, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// GuestReadCommand is a shell command that prints the clipboard of a Linux
+// guest's graphical session, for running through the guest agent
+const GuestReadCommand = `export DISPLAY="${DISPLAY:-:0}"; ` +
+	`wl-paste --no-newline 2>/dev/null || xclip -selection clipboard -o 2>/dev/null || xsel --clipboard --output`
@@ -0,0 +1,171 @@
+package console
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jstein/qmp/internal/screen"
+)
+
+// DetachKey is the key that leaves the console; every other key goes to the VM
+const DetachKey = "ctrl+]"
+
+var (
+	statusStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("0")).Background(lipgloss.Color("14"))
+	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("15")).Background(lipgloss.Color("9"))
+)
+
+// Options configures a console
+type Options struct {
+	// Title is shown in the status line, e.g. "VM 106"
+	Title string
+	// Capture returns the current screen of the VM
+	Capture func() (image.Image, error)
+	// SendKey sends a single character or a key combination such as "ctrl+c"
+	SendKey func(key string) error
+	// Refresh is the interval between screen captures
+	Refresh time.Duration
+}
+
+// tickMsg triggers a screen capture
+type tickMsg struct{}
+
+// frameMsg carries the result of a screen capture
+type frameMsg struct {
+	img image.Image
+	err error
+}
+
+// Model is the bubbletea model for an attached console
+type Model struct {
+	opts Options
+
+	img    image.Image
+	frame  string
+	status string
+	err    error
+	keys   int
+
+	width  int
+	height int
+}
+
+// New creates a console model
+func New(opts Options) Model {
+	if opts.Refresh <= 0 {
+		opts.Refresh = 500 * time.Millisecond
+	}
+	return Model{opts: opts}
+}
+
+// Init implements tea.Model
+func (m Model) Init() tea.Cmd {
+	return m.capture()
+}
+
+// capture takes a screenshot in the background
+func (m Model) capture() tea.Cmd {
+	return func() tea.Msg {
+		img, err := m.opts.Capture()
+		return frameMsg{img: img, err: err}
+	}
+}
+
+// Update implements tea.Model
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.render()
+
+	case tickMsg:
+		return m, m.capture()
+
+	case frameMsg:
+		m.err = msg.err
+		if msg.err == nil {
+			m.img = msg.img
+			m.render()
+		}
+		return m, tea.Tick(m.opts.Refresh, func(time.Time) tea.Msg { return tickMsg{} })
+
+	case tea.KeyMsg:
+		if msg.String() == DetachKey {
+			return m, tea.Quit
+		}
+		for _, key := range KeyNames(msg) {
+			if err := m.opts.SendKey(key); err != nil {
+				m.status = fmt.Sprintf("Failed to send %s: %v", key, err)
+				return m, nil
+			}
+			m.keys++
+		}
+		m.status = ""
+	}
+
+	return m, nil
+}
+
+// render redraws the cached frame for the current image and window size
+func (m *Model) render() {
+	if m.img == nil || m.width == 0 {
+		return
+	}
+	// Leave the last line for the status bar
+	m.frame = screen.RenderANSI(m.img, m.width, m.height-1)
+}
+
+// View implements tea.Model
+func (m Model) View() string {
+	var b strings.Builder
+	if m.frame == "" {
+		b.WriteString("Waiting for the first screen capture...")
+	} else {
+		b.WriteString(m.frame)
+	}
+	b.WriteString("\n")
+
+	status := fmt.Sprintf(" %s  %d keys sent  %s to detach ", m.opts.Title, m.keys, DetachKey)
+	switch {
+	case m.status != "":
+		b.WriteString(errorStyle.Render(" " + m.status + " "))
+	case m.err != nil:
+		b.WriteString(errorStyle.Render(fmt.Sprintf(" Capture failed: %v ", m.err)))
+	default:
+		b.WriteString(statusStyle.Render(status))
+	}
+	return b.String()
+}
+
+// KeyNames translates a terminal key press into the keys sent to the VM:
+// single characters, or combinations such as "ctrl+c" and "shift+tab"
+func KeyNames(msg tea.KeyMsg) []string {
+	switch msg.Type {
+	case tea.KeyRunes:
+		keys := make([]string, 0, len(msg.Runes))
+		for _, r := range msg.Runes {
+			key := string(r)
+			if r == ' ' {
+				key = "spc"
+			}
+			if msg.Alt {
+				key = "alt+" + key
+			}
+			keys = append(keys, key)
+		}
+		return keys
+	case tea.KeySpace:
+		if msg.Alt {
+			return []string{"alt+spc"}
+		}
+		return []string{"spc"}
+	default:
+		// Names such as "enter", "esc", "up", "f5", "ctrl+a" and
+		// "shift+tab" map onto QEMU key names and aliases
+		return []string{msg.String()}
+	}
+}
@@ -0,0 +1,255 @@
+package ga
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+)
+
+// Client represents a QEMU guest agent connection
+type Client struct {
+	conn       net.Conn
+	vmid       string
+	reader     *bufio.Reader
+	socketPath string
+
+	// Timeout bounds every request so that a missing agent inside the
+	// guest doesn't block forever
+	Timeout time.Duration
+}
+
+// command represents a guest agent command
+type command struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+// response represents a guest agent response
+type response struct {
+	Return json.RawMessage `json:"return,omitempty"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error,omitempty"`
+}
+
+// ExecResult is the outcome of a command run inside the guest
+type ExecResult struct {
+	ExitCode int    `json:"exitcode"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// New creates a new guest agent client
+func New(vmid string) *Client {
+	return &Client{vmid: vmid, Timeout: 10 * time.Second}
+}
+
+// NewWithSocketPath creates a new guest agent client with a custom socket path
+func NewWithSocketPath(vmid string, socketPath string) *Client {
+	return &Client{
+		vmid:       vmid,
+		socketPath: socketPath,
+		Timeout:    10 * time.Second,
+	}
+}
+
+// Connect establishes a connection to the guest agent socket and
+// synchronises the stream
+func (g *Client) Connect() error {
+	socketPath := g.socketPath
+	if socketPath == "" {
+		socketPath = fmt.Sprintf("/var/run/qemu-server/%s.qga", g.vmid)
+	}
+
+	logging.Debug("Connecting to guest agent socket", "path", socketPath)
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to connect to guest agent socket: %v", err)
+	}
+	g.conn = conn
+	g.reader = bufio.NewReader(conn)
+
+	if err := g.sync(); err != nil {
+		g.conn.Close()
+		return err
+	}
+
+	logging.Info("Connected to guest agent", "vmid", g.vmid)
+	return nil
+}
+
+// Close closes the guest agent connection
+func (g *Client) Close() error {
+	if g.conn != nil {
+		logging.Debug("Closing guest agent connection", "vmid", g.vmid)
+		return g.conn.Close()
+	}
+	return nil
+}
+
+// sync discards stale data left by earlier clients using guest-sync. Replies
+// to commands an interrupted client sent may still be queued ahead of ours,
+// so replies are read until the one carrying our id arrives.
+func (g *Client) sync() error {
+	id := rand.Int63n(1 << 31)
+
+	g.conn.SetDeadline(time.Now().Add(g.Timeout))
+	defer g.conn.SetDeadline(time.Time{})
+
+	if err := g.send("guest-sync", map[string]interface{}{"id": id}); err != nil {
+		return err
+	}
+	for {
+		resp, err := g.readResponse()
+		if err != nil {
+			return fmt.Errorf("guest agent not responding: %v", err)
+		}
+		var got int64
+		if resp.Error == nil && json.Unmarshal(resp.Return, &got) == nil && got == id {
+			return nil
+		}
+		logging.Debug("Discarding stale guest agent reply", "return", string(resp.Return))
+	}
+}
+
+// execute sends a command and decodes the return value into v
+func (g *Client) execute(name string, args interface{}, v interface{}) error {
+	g.conn.SetDeadline(time.Now().Add(g.Timeout))
+	defer g.conn.SetDeadline(time.Time{})
+
+	if err := g.send(name, args); err != nil {
+		return err
+	}
+	resp, err := g.readResponse()
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.Error != nil {
+		return fmt.Errorf("guest agent error: %s: %s", resp.Error.Class, resp.Error.Desc)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(resp.Return, v)
+}
+
+// send writes a command to the socket
+func (g *Client) send(name string, args interface{}) error {
+	data, err := json.Marshal(command{Execute: name, Arguments: args})
+	if err != nil {
+		return fmt.Errorf("failed to marshal command: %v", err)
+	}
+
+	logging.LogCommand(name, args)
+	if _, err := g.conn.Write(data); err != nil {
+		return fmt.Errorf("failed to send command: %v", err)
+	}
+	return nil
+}
+
+// readResponse reads the next reply, skipping lines that are not valid JSON
+func (g *Client) readResponse() (*response, error) {
+	for {
+		line, err := g.reader.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		var resp response
+		if err := json.Unmarshal(line, &resp); err != nil {
+			// Skip garbage left over from an interrupted session
+			logging.Debug("Skipping invalid guest agent data", "data", string(line))
+			continue
+		}
+		logging.LogResponse(resp)
+		return &resp, nil
+	}
+}
+
+// Ping checks that the guest agent is responding
+func (g *Client) Ping() error {
+	return g.execute("guest-ping", nil, nil)
+}
+
+// Exec runs a shell command inside the guest and waits for it to finish
+func (g *Client) Exec(commandLine string, timeout time.Duration) (*ExecResult, error) {
+	var started struct {
+		PID int `json:"pid"`
+	}
+	args := map[string]interface{}{
+		"path":           "/bin/sh",
+		"arg":            []string{"-c", commandLine},
+		"capture-output": true,
+	}
+	if err := g.execute("guest-exec", args, &started); err != nil {
+		return nil, err
+	}
+	logging.Debug("Started guest command", "pid", started.PID, "command", commandLine)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var status struct {
+			Exited   bool   `json:"exited"`
+			ExitCode int    `json:"exitcode"`
+			OutData  string `json:"out-data"`
+			ErrData  string `json:"err-data"`
+		}
+		if err := g.execute("guest-exec-status", map[string]interface{}{"pid": started.PID}, &status); err != nil {
+			return nil, err
+		}
+
+		if status.Exited {
+			stdout, _ := base64.StdEncoding.DecodeString(status.OutData)
+			stderr, _ := base64.StdEncoding.DecodeString(status.ErrData)
+			return &ExecResult{
+				ExitCode: status.ExitCode,
+				Stdout:   string(stdout),
+				Stderr:   string(stderr),
+			}, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for guest command (pid %d)", started.PID)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+// ReadFile reads a file from the guest filesystem
+func (g *Client) ReadFile(path string) ([]byte, error) {
+	var handle int
+	if err := g.execute("guest-file-open", map[string]interface{}{"path": path, "mode": "r"}, &handle); err != nil {
+		return nil, err
+	}
+	defer g.execute("guest-file-close", map[string]interface{}{"handle": handle}, nil)
+
+	var content []byte
+	for {
+		var chunk struct {
+			Count  int    `json:"count"`
+			BufB64 string `json:"buf-b64"`
+			EOF    bool   `json:"eof"`
+		}
+		if err := g.execute("guest-file-read", map[string]interface{}{"handle": handle, "count": 65536}, &chunk); err != nil {
+			return nil, err
+		}
+
+		data, err := base64.StdEncoding.DecodeString(chunk.BufB64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file data: %v", err)
+		}
+		content = append(content, data...)
+
+		if chunk.EOF || chunk.Count == 0 {
+			return content, nil
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package keyrec
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// StopKey ends the recording session
+const StopKey = "ctrl+]"
+
+var (
+	titleStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13"))
+	dimStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	cursorStyle = lipgloss.NewStyle().Reverse(true)
+)
+
+// Sender forwards key presses to the VM
+type Sender interface {
+	// SendText types printable text
+	SendText(text string) error
+	// SendCombo presses a named key or combination such as "esc" or "ctrl+c"
+	SendCombo(combo string) error
+}
+
+// Model is the bubbletea model for recording key presses as script lines
+type Model struct {
+	vmid   string
+	sender Sender
+
+	// Pause is the idle time after which a <sleep> is inserted
+	Pause time.Duration
+
+	lines   []string
+	current []rune
+	lastKey time.Time
+	err     error
+}
+
+// New creates a recording model forwarding keys through sender
+func New(vmid string, sender Sender, pause time.Duration) *Model {
+	return &Model{
+		vmid:    vmid,
+		sender:  sender,
+		Pause:   pause,
+		lastKey: time.Now(),
+	}
+}
+
+// Lines returns the recorded script lines, including any unfinished line
+func (m *Model) Lines() []string {
+	lines := append([]string{}, m.lines...)
+	if len(m.current) > 0 {
+		lines = append(lines, typeDirective(string(m.current)))
+	}
+	return lines
+}
+
+// Init implements tea.Model
+func (m *Model) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if key.String() == StopKey {
+		return m, tea.Quit
+	}
+
+	m.insertPause()
+	m.err = m.handleKey(key)
+	return m, nil
+}
+
+// insertPause records a <sleep> when the user paused between lines
+func (m *Model) insertPause() {
+	idle := time.Since(m.lastKey)
+	m.lastKey = time.Now()
+	if m.Pause <= 0 || idle < m.Pause || len(m.current) > 0 {
+		return
+	}
+	m.lines = append(m.lines, fmt.Sprintf("<sleep %.1f>", idle.Seconds()))
+}
+
+// handleKey forwards a key press and updates the recorded lines
+func (m *Model) handleKey(key tea.KeyMsg) error {
+	switch key.Type {
+	case tea.KeyRunes, tea.KeySpace:
+		if key.Alt {
+			return m.sendSpecial("alt+" + string(key.Runes))
+		}
+		text := string(key.Runes)
+		if key.Type == tea.KeySpace {
+			text = " "
+		}
+		m.current = append(m.current, []rune(text)...)
+		return m.sender.SendText(text)
+
+	case tea.KeyTab:
+		m.current = append(m.current, '\t')
+		return m.sender.SendText("\t")
+
+	case tea.KeyEnter:
+		m.lines = append(m.lines, string(m.current))
+		m.current = nil
+		return m.sender.SendCombo("ret")
+
+	case tea.KeyBackspace:
+		if len(m.current) > 0 {
+			m.current = m.current[:len(m.current)-1]
+			return m.sender.SendCombo("backspace")
+		}
+		return m.sendSpecial("backspace")
+	}
+
+	return m.sendSpecial(key.String())
+}
+
+// sendSpecial forwards a non-text key and records it as a <key> directive.
+// Text typed so far on the current line is recorded first with <type>.
+func (m *Model) sendSpecial(combo string) error {
+	if len(m.current) > 0 {
+		m.lines = append(m.lines, typeDirective(string(m.current)))
+		m.current = nil
+	}
+	m.lines = append(m.lines, fmt.Sprintf("<key %s>", combo))
+	return m.sender.SendCombo(combo)
+}
+
+// typeDirective returns a <type> directive that types text without Enter
+func typeDirective(text string) string {
+	return fmt.Sprintf("<type \"%s\">", text)
+}
+
+// View implements tea.Model
+func (m *Model) View() string {
+	var b strings.Builder
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Recording keys for VM %s", m.vmid)))
+	b.WriteString(dimStyle.Render(fmt.Sprintf("  (%s to stop)", StopKey)))
+	b.WriteString("\n\n")
+
+	// Show the most recent lines
+	start := 0
+	if len(m.lines) > 15 {
+		start = len(m.lines) - 15
+	}
+	for _, line := range m.lines[start:] {
+		b.WriteString(dimStyle.Render(line) + "\n")
+	}
+	b.WriteString(string(m.current) + cursorStyle.Render(" ") + "\n")
+
+	if m.err != nil {
+		b.WriteString("\n" + errorStyle.Render(fmt.Sprintf("Error: %v", m.err)) + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// multiHandler sends records to several handlers
+type multiHandler []slog.Handler
+
+// Enabled reports whether any handler handles records at the given level
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+// Handle passes the record to every handler that is enabled for its level
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range m {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WithAttrs returns a handler that adds the attributes in every handler
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+// WithGroup returns a handler that groups attributes in every handler
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(m))
+	for i, h := range m {
+		handlers[i] = h.WithGroup(name)
+	}
+	return handlers
+}
+
+// ExpandLogPath replaces {vmid} and {time} in a log file path template
+func ExpandLogPath(template string, vmid string, now time.Time) string {
+	if vmid == "" {
+		vmid = "qmp"
+	}
+	return strings.NewReplacer(
+		"{vmid}", vmid,
+		"{time}", now.Format("20060102-150405"),
+	).Replace(template)
+}
+
+// RunFile is the log file of a single script run. Records logged through
+// its Logger go to the console and to the file, so concurrent runs in one
+// process (e.g. serve jobs) each get a file of their own.
+type RunFile struct {
+	path   string
+	file   *os.File
+	logger *slog.Logger
+}
+
+// OpenRunFile opens a run log file. An existing non-empty file is rotated
+// to path.1, path.2, ... keeping at most keep old files.
+func OpenRunFile(path string, keep int) (*RunFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	if err := rotate(path, keep); err != nil {
+		return nil, fmt.Errorf("failed to rotate log file: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %v", err)
+	}
+
+	return &RunFile{
+		path:   path,
+		file:   f,
+		logger: slog.New(multiHandler{Default().Handler(), NewPlainTextHandler(f)}),
+	}, nil
+}
+
+// Path returns the path of the log file
+func (r *RunFile) Path() string {
+	return r.path
+}
+
+// Logger returns the logger writing to the console and the file
+func (r *RunFile) Logger() *slog.Logger {
+	return r.logger
+}
+
+// Close closes the log file
+func (r *RunFile) Close() error {
+	return r.file.Close()
+}
+
+// rotate shifts path to path.1, path.1 to path.2 and so on, dropping the oldest
+func rotate(path string, keep int) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() == 0 {
+		return nil
+	}
+	if keep <= 0 {
+		return os.Remove(path)
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", path, keep))
+	for i := keep - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(older); err == nil {
+			if err := os.Rename(older, fmt.Sprintf("%s.%d", path, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	return os.Rename(path, path+".1")
+}
@@ -6,6 +6,9 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"regexp"
+	"strings"
+	"sync"
 
 	"github.com/fatih/color"
 )
@@ -17,58 +20,99 @@ var (
 	// Default logger instance
 	logger *slog.Logger
 
+	// console receives colored log output
+	sinkMu  sync.Mutex
+	console io.Writer = os.Stdout
+
 	// Colors for different log levels
 	infoColor    = color.New(color.FgGreen).SprintFunc()
 	warnColor    = color.New(color.FgYellow).SprintFunc()
 	errorColor   = color.New(color.FgRed).SprintFunc()
 	debugColor   = color.New(color.FgCyan).SprintFunc()
 	commandColor = color.New(color.FgMagenta).SprintFunc()
+
+	// Secret values masked in all log output
+	secretsMu sync.RWMutex
+	secrets   []string
+	// redacting suppresses QMP command arguments while secrets are typed
+	redacting int
 )
 
-// ColorTextHandler is a simple handler that adds colors to log output
+// ansiEscape matches terminal color codes
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// SecretMask replaces secret values in log output
+const SecretMask = "****"
+
+// ColorTextHandler is a simple handler that adds colors to log output.
+// It is safe for concurrent use.
 type ColorTextHandler struct {
-	w io.Writer
+	w     io.Writer
+	mu    *sync.Mutex
+	attrs []slog.Attr
+	// plain disables colors and adds timestamps, for log files
+	plain bool
 }
 
 // NewColorTextHandler creates a new ColorTextHandler
 func NewColorTextHandler(w io.Writer) *ColorTextHandler {
-	return &ColorTextHandler{w: w}
+	return &ColorTextHandler{w: w, mu: &sync.Mutex{}}
+}
+
+// NewPlainTextHandler creates a handler without colors that timestamps
+// every line and records all levels, for log files
+func NewPlainTextHandler(w io.Writer) *ColorTextHandler {
+	return &ColorTextHandler{w: w, mu: &sync.Mutex{}, plain: true}
 }
 
 // Handle handles the log record
 func (h *ColorTextHandler) Handle(ctx context.Context, r slog.Record) error {
 	var levelText string
-	switch r.Level {
-	case slog.LevelDebug:
+	switch {
+	case h.plain:
+		levelText = r.Time.Format("2006-01-02T15:04:05.000") + " " + r.Level.String()
+	case r.Level == slog.LevelDebug:
 		levelText = debugColor("DEBUG")
-	case slog.LevelInfo:
+	case r.Level == slog.LevelInfo:
 		levelText = infoColor("INFO")
-	case slog.LevelWarn:
+	case r.Level == slog.LevelWarn:
 		levelText = warnColor("WARN")
-	case slog.LevelError:
+	case r.Level == slog.LevelError:
 		levelText = errorColor("ERROR")
 	default:
 		levelText = r.Level.String()
 	}
 
 	// Format the message
-	msg := r.Message
+	msg := Mask(r.Message)
 
 	// Build attributes string
 	var attrs string
-	r.Attrs(func(a slog.Attr) bool {
+	addAttr := func(a slog.Attr) bool {
 		// Skip the source attribute
 		if a.Key == "source" {
 			return true
 		}
 
 		// Format the attribute
-		attrs += " " + a.Key + "=" + formatAttrValue(a.Value)
+		attrs += " " + a.Key + "=" + Mask(formatAttrValue(a.Value))
 		return true
-	})
+	}
+	for _, a := range h.attrs {
+		addAttr(a)
+	}
+	r.Attrs(addAttr)
+
+	line := levelText + " " + msg + attrs + "\n"
+	if h.plain {
+		// Some values (e.g. QMP command names) are colored before logging
+		line = ansiEscape.ReplaceAllString(line, "")
+	}
 
 	// Write the log line
-	_, err := io.WriteString(h.w, levelText+" "+msg+attrs+"\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, line)
 	return err
 }
 
@@ -96,9 +140,11 @@ func formatAttrValue(v slog.Value) string {
 	}
 }
 
-// WithAttrs returns a new handler with the given attributes
+// WithAttrs returns a new handler that adds the given attributes to every record
 func (h *ColorTextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
-	return h
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	return &clone
 }
 
 // WithGroup returns a new handler with the given group
@@ -108,7 +154,7 @@ func (h *ColorTextHandler) WithGroup(name string) slog.Handler {
 
 // Enabled reports whether the handler handles records at the given level
 func (h *ColorTextHandler) Enabled(ctx context.Context, level slog.Level) bool {
-	if debugEnabled {
+	if debugEnabled || h.plain {
 		return level >= slog.LevelDebug
 	}
 	return level >= slog.LevelInfo
@@ -117,10 +163,7 @@ func (h *ColorTextHandler) Enabled(ctx context.Context, level slog.Level) bool {
 // Init initializes the logger with the specified debug level
 func Init(debug bool) {
 	debugEnabled = debug
-
-	handler := NewColorTextHandler(os.Stdout)
-	logger = slog.New(handler)
-	slog.SetDefault(logger)
+	SetOutput(os.Stdout)
 
 	if debug {
 		Debug("Debug logging enabled")
@@ -129,11 +172,26 @@ func Init(debug bool) {
 
 // SetOutput sets the output writer for the logger
 func SetOutput(w io.Writer) {
-	handler := NewColorTextHandler(w)
-	logger = slog.New(handler)
+	sinkMu.Lock()
+	console = w
+	sinkMu.Unlock()
+	rebuild()
+}
+
+// rebuild installs a default logger writing to the console
+func rebuild() {
+	sinkMu.Lock()
+	defer sinkMu.Unlock()
+
+	logger = slog.New(NewColorTextHandler(console))
 	slog.SetDefault(logger)
 }
 
+// Default returns the logger used by the package-level functions
+func Default() *slog.Logger {
+	return slog.Default()
+}
+
 // Debug logs a debug message
 func Debug(msg string, args ...any) {
 	slog.Debug(msg, args...)
@@ -154,15 +212,79 @@ func Error(msg string, args ...any) {
 	slog.Error(msg, args...)
 }
 
+// AddSecret registers a value that must never appear in log output
+func AddSecret(value string) {
+	if value == "" {
+		return
+	}
+
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+	for _, s := range secrets {
+		if s == value {
+			return
+		}
+	}
+	secrets = append(secrets, value)
+}
+
+// Mask replaces every registered secret value in s
+func Mask(s string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, SecretMask)
+	}
+	return s
+}
+
+// Redacted runs fn with QMP command arguments hidden from the debug log.
+// Text containing secrets is typed one key per command, so masking whole
+// values is not enough to keep it out of the log.
+func Redacted(fn func() error) error {
+	secretsMu.Lock()
+	redacting++
+	secretsMu.Unlock()
+
+	defer func() {
+		secretsMu.Lock()
+		redacting--
+		secretsMu.Unlock()
+	}()
+
+	return fn()
+}
+
+// isRedacting reports whether a Redacted call is in progress
+func isRedacting() bool {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+	return redacting > 0
+}
+
 // LogCommand logs a QMP command with pretty formatting
 func LogCommand(cmd string, args interface{}) {
-	Debug("Sending QMP command",
+	LogCommandTo(Default(), cmd, args)
+}
+
+// LogCommandTo logs a QMP command to l
+func LogCommandTo(l *slog.Logger, cmd string, args interface{}) {
+	if isRedacting() {
+		l.Debug("Sending QMP command", "command", commandColor(cmd), "args", SecretMask)
+		return
+	}
+	l.Debug("Sending QMP command",
 		"command", commandColor(cmd),
 		"args", args)
 }
 
 // LogResponse logs a QMP response with pretty formatting
 func LogResponse(resp interface{}) {
-	Debug("Received QMP response",
+	LogResponseTo(Default(), resp)
+}
+
+// LogResponseTo logs a QMP response to l
+func LogResponseTo(l *slog.Logger, resp interface{}) {
+	l.Debug("Received QMP response",
 		"response", resp)
 }
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// QMPCommandDuration tracks the round-trip latency of QMP commands
+	QMPCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qmp_command_duration_seconds",
+		Help:    "Latency of QMP commands.",
+		Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command"})
+
+	// QMPCommandErrors counts failed QMP commands
+	QMPCommandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qmp_command_errors_total",
+		Help: "QMP commands that failed or returned an error.",
+	}, []string{"command"})
+
+	// QMPQueueWait tracks how long work waits for a managed connection, by priority
+	QMPQueueWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "qmp_queue_wait_seconds",
+		Help:    "Time spent waiting for the QMP connection, by priority.",
+		Buckets: []float64{.0001, .001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"priority"})
+
+	// ScreenCaptures counts screen captures taken for comparison
+	ScreenCaptures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "qmp_screen_captures_total",
+		Help: "Screen captures decoded for comparison.",
+	})
+
+	// ScreenCaptureDuration tracks how long capturing and decoding the screen takes
+	ScreenCaptureDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "qmp_screen_capture_duration_seconds",
+		Help:    "Time taken to capture and decode the screen.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// ScriptLines counts executed script lines
+	ScriptLines = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "qmp_script_lines_total",
+		Help: "Script lines executed.",
+	})
+
+	// ScriptFailures counts failed script lines by directive ("type" for typed lines)
+	ScriptFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "qmp_script_failures_total",
+		Help: "Script lines that failed, by directive.",
+	}, []string{"directive"})
+)
+
+// ObserveCommand records the latency and outcome of a QMP command
+func ObserveCommand(command string, start time.Time, err error) {
+	QMPCommandDuration.WithLabelValues(command).Observe(time.Since(start).Seconds())
+	if err != nil {
+		QMPCommandErrors.WithLabelValues(command).Inc()
+	}
+}
+
+// Handler returns the HTTP handler serving metrics in the Prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Serve exposes /metrics on addr in the background
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Handler())
+
+	logging.Info("Serving metrics", "listen", addr)
+	go func() {
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			logging.Error("Metrics server stopped", "error", err)
+		}
+	}()
+}
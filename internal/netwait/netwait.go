@@ -0,0 +1,60 @@
+package netwait
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+)
+
+// maxDialTimeout caps how long a single connection attempt may take
+const maxDialTimeout = 5 * time.Second
+
+// Result describes a successful wait
+type Result struct {
+	Address  string        `json:"address"`
+	Attempts int           `json:"attempts"`
+	Elapsed  time.Duration `json:"elapsed_ns"`
+}
+
+// Wait probes address (host:port) until a TCP connection succeeds, the
+// timeout expires or ctx is cancelled
+func Wait(ctx context.Context, address string, timeout time.Duration, interval time.Duration) (*Result, error) {
+	start := time.Now()
+	deadline := start.Add(timeout)
+	dialTimeout := min(max(interval, time.Second), maxDialTimeout)
+
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		dialer := net.Dialer{Timeout: dialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err == nil {
+			conn.Close()
+			return &Result{Address: address, Attempts: attempt, Elapsed: time.Since(start)}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		logging.Debug("Address not reachable yet", "address", address, "attempt", attempt, "error", err)
+
+		if time.Now().Add(interval).After(deadline) {
+			return nil, fmt.Errorf("%s not reachable within %v: %v", address, timeout, lastErr)
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Address joins a host and port, bracketing IPv6 addresses
+func Address(host string, port int) string {
+	return net.JoinHostPort(host, fmt.Sprint(port))
+}
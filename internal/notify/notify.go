@@ -0,0 +1,117 @@
+// Package notify sends notifications about script runs to chat services and email
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jstein/qmp/internal/logging"
+)
+
+// Level is the severity of a notification
+type Level string
+
+// Notification levels
+const (
+	LevelInfo  Level = "info"
+	LevelWarn  Level = "warn"
+	LevelError Level = "error"
+)
+
+// rank orders levels for filtering
+var rank = map[Level]int{LevelInfo: 0, LevelWarn: 1, LevelError: 2}
+
+// ParseLevel parses a level name (info, warn, error)
+func ParseLevel(s string) (Level, error) {
+	level := Level(strings.ToLower(s))
+	if level == "warning" {
+		level = LevelWarn
+	}
+	if _, ok := rank[level]; !ok {
+		return "", fmt.Errorf("unknown notification level %q (use info, warn or error)", s)
+	}
+	return level, nil
+}
+
+// Message is a single notification
+type Message struct {
+	Level Level
+	Title string
+	Text  string
+}
+
+// String formats the message as plain text
+func (m Message) String() string {
+	if m.Title == "" {
+		return fmt.Sprintf("[%s] %s", strings.ToUpper(string(m.Level)), m.Text)
+	}
+	return fmt.Sprintf("[%s] %s\n%s", strings.ToUpper(string(m.Level)), m.Title, m.Text)
+}
+
+// Provider delivers notifications to one service
+type Provider interface {
+	Name() string
+	Send(msg Message) error
+}
+
+// Notifier sends messages at or above a minimum level to every provider
+type Notifier struct {
+	providers []Provider
+	minLevel  Level
+}
+
+// New creates a notifier from the configuration
+func New(cfg Config) (*Notifier, error) {
+	n := &Notifier{minLevel: LevelInfo}
+	if cfg.Level != "" {
+		level, err := ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		n.minLevel = level
+	}
+
+	if cfg.Slack.WebhookURL != "" {
+		n.providers = append(n.providers, newWebhook("slack", cfg.Slack.WebhookURL, "text"))
+	}
+	if cfg.Discord.WebhookURL != "" {
+		n.providers = append(n.providers, newWebhook("discord", cfg.Discord.WebhookURL, "content"))
+	}
+	if cfg.Email.SMTP != "" {
+		email, err := newEmail(cfg.Email)
+		if err != nil {
+			return nil, err
+		}
+		n.providers = append(n.providers, email)
+	}
+	return n, nil
+}
+
+// Enabled reports whether any provider is configured
+func (n *Notifier) Enabled() bool {
+	return n != nil && len(n.providers) > 0
+}
+
+// Notify sends a message to every provider. Messages below the minimum
+// level are dropped. Failing providers are logged and returned together.
+func (n *Notifier) Notify(msg Message) error {
+	if !n.Enabled() {
+		return fmt.Errorf("no notification providers configured")
+	}
+	if rank[msg.Level] < rank[n.minLevel] {
+		logging.Debug("Skipping notification below minimum level", "level", msg.Level, "min_level", n.minLevel)
+		return nil
+	}
+
+	var errs []error
+	for _, provider := range n.providers {
+		if err := provider.Send(msg); err != nil {
+			logging.Warn("Failed to send notification", "provider", provider.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %v", provider.Name(), err))
+			continue
+		}
+		logging.Debug("Sent notification", "provider", provider.Name(), "level", msg.Level)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Config configures the notification providers (the notify section of the
+// config file)
+type Config struct {
+	// Level is the minimum level sent (info, warn, error)
+	Level   string        `mapstructure:"level"`
+	Slack   WebhookConfig `mapstructure:"slack"`
+	Discord WebhookConfig `mapstructure:"discord"`
+	Email   EmailConfig   `mapstructure:"email"`
+}
+
+// WebhookConfig configures a chat webhook
+type WebhookConfig struct {
+	WebhookURL string `mapstructure:"webhook_url"`
+}
+
+// EmailConfig configures email delivery over SMTP
+type EmailConfig struct {
+	// SMTP is the server address, e.g. smtp.example.com:587
+	SMTP     string   `mapstructure:"smtp"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// webhook posts messages as JSON to Slack or Discord incoming webhooks
+type webhook struct {
+	name       string
+	url        string
+	field      string
+	httpClient *http.Client
+}
+
+// newWebhook creates a webhook provider that sends the text in the given JSON field
+func newWebhook(name string, url string, field string) *webhook {
+	return &webhook{name: name, url: url, field: field, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Name implements Provider
+func (w *webhook) Name() string {
+	return w.name
+}
+
+// Send implements Provider
+func (w *webhook) Send(msg Message) error {
+	body, err := json.Marshal(map[string]string{w.field: msg.String()})
+	if err != nil {
+		return err
+	}
+
+	resp, err := w.httpClient.Post(w.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return nil
+}
+
+// email sends messages over SMTP
+type email struct {
+	cfg EmailConfig
+}
+
+// newEmail validates the email configuration and creates a provider
+func newEmail(cfg EmailConfig) (*email, error) {
+	if cfg.From == "" || len(cfg.To) == 0 {
+		return nil, fmt.Errorf("email notifications need notify.email.from and notify.email.to")
+	}
+	if _, _, err := net.SplitHostPort(cfg.SMTP); err != nil {
+		return nil, fmt.Errorf("invalid notify.email.smtp address %q (use HOST:PORT)", cfg.SMTP)
+	}
+	return &email{cfg: cfg}, nil
+}
+
+// Name implements Provider
+func (e *email) Name() string {
+	return "email"
+}
+
+// Send implements Provider
+func (e *email) Send(msg Message) error {
+	subject := fmt.Sprintf("[qmp %s] %s", msg.Level, msg.Title)
+	if msg.Title == "" {
+		subject = fmt.Sprintf("[qmp %s] %s", msg.Level, firstLine(msg.Text))
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "From: %s\r\n", e.cfg.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(e.cfg.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(msg.Text, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(e.cfg.SMTP)
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, host)
+	}
+	return smtp.SendMail(e.cfg.SMTP, auth, e.cfg.From, e.cfg.To, []byte(body.String()))
+}
+
+// firstLine returns the first line of s
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,102 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Store holds named configuration profiles. Each profile is a set of config
+// keys (the same keys as in .qmp.yaml) that override the base config.
+type Store struct {
+	Current  string                            `yaml:"current,omitempty" json:"current"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles" json:"profiles"`
+}
+
+// DefaultPath returns the default profiles file, ~/.config/qmp/profiles.yaml
+func DefaultPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "qmp", "profiles.yaml"), nil
+}
+
+// Load reads a profiles file. A missing file yields an empty store.
+func Load(path string) (*Store, error) {
+	store := &Store{Profiles: map[string]map[string]interface{}{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %v", err)
+	}
+
+	if err := yaml.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file %s: %v", path, err)
+	}
+	if store.Profiles == nil {
+		store.Profiles = map[string]map[string]interface{}{}
+	}
+	return store, nil
+}
+
+// Save writes the store to path, creating the directory if needed
+func (s *Store) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create profiles directory: %v", err)
+	}
+
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode profiles: %v", err)
+	}
+	// Profiles may contain API tokens
+	return os.WriteFile(path, data, 0600)
+}
+
+// Names returns the profile names in sorted order
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the settings of a profile
+func (s *Store) Get(name string) (map[string]interface{}, error) {
+	settings, ok := s.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(s.Names(), ", "))
+	}
+	return settings, nil
+}
+
+// Set sets a dotted config key (e.g. proxmox.url) in a profile, creating
+// the profile if it does not exist
+func (s *Store) Set(name string, key string, value string) {
+	settings, ok := s.Profiles[name]
+	if !ok {
+		settings = map[string]interface{}{}
+		s.Profiles[name] = settings
+	}
+
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := settings[part].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			settings[part] = child
+		}
+		settings = child
+	}
+	settings[parts[len(parts)-1]] = value
+}
@@ -0,0 +1,205 @@
+package proxmox
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+)
+
+// Client talks to the Proxmox VE REST API using API token authentication
+type Client struct {
+	baseURL     string
+	tokenID     string
+	tokenSecret string
+	httpClient  *http.Client
+}
+
+// VM describes a virtual machine as reported by the cluster resources API
+type VM struct {
+	VMID   int     `json:"vmid"`
+	Name   string  `json:"name"`
+	Node   string  `json:"node"`
+	Status string  `json:"status"`
+	Type   string  `json:"type"`
+	CPU    float64 `json:"cpu"`
+	MaxCPU int     `json:"maxcpu"`
+	Mem    int64   `json:"mem"`
+	MaxMem int64   `json:"maxmem"`
+	Uptime int64   `json:"uptime"`
+}
+
+// VMStatus is the current status of a single VM
+type VMStatus struct {
+	VMID      int    `json:"vmid"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	QMPStatus string `json:"qmpstatus"`
+	Uptime    int64  `json:"uptime"`
+	CPUs      int    `json:"cpus"`
+	MaxMem    int64  `json:"maxmem"`
+}
+
+// New creates a new Proxmox API client.
+// baseURL is the API host, e.g. https://pve1:8006. tokenID has the form
+// USER@REALM!TOKENNAME. Set insecure to skip TLS verification for
+// self-signed certificates.
+func New(baseURL string, tokenID string, tokenSecret string, insecure bool) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		tokenID:     tokenID,
+		tokenSecret: tokenSecret,
+		httpClient: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+		},
+	}
+}
+
+// request performs an API request and decodes the "data" field into v
+func (c *Client) request(method string, path string, form url.Values, v interface{}) error {
+	endpoint := c.baseURL + "/api2/json" + path
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequest(method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", c.tokenID, c.tokenSecret))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	logging.Debug("Sending Proxmox API request", "method", method, "path", path)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach Proxmox API: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	logging.Debug("Received Proxmox API response", "status", resp.StatusCode, "body", string(data))
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Proxmox API error: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, v)
+}
+
+// ListVMs returns all QEMU VMs in the cluster
+func (c *Client) ListVMs() ([]VM, error) {
+	var resources []VM
+	if err := c.request(http.MethodGet, "/cluster/resources?type=vm", nil, &resources); err != nil {
+		return nil, err
+	}
+
+	var vms []VM
+	for _, r := range resources {
+		if r.Type == "qemu" {
+			vms = append(vms, r)
+		}
+	}
+	return vms, nil
+}
+
+// FindVM returns the cluster entry for a VM ID
+func (c *Client) FindVM(vmid string) (*VM, error) {
+	vms, err := c.ListVMs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vm := range vms {
+		if fmt.Sprintf("%d", vm.VMID) == vmid {
+			return &vm, nil
+		}
+	}
+	return nil, fmt.Errorf("VM %s not found in cluster", vmid)
+}
+
+// Status returns the current status of a VM
+func (c *Client) Status(vmid string) (*VMStatus, error) {
+	vm, err := c.FindVM(vmid)
+	if err != nil {
+		return nil, err
+	}
+
+	var status VMStatus
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/current", url.PathEscape(vm.Node), url.PathEscape(vmid))
+	if err := c.request(http.MethodGet, path, nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Start starts a VM and returns the task ID
+func (c *Client) Start(vmid string) (string, error) {
+	return c.statusAction(vmid, "start")
+}
+
+// Stop stops a VM and returns the task ID
+func (c *Client) Stop(vmid string) (string, error) {
+	return c.statusAction(vmid, "stop")
+}
+
+// statusAction posts a status change (start, stop, ...) for a VM
+func (c *Client) statusAction(vmid string, action string) (string, error) {
+	vm, err := c.FindVM(vmid)
+	if err != nil {
+		return "", err
+	}
+
+	var task string
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/status/%s", url.PathEscape(vm.Node), url.PathEscape(vmid), action)
+	if err := c.request(http.MethodPost, path, url.Values{}, &task); err != nil {
+		return "", err
+	}
+	return task, nil
+}
+
+// WaitForStatus polls the VM until it reaches the wanted status or the timeout expires
+func (c *Client) WaitForStatus(vmid string, want string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		status, err := c.Status(vmid)
+		if err != nil {
+			return err
+		}
+		if status.Status == want {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for VM %s to be %s (currently %s)", vmid, want, status.Status)
+		}
+		time.Sleep(time.Second)
+	}
+}
@@ -0,0 +1,124 @@
+package qmp
+
+import (
+	"fmt"
+)
+
+// BlockDevice describes a block device as reported by query-block
+type BlockDevice struct {
+	Device    string         `json:"device"`
+	QdevPath  string         `json:"qdev,omitempty"`
+	Type      string         `json:"type"`
+	Removable bool           `json:"removable"`
+	Locked    bool           `json:"locked"`
+	TrayOpen  bool           `json:"tray_open,omitempty"`
+	Inserted  *BlockInserted `json:"inserted,omitempty"`
+}
+
+// BlockInserted describes the medium inserted in a block device
+type BlockInserted struct {
+	File     string `json:"file"`
+	Driver   string `json:"drv"`
+	ReadOnly bool   `json:"ro"`
+	NodeName string `json:"node-name,omitempty"`
+}
+
+// QueryBlock returns the block devices of the VM
+func (q *Client) QueryBlock() ([]BlockDevice, error) {
+	resp, err := q.sendCommand(Command{Execute: "query-block"})
+	if err != nil {
+		return nil, err
+	}
+
+	var devices []BlockDevice
+	if err := decodeReturn(resp, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// BlockSnapshot creates an external snapshot of a device. New writes go to
+// snapshotFile, which uses the given format (e.g. qcow2).
+func (q *Client) BlockSnapshot(device string, snapshotFile string, format string) error {
+	cmd := Command{
+		Execute: "blockdev-snapshot-sync",
+		Arguments: map[string]interface{}{
+			"device":        device,
+			"snapshot-file": snapshotFile,
+			"format":        format,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// BlockCommit merges the active overlay of a device back into its backing
+// file. The job is started asynchronously by QEMU; use QueryBlockJobs to follow it.
+func (q *Client) BlockCommit(device string) error {
+	cmd := Command{
+		Execute: "block-commit",
+		Arguments: map[string]interface{}{
+			"device": device,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// QueryBlockJobs returns the running block jobs
+func (q *Client) QueryBlockJobs() ([]interface{}, error) {
+	resp, err := q.sendCommand(Command{Execute: "query-block-jobs"})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, ok := resp.Return.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid response format")
+	}
+	return jobs, nil
+}
+
+// BlockResize grows (or shrinks) a device to size bytes
+func (q *Client) BlockResize(device string, size int64) error {
+	cmd := Command{
+		Execute: "block_resize",
+		Arguments: map[string]interface{}{
+			"device": device,
+			"size":   size,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// Eject ejects the medium from a removable device
+func (q *Client) Eject(device string, force bool) error {
+	cmd := Command{
+		Execute: "eject",
+		Arguments: map[string]interface{}{
+			"device": device,
+			"force":  force,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// ChangeMedium inserts a new medium (e.g. an ISO image) into a removable device
+func (q *Client) ChangeMedium(device string, filename string, format string) error {
+	args := map[string]interface{}{
+		"device":   device,
+		"filename": filename,
+	}
+	if format != "" {
+		args["format"] = format
+	}
+
+	_, err := q.sendCommand(Command{Execute: "blockdev-change-medium", Arguments: args})
+	return err
+}
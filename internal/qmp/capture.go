@@ -0,0 +1,34 @@
+package qmp
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	"github.com/jstein/qmp/internal/metrics"
+	"github.com/jstein/qmp/internal/screen"
+)
+
+// CaptureImage takes a screenshot and returns it as a decoded image
+func (q *Client) CaptureImage() (image.Image, error) {
+	start := time.Now()
+	metrics.ScreenCaptures.Inc()
+	defer func() { metrics.ScreenCaptureDuration.Observe(time.Since(start).Seconds()) }()
+
+	// PNG screendumps skip the PPM intermediate where QEMU supports them
+	format := q.screendumpFormat()
+	tempFile, err := os.CreateTemp("", "qmp-capture-*."+format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+	tempFile.Close()
+
+	if err := q.screenDump(tempPath, "", format); err != nil {
+		return nil, err
+	}
+
+	return screen.LoadImage(tempPath)
+}
@@ -5,22 +5,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode"
 
 	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/metrics"
+	"github.com/jstein/qmp/internal/qmp/keymap"
 )
 
 // Client represents a QMP client connection
 type Client struct {
+	*session
+
+	// wrote, when set, is flagged once this handle writes to the socket.
+	// The manager gives each call its own handle, so it can tell whether
+	// that call sent anything even while other calls share the connection.
+	wrote *atomic.Bool
+}
+
+// session is the connection and settings shared by all handles of a client
+type session struct {
 	conn       net.Conn
 	vmid       string
 	reader     *bufio.Reader
 	socketPath string
+
+	// stateMu guards the settings below, which callers sharing a managed
+	// connection (qmp.max_in_flight > 1) may read and change concurrently
+	stateMu     sync.Mutex
+	keymap      *keymap.Layout
+	unicodeMode UnicodeMode
+	recorder    Recorder
+	holdTime    time.Duration
+	// pngScreendump caches whether screendump accepts format=png
+	pngScreendump *bool
+	// logger receives the client's log records; nil uses the default
+	logger *slog.Logger
+
+	// ioMu keeps each command and its response together on the socket
+	ioMu sync.Mutex
+
+	// remote, when set, is the SSH destination hosting the QMP socket
+	remote string
 }
 
 // Command represents a QMP command
@@ -47,104 +80,149 @@ type Error struct {
 
 // New creates a new QMP client
 func New(vmid string) *Client {
-	return &Client{vmid: vmid}
+	return &Client{session: &session{vmid: vmid}}
 }
 
 // NewWithSocketPath creates a new QMP client with a custom socket path
 func NewWithSocketPath(vmid string, socketPath string) *Client {
-	return &Client{
+	// Socket path patterns such as /mnt/pve1/%s.qmp are expanded per VM
+	if strings.Contains(socketPath, "%s") {
+		socketPath = fmt.Sprintf(socketPath, vmid)
+	}
+
+	return &Client{session: &session{
 		vmid:       vmid,
 		socketPath: socketPath,
+	}}
+}
+
+// tracked returns a handle on the same connection that sets wrote when it
+// writes to the socket
+func (q *Client) tracked(wrote *atomic.Bool) *Client {
+	return &Client{session: q.session, wrote: wrote}
+}
+
+// SocketPath returns the path of the QMP socket (on the remote host when
+// one is set)
+func (q *Client) SocketPath() string {
+	if q.socketPath != "" {
+		return q.socketPath
 	}
+	return fmt.Sprintf("/var/run/qemu-server/%s.qmp", q.vmid)
 }
 
 // Connect establishes a connection to the QMP socket
 func (q *Client) Connect() error {
-	var socketPath string
-	if q.socketPath != "" {
-		socketPath = q.socketPath
-	} else {
-		socketPath = fmt.Sprintf("/var/run/qemu-server/%s.qmp", q.vmid)
-	}
+	socketPath := q.SocketPath()
 
-	logging.Debug("Connecting to QMP socket", "path", socketPath)
-	conn, err := net.Dial("unix", socketPath)
+	q.log().Debug("Connecting to QMP socket", "path", socketPath)
+	conn, err := q.dial(socketPath)
 	if err != nil {
 		return fmt.Errorf("failed to connect to QMP socket: %v", err)
 	}
 	q.conn = conn
 	q.reader = bufio.NewReader(conn)
+	q.stateMu.Lock()
+	q.pngScreendump = nil
+	q.stateMu.Unlock()
 
 	// Read the greeting message
 	var greeting Response
 	if err := q.readJSON(&greeting); err != nil {
-		q.conn.Close()
+		q.Close()
 		return fmt.Errorf("failed to read greeting: %v", err)
 	}
-	logging.LogResponse(greeting)
+	logging.LogResponseTo(q.log(), greeting)
 
 	// Send qmp_capabilities to enable commands
 	cmd := Command{Execute: "qmp_capabilities"}
 	data, err := json.Marshal(cmd)
 	if err != nil {
-		q.conn.Close()
+		q.Close()
 		return fmt.Errorf("failed to marshal capabilities command: %v", err)
 	}
 
-	logging.LogCommand("qmp_capabilities", nil)
+	logging.LogCommandTo(q.log(), "qmp_capabilities", nil)
 	if _, err := q.conn.Write(data); err != nil {
-		q.conn.Close()
+		q.Close()
 		return fmt.Errorf("failed to send capabilities command: %v", err)
 	}
 
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		q.conn.Close()
+	resp, err := q.readResponse()
+	if err != nil {
+		q.Close()
 		return fmt.Errorf("failed to read capabilities response: %v", err)
 	}
-	logging.LogResponse(resp)
+	logging.LogResponseTo(q.log(), *resp)
 
 	if resp.Error != nil {
-		q.conn.Close()
+		q.Close()
 		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
 	}
 
-	logging.Info("Connected to QMP socket", "vmid", q.vmid)
+	q.log().Info("Connected to QMP socket", "vmid", q.vmid)
 	return nil
 }
 
 // Close closes the QMP connection
 func (q *Client) Close() error {
 	if q.conn != nil {
-		logging.Debug("Closing QMP connection", "vmid", q.vmid)
+		q.log().Debug("Closing QMP connection", "vmid", q.vmid)
 		return q.conn.Close()
 	}
 	return nil
 }
 
 // sendCommand sends a QMP command and returns the response
-func (q *Client) sendCommand(cmd Command) (*Response, error) {
+func (q *Client) sendCommand(cmd Command) (resp *Response, err error) {
+	start := time.Now()
+	defer func() { metrics.ObserveCommand(cmd.Execute, start, err) }()
+
 	data, err := json.Marshal(cmd)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal command: %v", err)
 	}
 
-	logging.LogCommand(cmd.Execute, cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
+	q.ioMu.Lock()
+	defer q.ioMu.Unlock()
+
+	logging.LogCommandTo(q.log(), cmd.Execute, cmd.Arguments)
+	n, err := q.conn.Write(data)
+	if n > 0 && q.wrote != nil {
+		q.wrote.Store(true)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to send command: %v", err)
 	}
 
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
+	response, err := q.readResponse()
+	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
-	logging.LogResponse(resp)
+	logging.LogResponseTo(q.log(), *response)
 
-	if resp.Error != nil {
-		return nil, fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
+	if response.Error != nil {
+		return nil, fmt.Errorf("QMP error: %s: %s", response.Error.Class, response.Error.Desc)
 	}
 
-	return &resp, nil
+	return response, nil
+}
+
+// readResponse reads the reply to a command. Asynchronous events (STOP,
+// RESUME, RESET, DEVICE_TRAY_MOVED, ...) can arrive on the same socket at
+// any time and are skipped so they are never mistaken for the reply.
+func (q *Client) readResponse() (*Response, error) {
+	for {
+		var response Response
+		if err := q.readJSON(&response); err != nil {
+			return nil, err
+		}
+		if response.Event != "" {
+			q.log().Debug("Skipping QMP event", "event", response.Event, "data", response.Data)
+			continue
+		}
+		return &response, nil
+	}
 }
 
 // readJSON reads a JSON object from the QMP socket
@@ -161,7 +239,7 @@ func (q *Client) readJSON(v interface{}) error {
 		}
 	}
 
-	logging.Debug("Raw JSON received", "json", string(fullLine))
+	q.log().Debug("Raw JSON received", "json", string(fullLine))
 	return json.Unmarshal(fullLine, v)
 }
 
@@ -171,26 +249,11 @@ func (q *Client) QueryUSBDevices() ([]interface{}, error) {
 		Execute: "query-usb",
 	}
 
-	data, err := json.Marshal(cmd)
+	resp, err := q.sendCommand(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	logging.LogCommand("query-usb", nil)
-	if _, err := q.conn.Write(data); err != nil {
-		return nil, err
-	}
-
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return nil, err
-	}
-	logging.LogResponse(resp)
-
-	if resp.Error != nil {
-		return nil, fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
 	devices, ok := resp.Return.([]interface{})
 	if !ok {
 		return nil, fmt.Errorf("invalid response format")
@@ -209,27 +272,8 @@ func (q *Client) AddUSBKeyboard(id string) error {
 		},
 	}
 
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return err
-	}
-
-	logging.LogCommand("device_add", cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
-		return err
-	}
-
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return err
-	}
-	logging.LogResponse(resp)
-
-	if resp.Error != nil {
-		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
-	return nil
+	_, err := q.sendCommand(cmd)
+	return err
 }
 
 // AddUSBMouse adds a USB mouse to the VM
@@ -242,27 +286,8 @@ func (q *Client) AddUSBMouse(id string) error {
 		},
 	}
 
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return err
-	}
-
-	logging.LogCommand("device_add", cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
-		return err
-	}
-
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return err
-	}
-	logging.LogResponse(resp)
-
-	if resp.Error != nil {
-		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
-	return nil
+	_, err := q.sendCommand(cmd)
+	return err
 }
 
 // RemoveDevice removes a device from the VM
@@ -274,27 +299,8 @@ func (q *Client) RemoveDevice(deviceID string) error {
 		},
 	}
 
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return err
-	}
-
-	logging.LogCommand("device_del", cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
-		return err
-	}
-
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return err
-	}
-	logging.LogResponse(resp)
-
-	if resp.Error != nil {
-		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
-	return nil
+	_, err := q.sendCommand(cmd)
+	return err
 }
 
 // QueryStatus returns the current VM status
@@ -303,36 +309,95 @@ func (q *Client) QueryStatus() (map[string]interface{}, error) {
 		Execute: "query-status",
 	}
 
-	data, err := json.Marshal(cmd)
+	resp, err := q.sendCommand(cmd)
 	if err != nil {
 		return nil, err
 	}
 
-	logging.LogCommand("query-status", nil)
-	if _, err := q.conn.Write(data); err != nil {
-		return nil, err
+	status, ok := resp.Return.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid response format")
 	}
 
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return nil, err
+	return status, nil
+}
+
+// SetKeymap sets the guest keyboard layout used to translate characters
+// into key presses. The US layout is used when no keymap is set.
+func (q *Client) SetKeymap(layout *keymap.Layout) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.keymap = layout
+}
+
+// SetLogger sets the logger for the client's records, e.g. the log file of
+// a script run. nil uses the default logger.
+func (q *Client) SetLogger(logger *slog.Logger) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.logger = logger
+}
+
+// log returns the logger for the client's records
+func (q *Client) log() *slog.Logger {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	if q.logger == nil {
+		return logging.Default()
 	}
-	logging.LogResponse(resp)
+	return q.logger
+}
 
-	if resp.Error != nil {
-		return nil, fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
+// layout returns the active keyboard layout
+func (q *Client) layout() *keymap.Layout {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	if q.keymap == nil {
+		q.keymap, _ = keymap.Get("us")
 	}
+	return q.keymap
+}
 
-	status, ok := resp.Return.(map[string]interface{})
-	if !ok {
-		return nil, fmt.Errorf("invalid response format")
+// sendChord presses the given qcodes together and releases them
+func (q *Client) sendChord(codes []string) error {
+	keys := make([]map[string]string, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, map[string]string{"type": "qcode", "data": code})
 	}
 
-	return status, nil
+	args := map[string]interface{}{
+		"keys": keys,
+	}
+	q.stateMu.Lock()
+	holdTime := q.holdTime
+	q.stateMu.Unlock()
+	if holdTime > 0 {
+		args["hold-time"] = holdTime.Milliseconds()
+	}
+
+	_, err := q.sendCommand(Command{Execute: "send-key", Arguments: args})
+	return err
 }
 
 // SendKey sends a key press to the VM
 func (q *Client) SendKey(key string) error {
+	q.recordInput("key", key)
+	return q.sendKey(key)
+}
+
+// sendKey sends a key press without recording it
+func (q *Client) sendKey(key string) error {
+	// Single characters are translated using the guest keyboard layout
+	if runes := []rune(key); len(runes) == 1 {
+		if mapped, ok := q.layout().Lookup(runes[0]); ok {
+			return q.sendChord(mapped.QCodes())
+		}
+		// Characters outside ASCII that the layout lacks need a unicode strategy
+		if runes[0] > unicode.MaxASCII {
+			return q.sendUnicode(runes[0])
+		}
+	}
+
 	// Map common key names to QEMU key codes
 	keyMap := map[string]string{
 		"enter":     "ret",
@@ -364,25 +429,9 @@ func (q *Client) SendKey(key string) error {
 					},
 				}
 
-				shiftData, err := json.Marshal(shiftCmd)
-				if err != nil {
-					return err
-				}
-
-				logging.LogCommand("send-key", shiftCmd.Arguments)
-				if _, err := q.conn.Write(shiftData); err != nil {
-					return err
-				}
-
-				var shiftResp Response
-				if err := q.readJSON(&shiftResp); err != nil {
+				if _, err := q.sendCommand(shiftCmd); err != nil {
 					return err
 				}
-				logging.LogResponse(shiftResp)
-
-				if shiftResp.Error != nil {
-					return fmt.Errorf("QMP error: %s: %s", shiftResp.Error.Class, shiftResp.Error.Desc)
-				}
 
 				// Then send the lowercase letter
 				qemuKey = strings.ToLower(key)
@@ -396,36 +445,7 @@ func (q *Client) SendKey(key string) error {
 		}
 	}
 
-	cmd := Command{
-		Execute: "send-key",
-		Arguments: map[string]interface{}{
-			"keys": []map[string]string{
-				{"type": "qcode", "data": qemuKey},
-			},
-		},
-	}
-
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return err
-	}
-
-	logging.LogCommand("send-key", cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
-		return err
-	}
-
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
-		return err
-	}
-	logging.LogResponse(resp)
-
-	if resp.Error != nil {
-		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
-	}
-
-	return nil
+	return q.sendChord([]string{qemuKey})
 }
 
 // SendKeys sends multiple key presses to the VM
@@ -441,6 +461,12 @@ func (q *Client) SendKeys(keys []string, delay time.Duration) error {
 
 // SendString sends a string of text to the VM
 func (q *Client) SendString(text string, delay time.Duration) error {
+	q.recordInput("text", text)
+	return q.typeText(text, delay)
+}
+
+// typeText types text one key at a time without recording it
+func (q *Client) typeText(text string, delay time.Duration) error {
 	for _, r := range text {
 		key := string(r)
 		// Handle special characters
@@ -453,7 +479,7 @@ func (q *Client) SendString(text string, delay time.Duration) error {
 			key = "spc"
 		}
 
-		if err := q.SendKey(key); err != nil {
+		if err := q.sendKey(key); err != nil {
 			return err
 		}
 		time.Sleep(delay)
@@ -463,55 +489,64 @@ func (q *Client) SendString(text string, delay time.Duration) error {
 
 // ScreenDump takes a screenshot and saves it as a PPM file
 func (q *Client) ScreenDump(filename string, remoteTempPath string) error {
+	return q.screenDump(filename, remoteTempPath, FormatPPM)
+}
+
+// screenDump takes a screenshot in the given format (ppm or png)
+func (q *Client) screenDump(filename string, remoteTempPath string, format string) error {
 	// Determine the path to use for the screenshot
 	tempPath := ""
-	if remoteTempPath != "" {
+	if q.remote != "" {
+		// Dump on the remote host and copy the file back over SSH
+		tempPath = remoteTempPath
+		if tempPath == "" {
+			tempPath = q.remoteTempPath(format)
+		}
+		q.log().Debug("Using temporary path on remote host", "remote", q.remote, "path", tempPath)
+	} else if remoteTempPath != "" {
 		// Use the provided remote path
 		tempPath = remoteTempPath
-		logging.Debug("Using remote temporary path for screenshot", "path", tempPath)
+		q.log().Debug("Using remote temporary path for screenshot", "path", tempPath)
 	} else {
 		// Create a temporary file for the screenshot
-		tempFile, err := os.CreateTemp("", "qmp-screenshot-*.ppm")
+		tempFile, err := os.CreateTemp("", "qmp-screenshot-*."+format)
 		if err != nil {
 			return fmt.Errorf("failed to create temporary file: %v", err)
 		}
 		tempPath = tempFile.Name()
 		defer os.Remove(tempPath)
 		tempFile.Close()
-		logging.Debug("Created local temporary file for screenshot", "path", tempPath)
+		q.log().Debug("Created local temporary file for screenshot", "path", tempPath)
 	}
 
-	cmd := Command{
-		Execute: "screendump",
-		Arguments: map[string]interface{}{
-			"filename": tempPath,
-		},
+	args := map[string]interface{}{
+		"filename": tempPath,
 	}
-
-	data, err := json.Marshal(cmd)
-	if err != nil {
-		return err
+	// Older QEMU rejects the format argument, so PPM leaves it out
+	if format != FormatPPM {
+		args["format"] = format
 	}
-
-	logging.LogCommand("screendump", cmd.Arguments)
-	if _, err := q.conn.Write(data); err != nil {
-		return err
+	cmd := Command{
+		Execute:   "screendump",
+		Arguments: args,
 	}
 
-	var resp Response
-	if err := q.readJSON(&resp); err != nil {
+	if _, err := q.sendCommand(cmd); err != nil {
 		return err
 	}
-	logging.LogResponse(resp)
 
-	if resp.Error != nil {
-		return fmt.Errorf("QMP error: %s: %s", resp.Error.Class, resp.Error.Desc)
+	if q.remote != "" {
+		if err := q.fetchRemoteFile(tempPath, filename); err != nil {
+			return err
+		}
+		q.recordScreenshot(filename)
+		return nil
 	}
 
 	// If using a remote path, we can't copy the file locally
 	if remoteTempPath != "" {
-		logging.Info("Screenshot saved on remote server", "path", remoteTempPath)
-		logging.Info("You'll need to manually copy the file from the remote server")
+		q.log().Info("Screenshot saved on remote server", "path", remoteTempPath)
+		q.log().Info("You'll need to manually copy the file from the remote server")
 		return nil
 	}
 
@@ -532,15 +567,23 @@ func (q *Client) ScreenDump(filename string, remoteTempPath string) error {
 		return fmt.Errorf("failed to copy screenshot: %v", err)
 	}
 
+	q.recordScreenshot(filename)
 	return nil
 }
 
-// ScreenDumpAndConvert takes a screenshot and converts it to PNG
+// ScreenDumpAndConvert takes a screenshot and saves it as PNG. QEMU writes
+// the PNG directly when it supports it; otherwise a PPM screendump is
+// converted with ImageMagick.
 func (q *Client) ScreenDumpAndConvert(filename string, remoteTempPath string) error {
+	if q.SupportsPNGScreendump() {
+		q.log().Debug("Taking PNG screendump directly", "output", filename)
+		return q.screenDump(filename, remoteTempPath, FormatPNG)
+	}
+
 	// For remote paths, we can't do the conversion locally
-	if remoteTempPath != "" {
-		logging.Info("When using a remote temporary path, only PPM format is supported")
-		logging.Info("You'll need to manually convert the file on the remote server")
+	if remoteTempPath != "" && q.remote == "" {
+		q.log().Info("When using a remote temporary path, only PPM format is supported")
+		q.log().Info("You'll need to manually convert the file on the remote server")
 		return q.ScreenDump(filename, remoteTempPath)
 	}
 
@@ -0,0 +1,170 @@
+package qmp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// keyAliases maps common key names to QEMU qcodes
+var keyAliases = map[string]string{
+	"enter":     "ret",
+	"return":    "ret",
+	"space":     "spc",
+	"escape":    "esc",
+	"del":       "delete",
+	"ins":       "insert",
+	"pgdown":    "pgdn",
+	"pagedown":  "pgdn",
+	"pageup":    "pgup",
+	"control":   "ctrl",
+	"altgr":     "alt_r",
+	"super":     "meta_l",
+	"win":       "meta_l",
+	"meta":      "meta_l",
+	"backspace": "backspace",
+}
+
+// comboCodes translates a key combination such as "ctrl+alt+delete" into qcodes
+func (q *Client) comboCodes(combo string) ([]string, error) {
+	var codes []string
+	for _, part := range strings.Split(combo, "+") {
+		if part == "" {
+			return nil, fmt.Errorf("invalid key combination %q", combo)
+		}
+
+		// Single characters use the guest keyboard layout
+		if runes := []rune(part); len(runes) == 1 {
+			if mapped, ok := q.layout().Lookup(runes[0]); ok {
+				codes = append(codes, mapped.QCodes()...)
+				continue
+			}
+			// A character missing from the layout is not a qcode either
+			if runes[0] > unicode.MaxASCII {
+				return nil, fmt.Errorf("character %q in %q is not on the %s keymap", part, combo, q.layout().Name)
+			}
+		}
+
+		name := strings.ToLower(part)
+		if alias, ok := keyAliases[name]; ok {
+			name = alias
+		}
+		codes = append(codes, name)
+	}
+	return codes, nil
+}
+
+// SendCombo presses a key combination such as "ctrl+c" or "ctrl+alt+delete"
+func (q *Client) SendCombo(combo string) error {
+	q.recordInput("key", combo)
+
+	// A lone character missing from the layout is typed like text, using
+	// the unicode mode, so <key ö> behaves the same as typing ö
+	if runes := []rune(combo); len(runes) == 1 && runes[0] > unicode.MaxASCII {
+		if _, ok := q.layout().Lookup(runes[0]); !ok {
+			return q.sendUnicode(runes[0])
+		}
+	}
+
+	codes, err := q.comboCodes(combo)
+	if err != nil {
+		return err
+	}
+	return q.sendChord(codes)
+}
+
+// qcodeKeys converts qcodes to input-send-event key values
+func qcodeKeys(codes []string) []map[string]interface{} {
+	keys := make([]map[string]interface{}, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, map[string]interface{}{"type": "qcode", "data": code})
+	}
+	return keys
+}
+
+// sendKeyEvents presses or releases keys using input-send-event. Keys are
+// released in reverse order so modifiers are let go last.
+func (q *Client) sendKeyEvents(keys []map[string]interface{}, down bool) error {
+	events := make([]map[string]interface{}, 0, len(keys))
+	for i := range keys {
+		key := keys[i]
+		if !down {
+			key = keys[len(keys)-1-i]
+		}
+		events = append(events, map[string]interface{}{
+			"type": "key",
+			"data": map[string]interface{}{"down": down, "key": key},
+		})
+	}
+
+	cmd := Command{
+		Execute: "input-send-event",
+		Arguments: map[string]interface{}{
+			"events": events,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// KeyDown presses a key or combination such as "shift" or "ctrl+alt" and
+// holds it until KeyUp is called
+func (q *Client) KeyDown(combo string) error {
+	q.recordInput("key", "down:"+combo)
+
+	codes, err := q.comboCodes(combo)
+	if err != nil {
+		return err
+	}
+	return q.sendKeyEvents(qcodeKeys(codes), true)
+}
+
+// KeyUp releases a key or combination pressed with KeyDown
+func (q *Client) KeyUp(combo string) error {
+	q.recordInput("key", "up:"+combo)
+
+	codes, err := q.comboCodes(combo)
+	if err != nil {
+		return err
+	}
+	return q.sendKeyEvents(qcodeKeys(codes), false)
+}
+
+// HoldKey presses a key or combination for the given duration
+func (q *Client) HoldKey(combo string, duration time.Duration) error {
+	if err := q.KeyDown(combo); err != nil {
+		return err
+	}
+	time.Sleep(duration)
+	return q.KeyUp(combo)
+}
+
+// SendKeySequence sends a comma separated list of key combinations and
+// waits, e.g. "ctrl+alt+del, wait 500ms, enter"
+func (q *Client) SendKeySequence(sequence string) error {
+	for _, step := range strings.Split(sequence, ",") {
+		step = strings.TrimSpace(step)
+		if step == "" {
+			continue
+		}
+
+		if fields := strings.Fields(step); fields[0] == "wait" {
+			if len(fields) != 2 {
+				return fmt.Errorf("invalid wait step %q, use \"wait DURATION\"", step)
+			}
+			duration, err := time.ParseDuration(fields[1])
+			if err != nil {
+				return fmt.Errorf("invalid wait duration %q: %v", fields[1], err)
+			}
+			time.Sleep(duration)
+			continue
+		}
+
+		if err := q.SendCombo(step); err != nil {
+			return err
+		}
+	}
+	return nil
+}
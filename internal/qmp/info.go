@@ -0,0 +1,108 @@
+package qmp
+
+import (
+	"encoding/json"
+)
+
+// VMInfo summarises a VM's configuration and state from several query-* commands
+type VMInfo struct {
+	Status  string `json:"status"`
+	Running bool   `json:"running"`
+	CPUs    int    `json:"cpus"`
+	// MemoryBytes is the base plus hotplugged memory
+	MemoryBytes int64 `json:"memory_bytes"`
+	// BalloonBytes is the memory the guest currently has when a balloon device is present
+	BalloonBytes int64         `json:"balloon_bytes,omitempty"`
+	BlockDevices []BlockDevice `json:"block_devices"`
+	NICs         []NIC         `json:"nics"`
+	// DisplayWidth and DisplayHeight are taken from a screendump
+	DisplayWidth  int `json:"display_width,omitempty"`
+	DisplayHeight int `json:"display_height,omitempty"`
+}
+
+// NIC describes a guest network card as reported by query-rx-filter
+type NIC struct {
+	Name string `json:"name"`
+	MAC  string `json:"main-mac"`
+}
+
+// decodeReturn decodes the return value of a response into v
+func decodeReturn(resp *Response, v interface{}) error {
+	// Round-trip through JSON to decode into the typed structure
+	data, err := json.Marshal(resp.Return)
+	if err != nil {
+		return ErrInvalidResponse(err.Error())
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidResponse(err.Error())
+	}
+	return nil
+}
+
+// query sends a query command and decodes its return value into v
+func (q *Client) query(command string, v interface{}) error {
+	resp, err := q.sendCommand(Command{Execute: command})
+	if err != nil {
+		return err
+	}
+	return decodeReturn(resp, v)
+}
+
+// QueryInfo gathers the run state, CPUs, memory, balloon, block devices,
+// NICs and display resolution of the VM. Only the run state is required;
+// details the VM cannot report (e.g. no balloon device) are left empty.
+func (q *Client) QueryInfo() (*VMInfo, error) {
+	status, err := q.QueryStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	info := &VMInfo{BlockDevices: []BlockDevice{}, NICs: []NIC{}}
+	info.Status, _ = status["status"].(string)
+	info.Running, _ = status["running"].(bool)
+
+	var cpus []interface{}
+	if err := q.query("query-cpus-fast", &cpus); err != nil {
+		q.log().Debug("Unable to query CPUs", "error", err)
+	}
+	info.CPUs = len(cpus)
+
+	var memory struct {
+		Base    int64 `json:"base-memory"`
+		Plugged int64 `json:"plugged-memory"`
+	}
+	if err := q.query("query-memory-size-summary", &memory); err != nil {
+		q.log().Debug("Unable to query memory", "error", err)
+	}
+	info.MemoryBytes = memory.Base + memory.Plugged
+
+	var balloon struct {
+		Actual int64 `json:"actual"`
+	}
+	if err := q.query("query-balloon", &balloon); err != nil {
+		q.log().Debug("Unable to query balloon", "error", err)
+	}
+	info.BalloonBytes = balloon.Actual
+
+	if devices, err := q.QueryBlock(); err != nil {
+		q.log().Debug("Unable to query block devices", "error", err)
+	} else if devices != nil {
+		info.BlockDevices = devices
+	}
+
+	// query-rx-filter only covers NICs that support it (e.g. virtio-net)
+	if err := q.query("query-rx-filter", &info.NICs); err != nil {
+		q.log().Debug("Unable to query NICs", "error", err)
+	}
+	if info.NICs == nil {
+		info.NICs = []NIC{}
+	}
+
+	if img, err := q.CaptureImage(); err != nil {
+		q.log().Debug("Unable to capture display", "error", err)
+	} else {
+		info.DisplayWidth, info.DisplayHeight = img.Bounds().Dx(), img.Bounds().Dy()
+	}
+
+	return info, nil
+}
@@ -0,0 +1,108 @@
+package keymap
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Key is the physical key and modifiers needed to produce a character.
+// Code is a QEMU qcode, which names keys by their position on a US keyboard.
+type Key struct {
+	Code  string
+	Shift bool
+	AltGr bool
+}
+
+// Layout maps characters to the key presses that produce them
+type Layout struct {
+	Name string
+	keys map[rune]Key
+}
+
+// keyDef describes one physical key: the qcode and the characters it
+// produces unmodified, with shift and with AltGr ("" for none)
+type keyDef struct {
+	code   string
+	normal string
+	shift  string
+	altGr  string
+}
+
+// layouts holds all known layouts by name
+var layouts = map[string]*Layout{}
+
+// register builds a layout from key definitions and adds it to the registry
+func register(name string, defs []keyDef) {
+	layout := &Layout{Name: name, keys: map[rune]Key{}}
+
+	add := func(s string, key Key) {
+		if s == "" {
+			return
+		}
+		r := []rune(s)[0]
+		// The first definition wins so that duplicates keep the simplest chord
+		if _, exists := layout.keys[r]; !exists {
+			layout.keys[r] = key
+		}
+	}
+
+	for _, def := range defs {
+		add(def.normal, Key{Code: def.code})
+		add(def.shift, Key{Code: def.code, Shift: true})
+		add(def.altGr, Key{Code: def.code, AltGr: true})
+	}
+
+	// Whitespace is the same on every layout
+	add(" ", Key{Code: "spc"})
+	add("\n", Key{Code: "ret"})
+	add("\t", Key{Code: "tab"})
+
+	layouts[name] = layout
+}
+
+// Get returns the layout with the given name
+func Get(name string) (*Layout, error) {
+	layout, ok := layouts[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown keymap %q (available: %s)", name, strings.Join(Names(), ", "))
+	}
+	return layout, nil
+}
+
+// Names returns the names of all available layouts
+func Names() []string {
+	names := make([]string, 0, len(layouts))
+	for name := range layouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the key presses needed to type r
+func (l *Layout) Lookup(r rune) (Key, bool) {
+	key, ok := l.keys[r]
+	return key, ok
+}
+
+// QCodes returns the qcodes to press together (modifiers first) for the key
+func (k Key) QCodes() []string {
+	var codes []string
+	if k.Shift {
+		codes = append(codes, "shift")
+	}
+	if k.AltGr {
+		codes = append(codes, "alt_r")
+	}
+	return append(codes, k.Code)
+}
+
+// letters returns key definitions for letters that sit on their US position
+func letters(chars string) []keyDef {
+	var defs []keyDef
+	for _, c := range chars {
+		defs = append(defs, keyDef{code: string(c), normal: string(c), shift: strings.ToUpper(string(c))})
+	}
+	return defs
+}
@@ -0,0 +1,163 @@
+package keymap
+
+// Dead keys (e.g. ^ and ` on German and French layouts) are left out because
+// they only produce a character together with the following key press.
+
+func init() {
+	register("us", append(letters("abcdefghijklmnopqrstuvwxyz"), []keyDef{
+		{"grave_accent", "`", "~", ""},
+		{"1", "1", "!", ""},
+		{"2", "2", "@", ""},
+		{"3", "3", "#", ""},
+		{"4", "4", "$", ""},
+		{"5", "5", "%", ""},
+		{"6", "6", "^", ""},
+		{"7", "7", "&", ""},
+		{"8", "8", "*", ""},
+		{"9", "9", "(", ""},
+		{"0", "0", ")", ""},
+		{"minus", "-", "_", ""},
+		{"equal", "=", "+", ""},
+		{"bracket_left", "[", "{", ""},
+		{"bracket_right", "]", "}", ""},
+		{"backslash", "\\", "|", ""},
+		{"semicolon", ";", ":", ""},
+		{"apostrophe", "'", "\"", ""},
+		{"comma", ",", "<", ""},
+		{"dot", ".", ">", ""},
+		{"slash", "/", "?", ""},
+	}...))
+
+	register("uk", append(letters("abcdefghijklmnopqrstuvwxyz"), []keyDef{
+		{"grave_accent", "`", "¬", "¦"},
+		{"1", "1", "!", ""},
+		{"2", "2", "\"", ""},
+		{"3", "3", "£", ""},
+		{"4", "4", "$", "€"},
+		{"5", "5", "%", ""},
+		{"6", "6", "^", ""},
+		{"7", "7", "&", ""},
+		{"8", "8", "*", ""},
+		{"9", "9", "(", ""},
+		{"0", "0", ")", ""},
+		{"minus", "-", "_", ""},
+		{"equal", "=", "+", ""},
+		{"bracket_left", "[", "{", ""},
+		{"bracket_right", "]", "}", ""},
+		{"backslash", "#", "~", ""},
+		{"semicolon", ";", ":", ""},
+		{"apostrophe", "'", "@", ""},
+		{"comma", ",", "<", ""},
+		{"dot", ".", ">", ""},
+		{"slash", "/", "?", ""},
+		{"less", "\\", "|", ""},
+	}...))
+
+	register("de", append(letters("abcdfghijklmnoprstuvwx"), []keyDef{
+		{"q", "q", "Q", "@"},
+		{"e", "e", "E", "€"},
+		{"y", "z", "Z", ""},
+		{"z", "y", "Y", ""},
+		{"m", "m", "M", "µ"},
+		{"grave_accent", "", "°", ""},
+		{"1", "1", "!", ""},
+		{"2", "2", "\"", "²"},
+		{"3", "3", "§", "³"},
+		{"4", "4", "$", ""},
+		{"5", "5", "%", ""},
+		{"6", "6", "&", ""},
+		{"7", "7", "/", "{"},
+		{"8", "8", "(", "["},
+		{"9", "9", ")", "]"},
+		{"0", "0", "=", "}"},
+		{"minus", "ß", "?", "\\"},
+		{"bracket_left", "ü", "Ü", ""},
+		{"bracket_right", "+", "*", "~"},
+		{"backslash", "#", "'", ""},
+		{"semicolon", "ö", "Ö", ""},
+		{"apostrophe", "ä", "Ä", ""},
+		{"comma", ",", ";", ""},
+		{"dot", ".", ":", ""},
+		{"slash", "-", "_", ""},
+		{"less", "<", ">", "|"},
+	}...))
+
+	register("fr", append(letters("bcdefghijklnoprstuvxy"), []keyDef{
+		{"q", "a", "A", ""},
+		{"a", "q", "Q", ""},
+		{"w", "z", "Z", ""},
+		{"z", "w", "W", ""},
+		{"semicolon", "m", "M", ""},
+		{"grave_accent", "²", "", ""},
+		{"1", "&", "1", ""},
+		{"2", "é", "2", ""},
+		{"3", "\"", "3", "#"},
+		{"4", "'", "4", "{"},
+		{"5", "(", "5", "["},
+		{"6", "-", "6", "|"},
+		{"7", "è", "7", ""},
+		{"8", "_", "8", "\\"},
+		{"9", "ç", "9", "^"},
+		{"0", "à", "0", "@"},
+		{"minus", ")", "°", "]"},
+		{"equal", "=", "+", "}"},
+		{"bracket_right", "$", "£", "¤"},
+		{"apostrophe", "ù", "%", ""},
+		{"backslash", "*", "µ", ""},
+		{"m", ",", "?", ""},
+		{"comma", ";", ".", ""},
+		{"dot", ":", "/", ""},
+		{"slash", "!", "§", ""},
+		{"less", "<", ">", ""},
+	}...))
+
+	register("dvorak", []keyDef{
+		{"grave_accent", "`", "~", ""},
+		{"1", "1", "!", ""},
+		{"2", "2", "@", ""},
+		{"3", "3", "#", ""},
+		{"4", "4", "$", ""},
+		{"5", "5", "%", ""},
+		{"6", "6", "^", ""},
+		{"7", "7", "&", ""},
+		{"8", "8", "*", ""},
+		{"9", "9", "(", ""},
+		{"0", "0", ")", ""},
+		{"minus", "[", "{", ""},
+		{"equal", "]", "}", ""},
+		{"q", "'", "\"", ""},
+		{"w", ",", "<", ""},
+		{"e", ".", ">", ""},
+		{"r", "p", "P", ""},
+		{"t", "y", "Y", ""},
+		{"y", "f", "F", ""},
+		{"u", "g", "G", ""},
+		{"i", "c", "C", ""},
+		{"o", "r", "R", ""},
+		{"p", "l", "L", ""},
+		{"bracket_left", "/", "?", ""},
+		{"bracket_right", "=", "+", ""},
+		{"backslash", "\\", "|", ""},
+		{"a", "a", "A", ""},
+		{"s", "o", "O", ""},
+		{"d", "e", "E", ""},
+		{"f", "u", "U", ""},
+		{"g", "i", "I", ""},
+		{"h", "d", "D", ""},
+		{"j", "h", "H", ""},
+		{"k", "t", "T", ""},
+		{"l", "n", "N", ""},
+		{"semicolon", "s", "S", ""},
+		{"apostrophe", "-", "_", ""},
+		{"z", ";", ":", ""},
+		{"x", "q", "Q", ""},
+		{"c", "j", "J", ""},
+		{"v", "k", "K", ""},
+		{"b", "x", "X", ""},
+		{"n", "b", "B", ""},
+		{"m", "m", "M", ""},
+		{"comma", "w", "W", ""},
+		{"dot", "v", "V", ""},
+		{"slash", "z", "Z", ""},
+	})
+}
@@ -0,0 +1,270 @@
+package qmp
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnectionState describes the state of a managed QMP connection
+type ConnectionState int
+
+const (
+	// StateConnected means the connection is up and usable
+	StateConnected ConnectionState = iota
+	// StateDisconnected means the connection was lost
+	StateDisconnected
+	// StateReconnecting means a reconnection attempt is in progress
+	StateReconnecting
+	// StateFailed means reconnection was given up
+	StateFailed
+)
+
+// String returns a readable name for the state
+func (s ConnectionState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateDisconnected:
+		return "disconnected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnectionEvent is passed to event hooks when the connection state changes
+type ConnectionEvent struct {
+	State   ConnectionState
+	Attempt int
+	Err     error
+}
+
+// Manager keeps a QMP connection alive and reconnects it when it drops.
+// All access to the underlying client must go through Do or DoPriority so
+// that the keepalive loop and callers never interleave commands on the
+// socket. Waiting callers are served in priority order: input first, then
+// screen captures, then queries.
+type Manager struct {
+	client *Client
+
+	// KeepAlive is the interval between keepalive probes (0 disables them)
+	KeepAlive time.Duration
+	// MaxRetries is the number of reconnection attempts before giving up
+	MaxRetries int
+	// InitialBackoff is the delay before the first reconnection attempt
+	InitialBackoff time.Duration
+	// MaxBackoff caps the exponential backoff between attempts
+	MaxBackoff time.Duration
+	// MaxInFlight is the number of callers allowed to use the client at
+	// once. Each command still has the socket to itself; values above 1 let
+	// input be sent while another caller decodes a screendump.
+	MaxInFlight int
+
+	queue commandQueue
+	// connMu is held for reading while callers use the client and for
+	// writing while the connection is replaced
+	connMu sync.RWMutex
+	// generation counts reconnects so concurrent failures reconnect once
+	generation int
+
+	hooksMu sync.Mutex
+	hooks   []func(ConnectionEvent)
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewManager creates a connection manager for the given client
+func NewManager(client *Client) *Manager {
+	return &Manager{
+		client:         client,
+		KeepAlive:      10 * time.Second,
+		MaxRetries:     10,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     30 * time.Second,
+		MaxInFlight:    1,
+	}
+}
+
+// OnEvent registers a hook that is called on every connection state change.
+// Executors can use it to pause and resume long-running loops.
+func (m *Manager) OnEvent(hook func(ConnectionEvent)) {
+	m.hooksMu.Lock()
+	defer m.hooksMu.Unlock()
+	m.hooks = append(m.hooks, hook)
+}
+
+// emit notifies all registered hooks of events in order. It must not be
+// called with m.connMu held, since hooks may use the connection.
+func (m *Manager) emit(events ...ConnectionEvent) {
+	m.hooksMu.Lock()
+	hooks := append([]func(ConnectionEvent){}, m.hooks...)
+	m.hooksMu.Unlock()
+
+	for _, event := range events {
+		for _, hook := range hooks {
+			hook(event)
+		}
+	}
+}
+
+// SetLogger sets the logger for the connection's records, see Client.SetLogger
+func (m *Manager) SetLogger(logger *slog.Logger) {
+	m.client.SetLogger(logger)
+}
+
+// Connect establishes the connection and starts the keepalive loop
+func (m *Manager) Connect() error {
+	m.connMu.Lock()
+	err := m.client.Connect()
+	m.connMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.emit(ConnectionEvent{State: StateConnected})
+
+	if m.KeepAlive > 0 {
+		m.stop = make(chan struct{})
+		m.wg.Add(1)
+		go m.keepAliveLoop()
+	}
+
+	return nil
+}
+
+// Close stops the keepalive loop and closes the connection
+func (m *Manager) Close() error {
+	if m.stop != nil {
+		close(m.stop)
+		m.wg.Wait()
+		m.stop = nil
+	}
+
+	m.connMu.Lock()
+	defer m.connMu.Unlock()
+	return m.client.Close()
+}
+
+// Do runs fn with access to the client at input priority. If fn fails and
+// the connection turns out to be dead, the manager reconnects. Input is not
+// idempotent, so fn is only run again when it had not written anything to
+// the socket; otherwise the error is returned.
+func (m *Manager) Do(fn func(*Client) error) error {
+	return m.DoPriority(PriorityInput, fn)
+}
+
+// DoPriority is like Do but queues fn behind more urgent waiting callers.
+// Captures and queries are idempotent and are always retried after a
+// reconnect.
+func (m *Manager) DoPriority(priority Priority, fn func(*Client) error) error {
+	m.queue.acquire(priority, m.MaxInFlight)
+
+	m.connMu.RLock()
+	generation := m.generation
+	var wrote atomic.Bool
+	err := fn(m.client.tracked(&wrote))
+	// Partly sent input (e.g. half-typed text) must not be repeated
+	retry := priority != PriorityInput || !wrote.Load()
+	// A QMP-level error on a healthy connection is returned as-is
+	alive := err == nil || m.client.ping() == nil
+	m.connMu.RUnlock()
+	if alive {
+		m.queue.release(m.MaxInFlight)
+		return err
+	}
+
+	m.connMu.Lock()
+	// Another caller may already have replaced the connection
+	var events []ConnectionEvent
+	var rerr error
+	if m.generation == generation {
+		m.client.log().Warn("QMP connection lost", "vmid", m.client.vmid, "error", err)
+		events = append(events, ConnectionEvent{State: StateDisconnected, Err: err})
+		rerr = m.reconnect(&events)
+	}
+	m.connMu.Unlock()
+
+	// Hooks may use the connection themselves, so they run without the
+	// lock or a queue slot
+	m.queue.release(m.MaxInFlight)
+	m.emit(events...)
+
+	if rerr != nil {
+		return fmt.Errorf("%v (reconnect failed: %v)", err, rerr)
+	}
+	if !retry {
+		return fmt.Errorf("%v (reconnected, but the input was not resent because part of it may have reached the VM)", err)
+	}
+
+	m.queue.acquire(priority, m.MaxInFlight)
+	defer m.queue.release(m.MaxInFlight)
+	m.connMu.RLock()
+	defer m.connMu.RUnlock()
+	return fn(m.client)
+}
+
+// reconnect re-establishes the connection with exponential backoff.
+// The caller must hold m.connMu for writing and emit the events appended
+// to events once it has released it.
+func (m *Manager) reconnect(events *[]ConnectionEvent) error {
+	backoff := m.InitialBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= m.MaxRetries; attempt++ {
+		*events = append(*events, ConnectionEvent{State: StateReconnecting, Attempt: attempt})
+		m.client.log().Info("Reconnecting to QMP socket", "vmid", m.client.vmid, "attempt", attempt, "backoff", backoff)
+		time.Sleep(backoff)
+
+		m.client.Close()
+		if err := m.client.Connect(); err != nil {
+			lastErr = err
+			backoff *= 2
+			if backoff > m.MaxBackoff {
+				backoff = m.MaxBackoff
+			}
+			continue
+		}
+
+		m.generation++
+		*events = append(*events, ConnectionEvent{State: StateConnected, Attempt: attempt})
+		return nil
+	}
+
+	*events = append(*events, ConnectionEvent{State: StateFailed, Attempt: m.MaxRetries, Err: lastErr})
+	return fmt.Errorf("gave up after %d attempts: %v", m.MaxRetries, lastErr)
+}
+
+// keepAliveLoop periodically probes the connection so that drops are
+// detected (and repaired) even while the caller is idle
+func (m *Manager) keepAliveLoop() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(m.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			if err := m.DoPriority(PriorityQuery, func(c *Client) error { return c.ping() }); err != nil {
+				m.client.log().Debug("Keepalive failed", "vmid", m.client.vmid, "error", err)
+			}
+		}
+	}
+}
+
+// ping checks that the connection is alive with a cheap query
+func (q *Client) ping() error {
+	if q.conn == nil {
+		return ErrNotConnected
+	}
+	_, err := q.sendCommand(Command{Execute: "query-version"})
+	return err
+}
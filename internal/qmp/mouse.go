@@ -0,0 +1,129 @@
+package qmp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// absAxisMax is the maximum value QEMU accepts for absolute pointer axes
+const absAxisMax = 0x7fff
+
+// mouseButtons lists the button names accepted by input-send-event
+var mouseButtons = map[string]bool{
+	"left":       true,
+	"middle":     true,
+	"right":      true,
+	"wheel-up":   true,
+	"wheel-down": true,
+	"side":       true,
+	"extra":      true,
+}
+
+// sendInputEvents sends a batch of input events to the VM using input-send-event
+func (q *Client) sendInputEvents(events []map[string]interface{}) error {
+	q.recordInput("mouse", events)
+
+	cmd := Command{
+		Execute: "input-send-event",
+		Arguments: map[string]interface{}{
+			"events": events,
+		},
+	}
+
+	_, err := q.sendCommand(cmd)
+	return err
+}
+
+// MouseMove moves the pointer to absolute pixel coordinates on a screen of
+// the given size. The guest needs an absolute pointing device (e.g. usb-tablet).
+func (q *Client) MouseMove(x, y, screenWidth, screenHeight int) error {
+	if screenWidth <= 0 || screenHeight <= 0 {
+		return fmt.Errorf("invalid screen size %dx%d", screenWidth, screenHeight)
+	}
+	if x < 0 || y < 0 || x >= screenWidth || y >= screenHeight {
+		return fmt.Errorf("position %d,%d is outside the %dx%d screen", x, y, screenWidth, screenHeight)
+	}
+
+	// QEMU scales absolute axes to the 0..0x7fff range
+	absX := scaleToAbs(x, screenWidth)
+	absY := scaleToAbs(y, screenHeight)
+
+	return q.sendInputEvents([]map[string]interface{}{
+		{"type": "abs", "data": map[string]interface{}{"axis": "x", "value": absX}},
+		{"type": "abs", "data": map[string]interface{}{"axis": "y", "value": absY}},
+	})
+}
+
+// scaleToAbs converts a pixel position to the absolute axis range
+func scaleToAbs(pos, size int) int {
+	if size <= 1 {
+		return 0
+	}
+	return pos * absAxisMax / (size - 1)
+}
+
+// MouseMoveRel moves the pointer relative to its current position
+func (q *Client) MouseMoveRel(dx, dy int) error {
+	return q.sendInputEvents([]map[string]interface{}{
+		{"type": "rel", "data": map[string]interface{}{"axis": "x", "value": dx}},
+		{"type": "rel", "data": map[string]interface{}{"axis": "y", "value": dy}},
+	})
+}
+
+// MouseButton presses or releases a mouse button
+func (q *Client) MouseButton(button string, down bool) error {
+	button = strings.ToLower(button)
+	if !mouseButtons[button] {
+		return fmt.Errorf("unknown mouse button: %s", button)
+	}
+
+	return q.sendInputEvents([]map[string]interface{}{
+		{"type": "btn", "data": map[string]interface{}{"button": button, "down": down}},
+	})
+}
+
+// MouseClick presses and releases a mouse button
+func (q *Client) MouseClick(button string) error {
+	if err := q.MouseButton(button, true); err != nil {
+		return err
+	}
+	time.Sleep(50 * time.Millisecond)
+	return q.MouseButton(button, false)
+}
+
+// MouseDrag moves to the start position, holds the button, moves to the end
+// position and releases the button
+func (q *Client) MouseDrag(button string, fromX, fromY, toX, toY, screenWidth, screenHeight int) error {
+	if err := q.MouseMove(fromX, fromY, screenWidth, screenHeight); err != nil {
+		return err
+	}
+	if err := q.MouseButton(button, true); err != nil {
+		return err
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := q.MouseMove(toX, toY, screenWidth, screenHeight); err != nil {
+		// Don't leave the button stuck down
+		q.MouseButton(button, false)
+		return err
+	}
+	time.Sleep(50 * time.Millisecond)
+	return q.MouseButton(button, false)
+}
+
+// MouseScroll scrolls the wheel by the given number of steps.
+// Positive values scroll down, negative values scroll up.
+func (q *Client) MouseScroll(steps int) error {
+	button := "wheel-down"
+	if steps < 0 {
+		button = "wheel-up"
+		steps = -steps
+	}
+
+	for i := 0; i < steps; i++ {
+		if err := q.MouseClick(button); err != nil {
+			return err
+		}
+	}
+	return nil
+}
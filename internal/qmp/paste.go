@@ -0,0 +1,49 @@
+package qmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PasteText types a large block of text in chunks. After every chunk of
+// chunkSize characters it waits for pause so the guest can drain its input
+// buffer, which avoids dropped keys with long payloads. A chunkSize of 0
+// types the text without pauses.
+func (q *Client) PasteText(text string, delay time.Duration, chunkSize int, pause time.Duration) error {
+	q.recordInput("text", text)
+
+	runes := []rune(text)
+	if chunkSize <= 0 {
+		chunkSize = len(runes)
+	}
+
+	for start := 0; start < len(runes); start += chunkSize {
+		end := start + chunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+
+		if err := q.typeText(string(runes[start:end]), delay); err != nil {
+			return fmt.Errorf("failed after %d of %d characters: %v", start, len(runes), err)
+		}
+
+		if end < len(runes) && pause > 0 {
+			q.log().Debug("Pausing between chunks", "typed", end, "total", len(runes), "pause", pause)
+			time.Sleep(pause)
+		}
+	}
+	return nil
+}
+
+// ParseRate converts a typing rate such as "200cps" (characters per second)
+// into the delay between key presses
+func ParseRate(rate string) (time.Duration, error) {
+	value := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(rate)), "cps")
+	cps, err := strconv.ParseFloat(value, 64)
+	if err != nil || cps <= 0 {
+		return 0, fmt.Errorf("invalid rate %q (use e.g. 200cps)", rate)
+	}
+	return time.Duration(float64(time.Second) / cps), nil
+}
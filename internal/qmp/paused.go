@@ -0,0 +1,32 @@
+package qmp
+
+import "fmt"
+
+// PausedVMError is returned when input was sent to a VM that is not running.
+// QEMU accepts key events for a paused VM but the guest never sees them.
+type PausedVMError struct {
+	VMID   string
+	Status string
+}
+
+// Error implements error
+func (e *PausedVMError) Error() string {
+	return fmt.Sprintf("VM %s is %s, so the guest is not receiving key presses; resume it (e.g. qmp raw %s '{\"execute\":\"cont\"}') and retry",
+		e.VMID, e.Status, e.VMID)
+}
+
+// CheckRunning returns a *PausedVMError when the VM is not running
+func (q *Client) CheckRunning() error {
+	status, err := q.QueryStatus()
+	if err != nil {
+		return fmt.Errorf("failed to verify the VM is running: %v", err)
+	}
+	if running, _ := status["running"].(bool); !running {
+		state, _ := status["status"].(string)
+		if state == "" {
+			state = "not running"
+		}
+		return &PausedVMError{VMID: q.vmid, Status: state}
+	}
+	return nil
+}
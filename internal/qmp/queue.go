@@ -0,0 +1,93 @@
+package qmp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jstein/qmp/internal/metrics"
+)
+
+// Priority orders work waiting for a managed connection. Lower values run
+// first, so key presses never queue behind screen captures or status polls.
+type Priority int
+
+const (
+	// PriorityInput is used for keyboard and mouse input
+	PriorityInput Priority = iota
+	// PriorityCapture is used for screendumps
+	PriorityCapture
+	// PriorityQuery is used for status queries and keepalive probes
+	PriorityQuery
+
+	priorityCount
+)
+
+// String returns a readable name for the priority
+func (p Priority) String() string {
+	switch p {
+	case PriorityInput:
+		return "input"
+	case PriorityCapture:
+		return "capture"
+	case PriorityQuery:
+		return "query"
+	default:
+		return "unknown"
+	}
+}
+
+// commandQueue admits at most maxInFlight callers at a time and hands free
+// slots to waiting callers in priority order (first come first served
+// within a priority)
+type commandQueue struct {
+	mu       sync.Mutex
+	inFlight int
+	waiting  [priorityCount][]chan struct{}
+}
+
+// acquire blocks until the caller may run
+func (cq *commandQueue) acquire(p Priority, maxInFlight int) {
+	if p < 0 || p >= priorityCount {
+		p = PriorityQuery
+	}
+	start := time.Now()
+	defer func() { metrics.QMPQueueWait.WithLabelValues(p.String()).Observe(time.Since(start).Seconds()) }()
+
+	cq.mu.Lock()
+	if cq.inFlight < max(maxInFlight, 1) && cq.queued() == 0 {
+		cq.inFlight++
+		cq.mu.Unlock()
+		return
+	}
+
+	ready := make(chan struct{})
+	cq.waiting[p] = append(cq.waiting[p], ready)
+	cq.mu.Unlock()
+	<-ready
+}
+
+// release frees a slot and passes it to the most urgent waiting caller
+func (cq *commandQueue) release(maxInFlight int) {
+	cq.mu.Lock()
+	defer cq.mu.Unlock()
+
+	cq.inFlight--
+	for p := range cq.waiting {
+		if len(cq.waiting[p]) > 0 && cq.inFlight < max(maxInFlight, 1) {
+			next := cq.waiting[p][0]
+			cq.waiting[p] = cq.waiting[p][1:]
+			cq.inFlight++
+			close(next)
+			return
+		}
+	}
+}
+
+// queued returns the number of waiting callers. The caller must hold cq.mu.
+func (cq *commandQueue) queued() int {
+	n := 0
+	for _, w := range cq.waiting {
+		n += len(w)
+	}
+	return n
+}
@@ -0,0 +1,28 @@
+package qmp
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ParseCommand parses a raw QMP command such as {"execute":"query-block"}
+func ParseCommand(data []byte) (Command, error) {
+	var cmd Command
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		return cmd, fmt.Errorf("invalid QMP command: %v", err)
+	}
+	if cmd.Execute == "" {
+		return cmd, fmt.Errorf("invalid QMP command: missing \"execute\"")
+	}
+	return cmd, nil
+}
+
+// Execute sends an arbitrary QMP command and returns its return value.
+// It covers QMP verbs the client has no wrapper for.
+func (q *Client) Execute(cmd Command) (interface{}, error) {
+	resp, err := q.sendCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Return, nil
+}
@@ -0,0 +1,35 @@
+package qmp
+
+// Recorder receives a copy of every input and screenshot sent through a client
+type Recorder interface {
+	RecordInput(vmid string, kind string, data interface{})
+	RecordScreenshot(vmid string, path string)
+}
+
+// SetRecorder sets the recorder notified of inputs and screenshots
+func (q *Client) SetRecorder(recorder Recorder) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.recorder = recorder
+}
+
+// getRecorder returns the recorder, if any
+func (q *Client) getRecorder() Recorder {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	return q.recorder
+}
+
+// recordInput forwards an input event to the recorder, if any
+func (q *Client) recordInput(kind string, data interface{}) {
+	if recorder := q.getRecorder(); recorder != nil {
+		recorder.RecordInput(q.vmid, kind, data)
+	}
+}
+
+// recordScreenshot forwards a screenshot to the recorder, if any
+func (q *Client) recordScreenshot(path string) {
+	if recorder := q.getRecorder(); recorder != nil {
+		recorder.RecordScreenshot(q.vmid, path)
+	}
+}
@@ -0,0 +1,139 @@
+package qmp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SetRemote makes the client reach the QMP socket on a remote hypervisor
+// (e.g. root@pve1) through an SSH tunnel. The remote host needs socat, which
+// Proxmox installs by default. Screenshots are copied back over SSH.
+func (q *Client) SetRemote(host string) {
+	q.remote = host
+}
+
+// dial connects to the QMP socket, tunnelling over SSH for remote hosts
+func (q *Client) dial(socketPath string) (net.Conn, error) {
+	if q.remote == "" {
+		return net.Dial("unix", socketPath)
+	}
+
+	// socat bridges the SSH session to the remote socket. Using the session's
+	// stdin/stdout means the tunnel ends as soon as this process exits.
+	cmd, err := q.sshCommand("socat - " + shellQuote("UNIX-CONNECT:"+socketPath))
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start SSH tunnel: %v", err)
+	}
+	q.log().Debug("Started SSH tunnel", "remote", q.remote, "socket", socketPath)
+
+	return &sshConn{cmd: cmd, stdin: stdin, stdout: stdout, remote: q.remote}, nil
+}
+
+// sshConn is a net.Conn over the stdin/stdout of an ssh process
+type sshConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	remote string
+}
+
+// sshAddr is the address of an SSH tunnel endpoint
+type sshAddr string
+
+// Network implements net.Addr
+func (a sshAddr) Network() string { return "ssh" }
+
+// String implements net.Addr
+func (a sshAddr) String() string { return string(a) }
+
+// Read implements net.Conn
+func (c *sshConn) Read(b []byte) (int, error) { return c.stdout.Read(b) }
+
+// Write implements net.Conn
+func (c *sshConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+
+// Close implements net.Conn
+func (c *sshConn) Close() error {
+	c.stdin.Close()
+	c.cmd.Process.Kill()
+	c.cmd.Wait()
+	return nil
+}
+
+// LocalAddr implements net.Conn
+func (c *sshConn) LocalAddr() net.Addr { return sshAddr("local") }
+
+// RemoteAddr implements net.Conn
+func (c *sshConn) RemoteAddr() net.Addr { return sshAddr(c.remote) }
+
+// SetDeadline implements net.Conn; deadlines are not supported
+func (c *sshConn) SetDeadline(t time.Time) error { return nil }
+
+// SetReadDeadline implements net.Conn; deadlines are not supported
+func (c *sshConn) SetReadDeadline(t time.Time) error { return nil }
+
+// SetWriteDeadline implements net.Conn; deadlines are not supported
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// remoteTempPath returns a temporary screendump path on the remote host
+func (q *Client) remoteTempPath(format string) string {
+	return fmt.Sprintf("/tmp/qmp-screendump-%s-%d.%s", q.vmid, time.Now().UnixNano(), format)
+}
+
+// fetchRemoteFile copies a file from the remote host to localPath and
+// removes the remote copy
+func (q *Client) fetchRemoteFile(remotePath string, localPath string) error {
+	quoted := shellQuote(remotePath)
+	cmd, err := q.sshCommand(fmt.Sprintf("cat %s && rm -f %s", quoted, quoted))
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(localPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer out.Close()
+
+	var stderr bytes.Buffer
+	cmd.Stdout = out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy %s from %s: %v %s", remotePath, q.remote, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// sshCommand returns an ssh command running command on the remote host.
+// ssh hands the command to the remote shell, so arguments in it must be
+// quoted with shellQuote.
+func (q *Client) sshCommand(command string) (*exec.Cmd, error) {
+	if strings.HasPrefix(q.remote, "-") {
+		return nil, fmt.Errorf("invalid remote host %q", q.remote)
+	}
+	return exec.Command("ssh", "-o", "BatchMode=yes", "--", q.remote, command), nil
+}
+
+// shellQuote quotes s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,81 @@
+package qmp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPressDuration is how long raw scancodes are held down by default
+const DefaultPressDuration = 100 * time.Millisecond
+
+// ParseScancodes parses hex XT scancodes such as "1d 38 53". Codes separated
+// by spaces form a chord pressed together; commas separate successive chords
+// ("1d 2e, 1c"). Extended keys use an e0 prefix ("e0 53" or "e053").
+func ParseScancodes(s string) ([][]int, error) {
+	var chords [][]int
+	for _, group := range strings.Split(s, ",") {
+		var chord []int
+		extended := false
+		for _, field := range strings.Fields(group) {
+			field = strings.TrimPrefix(strings.ToLower(field), "0x")
+			if field == "e0" {
+				extended = true
+				continue
+			}
+			if len(field) == 4 && strings.HasPrefix(field, "e0") {
+				extended, field = true, field[2:]
+			}
+
+			code, err := strconv.ParseUint(field, 16, 8)
+			if err != nil || code == 0 || code > 0x7f {
+				return nil, fmt.Errorf("invalid scancode %q", field)
+			}
+			// QEMU numbers extended keys by setting the high bit
+			if extended {
+				code |= 0x80
+				extended = false
+			}
+			chord = append(chord, int(code))
+		}
+		if extended {
+			return nil, fmt.Errorf("scancode prefix e0 must be followed by a scancode")
+		}
+		if len(chord) > 0 {
+			chords = append(chords, chord)
+		}
+	}
+	if len(chords) == 0 {
+		return nil, fmt.Errorf("no scancodes given")
+	}
+	return chords, nil
+}
+
+// numberKeys converts raw scancodes to input-send-event key values
+func numberKeys(codes []int) []map[string]interface{} {
+	keys := make([]map[string]interface{}, 0, len(codes))
+	for _, code := range codes {
+		keys = append(keys, map[string]interface{}{"type": "number", "data": code})
+	}
+	return keys
+}
+
+// SendScancodes presses each chord of raw scancodes, holds it for press and
+// releases it. This gives the precise press/release timing some firmware
+// (BIOS/UEFI setup, GRUB) needs.
+func (q *Client) SendScancodes(chords [][]int, press time.Duration) error {
+	q.recordInput("key", fmt.Sprintf("raw:%x", chords))
+
+	for _, chord := range chords {
+		keys := numberKeys(chord)
+		if err := q.sendKeyEvents(keys, true); err != nil {
+			return err
+		}
+		time.Sleep(press)
+		if err := q.sendKeyEvents(keys, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
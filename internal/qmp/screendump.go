@@ -0,0 +1,92 @@
+package qmp
+
+import (
+	"encoding/json"
+)
+
+// Screendump formats
+const (
+	FormatPPM = "ppm"
+	FormatPNG = "png"
+)
+
+// schemaEntry is the part of a query-qmp-schema entry needed to inspect
+// command arguments
+type schemaEntry struct {
+	Name     string `json:"name"`
+	MetaType string `json:"meta-type"`
+	ArgType  string `json:"arg-type"`
+	Members  []struct {
+		Name string `json:"name"`
+	} `json:"members"`
+}
+
+// SupportsPNGScreendump reports whether QEMU can write screendumps as PNG
+// (QEMU 7.1+). The schema is queried once per connection.
+func (q *Client) SupportsPNGScreendump() bool {
+	q.stateMu.Lock()
+	cached := q.pngScreendump
+	q.stateMu.Unlock()
+	if cached != nil {
+		return *cached
+	}
+
+	// The lock is not held during the query so input is not held up; two
+	// callers racing here both query and store the same answer
+	supported := q.screendumpHasFormat()
+	q.log().Debug("Detected screendump PNG support", "supported", supported)
+	q.stateMu.Lock()
+	q.pngScreendump = &supported
+	q.stateMu.Unlock()
+	return supported
+}
+
+// screendumpHasFormat checks the QMP schema for the screendump format argument
+func (q *Client) screendumpHasFormat() bool {
+	resp, err := q.sendCommand(Command{Execute: "query-qmp-schema"})
+	if err != nil {
+		q.log().Debug("query-qmp-schema failed, assuming PPM screendumps", "error", err)
+		return false
+	}
+
+	data, err := json.Marshal(resp.Return)
+	if err != nil {
+		return false
+	}
+	var schema []schemaEntry
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return false
+	}
+
+	// Type names are masked in the schema, so find the command's argument
+	// type first and then look up its members
+	argType := ""
+	for _, entry := range schema {
+		if entry.MetaType == "command" && entry.Name == "screendump" {
+			argType = entry.ArgType
+			break
+		}
+	}
+	if argType == "" {
+		return false
+	}
+	for _, entry := range schema {
+		if entry.Name != argType {
+			continue
+		}
+		for _, member := range entry.Members {
+			if member.Name == "format" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// screendumpFormat returns the format captures should be taken in
+func (q *Client) screendumpFormat() string {
+	if q.SupportsPNGScreendump() {
+		return FormatPNG
+	}
+	return FormatPPM
+}
@@ -0,0 +1,86 @@
+package qmp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Snapshot describes an internal VM snapshot as listed by "info snapshots"
+type Snapshot struct {
+	ID   string `json:"id"`
+	Tag  string `json:"tag"`
+	Info string `json:"info"`
+}
+
+// humanMonitorCommand runs an HMP command and returns its output. HMP
+// reports most failures as text rather than as a QMP error.
+func (q *Client) humanMonitorCommand(commandLine string) (string, error) {
+	cmd := Command{
+		Execute: "human-monitor-command",
+		Arguments: map[string]interface{}{
+			"command-line": commandLine,
+		},
+	}
+
+	resp, err := q.sendCommand(cmd)
+	if err != nil {
+		return "", err
+	}
+
+	output, _ := resp.Return.(string)
+	return output, nil
+}
+
+// snapshotCommand runs savevm/loadvm/delvm and turns error output into an error
+func (q *Client) snapshotCommand(command string, name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\"") {
+		return fmt.Errorf("invalid snapshot name %q", name)
+	}
+
+	output, err := q.humanMonitorCommand(command + " " + name)
+	if err != nil {
+		return err
+	}
+	if output = strings.TrimSpace(output); output != "" {
+		return fmt.Errorf("%s %s failed: %s", command, name, output)
+	}
+	return nil
+}
+
+// SaveSnapshot saves the full VM state (RAM and disks) as an internal snapshot
+func (q *Client) SaveSnapshot(name string) error {
+	return q.snapshotCommand("savevm", name)
+}
+
+// LoadSnapshot restores the VM to an internal snapshot
+func (q *Client) LoadSnapshot(name string) error {
+	return q.snapshotCommand("loadvm", name)
+}
+
+// DeleteSnapshot deletes an internal snapshot
+func (q *Client) DeleteSnapshot(name string) error {
+	return q.snapshotCommand("delvm", name)
+}
+
+// ListSnapshots returns the internal snapshots present on all disks
+func (q *Client) ListSnapshots() ([]Snapshot, error) {
+	output, err := q.humanMonitorCommand("info snapshots")
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := []Snapshot{}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		// Skip the title, the column header and blank lines
+		if len(fields) < 2 || fields[0] == "ID" || strings.HasPrefix(line, "List of") || strings.HasPrefix(line, "There is no") {
+			continue
+		}
+		snapshots = append(snapshots, Snapshot{
+			ID:   fields[0],
+			Tag:  fields[1],
+			Info: strings.Join(fields[2:], " "),
+		})
+	}
+	return snapshots, nil
+}
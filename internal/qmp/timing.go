@@ -0,0 +1,83 @@
+package qmp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimingProfile holds the key sending rates for one kind of guest. Firmware
+// and boot loaders poll the keyboard slowly and drop keys that arrive too
+// quickly, while a booted OS keeps up with much faster input.
+type TimingProfile struct {
+	Name string `json:"name"`
+	// KeyDelay is the pause between key presses
+	KeyDelay time.Duration `json:"key_delay"`
+	// HoldTime is how long each key or combination is held down
+	// (0 uses the QEMU default of 100ms)
+	HoldTime time.Duration `json:"hold_time"`
+	// ChunkSize is the number of characters typed before pausing (0 disables chunking)
+	ChunkSize int `json:"chunk_size"`
+	// ChunkPause is the pause between chunks
+	ChunkPause time.Duration `json:"chunk_pause"`
+}
+
+// DefaultTimingProfile is used when no profile is selected
+const DefaultTimingProfile = "os"
+
+// timingProfiles lists the built-in timing profiles
+var timingProfiles = map[string]TimingProfile{
+	"bios": {
+		Name:       "bios",
+		KeyDelay:   150 * time.Millisecond,
+		HoldTime:   200 * time.Millisecond,
+		ChunkSize:  16,
+		ChunkPause: 500 * time.Millisecond,
+	},
+	"grub": {
+		Name:       "grub",
+		KeyDelay:   100 * time.Millisecond,
+		HoldTime:   150 * time.Millisecond,
+		ChunkSize:  32,
+		ChunkPause: 300 * time.Millisecond,
+	},
+	"installer": {
+		Name:       "installer",
+		KeyDelay:   75 * time.Millisecond,
+		HoldTime:   100 * time.Millisecond,
+		ChunkSize:  64,
+		ChunkPause: 250 * time.Millisecond,
+	},
+	"os": {
+		Name:     "os",
+		KeyDelay: 50 * time.Millisecond,
+	},
+}
+
+// GetTimingProfile returns the built-in timing profile with the given name
+func GetTimingProfile(name string) (TimingProfile, error) {
+	profile, ok := timingProfiles[strings.ToLower(name)]
+	if !ok {
+		return TimingProfile{}, fmt.Errorf("unknown timing profile %q (available: %s)", name, strings.Join(TimingProfileNames(), ", "))
+	}
+	return profile, nil
+}
+
+// TimingProfileNames returns the names of all built-in timing profiles
+func TimingProfileNames() []string {
+	names := make([]string, 0, len(timingProfiles))
+	for name := range timingProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetHoldTime sets how long keys and combinations are held down.
+// A duration of 0 uses the QEMU default.
+func (q *Client) SetHoldTime(d time.Duration) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.holdTime = d
+}
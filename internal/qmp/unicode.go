@@ -0,0 +1,126 @@
+package qmp
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// UnicodeMode selects how characters missing from the keymap are typed
+type UnicodeMode string
+
+const (
+	// UnicodeSkip skips characters that cannot be typed and logs a warning
+	UnicodeSkip UnicodeMode = "skip"
+	// UnicodeCompose types characters as compose-key sequences (e.g. compose " o for ö)
+	UnicodeCompose UnicodeMode = "compose"
+	// UnicodeHex types characters with ctrl+shift+u hex entry (GTK/IBus)
+	UnicodeHex UnicodeMode = "hex"
+)
+
+// ParseUnicodeMode validates a unicode mode name
+func ParseUnicodeMode(name string) (UnicodeMode, error) {
+	switch mode := UnicodeMode(strings.ToLower(name)); mode {
+	case UnicodeSkip, UnicodeCompose, UnicodeHex:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown unicode mode %q (available: skip, compose, hex)", name)
+	}
+}
+
+// combiningCompose maps combining marks to the compose key character for the accent
+var combiningCompose = map[rune]rune{
+	'\u0300': '`',  // grave
+	'\u0301': '\'', // acute
+	'\u0302': '^',  // circumflex
+	'\u0303': '~',  // tilde
+	'\u0308': '"',  // diaeresis
+	'\u0327': ',',  // cedilla
+	'\u030a': 'o',  // ring above
+	'\u030c': 'c',  // caron
+}
+
+// composeSpecial lists compose sequences for characters without a decomposition
+var composeSpecial = map[rune]string{
+	'ß': "ss",
+	'æ': "ae",
+	'Æ': "AE",
+	'ø': "/o",
+	'Ø': "/O",
+	'œ': "oe",
+	'Œ': "OE",
+	'€': "=e",
+	'£': "-L",
+	'¥': "=Y",
+	'©': "oc",
+	'®': "or",
+	'°': "oo",
+	'¿': "??",
+	'¡': "!!",
+	'«': "<<",
+	'»': ">>",
+}
+
+// SetUnicodeMode sets how characters missing from the keymap are typed
+func (q *Client) SetUnicodeMode(mode UnicodeMode) {
+	q.stateMu.Lock()
+	defer q.stateMu.Unlock()
+	q.unicodeMode = mode
+}
+
+// composeSequence returns the characters typed after the compose key for r
+func composeSequence(r rune) (string, bool) {
+	if seq, ok := composeSpecial[r]; ok {
+		return seq, true
+	}
+
+	// Accented letters decompose into a base letter and a combining mark
+	decomposed := []rune(norm.NFD.String(string(r)))
+	if len(decomposed) != 2 {
+		return "", false
+	}
+	accent, ok := combiningCompose[decomposed[1]]
+	if !ok {
+		return "", false
+	}
+	return string([]rune{accent, decomposed[0]}), true
+}
+
+// sendUnicode types a character that is not on the guest keyboard layout
+func (q *Client) sendUnicode(r rune) error {
+	q.stateMu.Lock()
+	mode := q.unicodeMode
+	q.stateMu.Unlock()
+
+	switch mode {
+	case UnicodeCompose:
+		seq, ok := composeSequence(r)
+		if !ok {
+			break
+		}
+		if err := q.sendChord([]string{"compose"}); err != nil {
+			return err
+		}
+		for _, c := range seq {
+			if err := q.sendKey(string(c)); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case UnicodeHex:
+		if err := q.sendChord([]string{"ctrl", "shift", "u"}); err != nil {
+			return err
+		}
+		for _, c := range fmt.Sprintf("%x", r) {
+			if err := q.sendKey(string(c)); err != nil {
+				return err
+			}
+		}
+		return q.sendChord([]string{"spc"})
+	}
+
+	q.log().Warn("Skipping character that cannot be typed", "char", string(r), "codepoint", fmt.Sprintf("U+%04X", r), "mode", mode)
+	return nil
+}
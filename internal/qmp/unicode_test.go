@@ -0,0 +1,188 @@
+package qmp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jstein/qmp/internal/qmp/keymap"
+)
+
+func TestComposeSequence(t *testing.T) {
+	tests := []struct {
+		char rune
+		want string
+		ok   bool
+	}{
+		{'ö', `"o`, true},
+		{'é', "'e", true},
+		{'ñ', "~n", true},
+		{'Ç', ",C", true},
+		{'ß', "ss", true},
+		{'€', "=e", true},
+		{'─', "", false},
+		{'日', "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := composeSequence(tt.char)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("composeSequence(%q) = %q, %v; want %q, %v", tt.char, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseUnicodeMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    UnicodeMode
+		wantErr bool
+	}{
+		{"skip", UnicodeSkip, false},
+		{"compose", UnicodeCompose, false},
+		{"HEX", UnicodeHex, false},
+		{"", "", true},
+		{"ime", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseUnicodeMode(tt.name)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("ParseUnicodeMode(%q) = %q, %v; want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// fakeQMP answers every command on a client's socket and records the key
+// chords sent with send-key, joined with "+"
+type fakeQMP struct {
+	mu     sync.Mutex
+	chords []string
+}
+
+// newTestClient returns a client connected to a fake QMP server
+func newTestClient(t *testing.T, layout string, mode UnicodeMode) (*Client, *fakeQMP) {
+	t.Helper()
+
+	clientConn, serverConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+
+	fake := &fakeQMP{}
+	go func() {
+		decoder := json.NewDecoder(serverConn)
+		for {
+			var cmd struct {
+				Execute   string `json:"execute"`
+				Arguments struct {
+					Keys []struct {
+						Data string `json:"data"`
+					} `json:"keys"`
+				} `json:"arguments"`
+			}
+			if err := decoder.Decode(&cmd); err != nil {
+				return
+			}
+			if cmd.Execute == "send-key" {
+				var codes []string
+				for _, key := range cmd.Arguments.Keys {
+					codes = append(codes, key.Data)
+				}
+				fake.mu.Lock()
+				fake.chords = append(fake.chords, strings.Join(codes, "+"))
+				fake.mu.Unlock()
+			}
+			if _, err := serverConn.Write([]byte("{\"return\": {}}\n")); err != nil {
+				return
+			}
+		}
+	}()
+
+	client := &Client{session: &session{vmid: "test", conn: clientConn, reader: bufio.NewReader(clientConn)}}
+	km, err := keymap.Get(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetKeymap(km)
+	client.SetUnicodeMode(mode)
+	return client, fake
+}
+
+// sent returns the recorded chords
+func (f *fakeQMP) sent() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string{}, f.chords...)
+}
+
+func TestTypeMixedScriptLines(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		mode   UnicodeMode
+		text   string
+		want   []string
+	}{
+		{
+			name:   "compose on us layout",
+			layout: "us",
+			mode:   UnicodeCompose,
+			text:   "Añ─1",
+			want:   []string{"shift+a", "compose", "shift+grave_accent", "n", "1"},
+		},
+		{
+			name:   "hex entry on us layout",
+			layout: "us",
+			mode:   UnicodeHex,
+			text:   "aé",
+			want:   []string{"a", "ctrl+shift+u", "e", "9", "spc"},
+		},
+		{
+			name:   "skip on us layout",
+			layout: "us",
+			mode:   UnicodeSkip,
+			text:   "ö─ok",
+			want:   []string{"o", "k"},
+		},
+		{
+			name:   "layout characters need no strategy",
+			layout: "de",
+			mode:   UnicodeSkip,
+			text:   "zöß",
+			want:   []string{"y", "semicolon", "minus"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newTestClient(t, tt.layout, tt.mode)
+			if err := client.SendString(tt.text, 0); err != nil {
+				t.Fatalf("SendString(%q) failed: %v", tt.text, err)
+			}
+			if got := fake.sent(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SendString(%q) sent %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestComboUsesUnicodeMode(t *testing.T) {
+	client, fake := newTestClient(t, "us", UnicodeCompose)
+
+	// A lone character is typed the same way as in text
+	if err := client.SendCombo("ö"); err != nil {
+		t.Fatalf("SendCombo(ö) failed: %v", err)
+	}
+	want := []string{"compose", "shift+apostrophe", "o"}
+	if got := fake.sent(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SendCombo(ö) sent %q, want %q", got, want)
+	}
+
+	// In a combination it cannot be, so it is an error rather than a bad qcode
+	if _, err := client.comboCodes("ctrl+ö"); err == nil {
+		t.Errorf("comboCodes(ctrl+ö) succeeded, want an error")
+	}
+}
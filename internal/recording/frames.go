@@ -0,0 +1,48 @@
+package recording
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Frame is a screenshot of a session with the inputs that led up to it
+type Frame struct {
+	// Image is the path of the screenshot
+	Image string
+	// Caption describes the keys, text and script lines since the previous screenshot
+	Caption string
+	// Duration is how long the screen was shown in the session
+	Duration time.Duration
+}
+
+// lastFrameDuration is how long the final screenshot is shown
+const lastFrameDuration = 2 * time.Second
+
+// Frames builds the screenshot series of a session loaded from dir
+func Frames(dir string, events []Event) []Frame {
+	var frames []Frame
+	var inputs []string
+	var shownAt time.Time
+
+	for _, event := range events {
+		switch event.Type {
+		case EventKey, EventText, EventLine:
+			inputs = append(inputs, event.Describe())
+		case EventScreenshot:
+			if len(frames) > 0 {
+				frames[len(frames)-1].Duration = event.Time.Sub(shownAt)
+			}
+			frames = append(frames, Frame{
+				Image:   filepath.Join(dir, event.Image),
+				Caption: strings.Join(inputs, " | "),
+			})
+			inputs, shownAt = nil, event.Time
+		}
+	}
+
+	if len(frames) > 0 {
+		frames[len(frames)-1].Duration = lastFrameDuration
+	}
+	return frames
+}
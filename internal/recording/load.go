@@ -0,0 +1,56 @@
+package recording
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Load reads all events from a session directory
+func Load(dir string) ([]Event, error) {
+	file, err := os.Open(filepath.Join(dir, SessionFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session: %v", err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid event on line %d: %v", lineNum, err)
+		}
+		events = append(events, event)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read session: %v", err)
+	}
+	return events, nil
+}
+
+// Describe returns a one-line human readable summary of an event
+func (e Event) Describe() string {
+	switch e.Type {
+	case EventKey:
+		return fmt.Sprintf("key %v", e.Data)
+	case EventText:
+		return fmt.Sprintf("text %q", e.Data)
+	case EventMouse:
+		return "mouse input"
+	case EventScreenshot:
+		return fmt.Sprintf("screenshot %s", e.Image)
+	case EventLine:
+		return fmt.Sprintf("line %d: %v", e.Line, e.Data)
+	case EventStart:
+		return "session started"
+	default:
+		return fmt.Sprintf("%s %v", e.Type, e.Data)
+	}
+}
@@ -0,0 +1,180 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionFile is the name of the event log inside a session directory
+const SessionFile = "session.jsonl"
+
+// ScreenshotDir is the directory inside a session that holds screenshots
+const ScreenshotDir = "screenshots"
+
+// Event types
+const (
+	EventStart      = "start"
+	EventKey        = "key"
+	EventText       = "text"
+	EventMouse      = "mouse"
+	EventScreenshot = "screenshot"
+	EventLine       = "line"
+	EventError      = "error"
+)
+
+// Event is a single entry in a session log
+type Event struct {
+	Seq     int           `json:"seq"`
+	Time    time.Time     `json:"time"`
+	Elapsed time.Duration `json:"elapsed_ns"`
+	Type    string        `json:"type"`
+	VMID    string        `json:"vmid,omitempty"`
+	// Data holds the type-specific payload (key name, text, mouse events, ...)
+	Data interface{} `json:"data,omitempty"`
+	// Image is the screenshot path relative to the session directory
+	Image string `json:"image,omitempty"`
+	// Line is the script line number for line events
+	Line int `json:"line,omitempty"`
+}
+
+// Recorder writes session events to a JSONL file and keeps copies of
+// every screenshot in the session directory
+type Recorder struct {
+	dir   string
+	file  *os.File
+	start time.Time
+
+	mu      sync.Mutex
+	seq     int
+	secrets []string
+}
+
+// SecretMask replaces secret values in recorded events
+const SecretMask = "****"
+
+// New creates a session directory and starts recording into it
+func New(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(filepath.Join(dir, ScreenshotDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create session directory: %v", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, SessionFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session file: %v", err)
+	}
+
+	r := &Recorder{dir: dir, file: file, start: time.Now()}
+	r.Record(Event{Type: EventStart, Data: map[string]interface{}{"args": os.Args}})
+	return r, nil
+}
+
+// Dir returns the session directory
+func (r *Recorder) Dir() string {
+	return r.dir
+}
+
+// Record appends an event to the session log
+func (r *Recorder) Record(event Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.write(event)
+}
+
+// AddSecret registers a value that is masked in every recorded event
+func (r *Recorder) AddSecret(value string) {
+	if value == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.secrets {
+		if s == value {
+			return
+		}
+	}
+	r.secrets = append(r.secrets, value)
+}
+
+// mask replaces registered secrets in string payloads. The caller must hold r.mu.
+func (r *Recorder) mask(data interface{}) interface{} {
+	text, ok := data.(string)
+	if !ok {
+		return data
+	}
+	for _, secret := range r.secrets {
+		text = strings.ReplaceAll(text, secret, SecretMask)
+	}
+	return text
+}
+
+// write fills in bookkeeping fields and writes the event. The caller must hold r.mu.
+func (r *Recorder) write(event Event) error {
+	event.Data = r.mask(event.Data)
+	r.seq++
+	event.Seq = r.seq
+	event.Time = time.Now()
+	event.Elapsed = event.Time.Sub(r.start)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	if _, err := r.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write event: %v", err)
+	}
+	return nil
+}
+
+// RecordInput records a key, text or mouse input sent to a VM
+func (r *Recorder) RecordInput(vmid string, kind string, data interface{}) {
+	r.Record(Event{Type: kind, VMID: vmid, Data: data})
+}
+
+// RecordScreenshot copies a screenshot into the session and records it
+func (r *Recorder) RecordScreenshot(vmid string, path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := filepath.Join(ScreenshotDir, fmt.Sprintf("%06d%s", r.seq+1, filepath.Ext(path)))
+	if err := copyFile(path, filepath.Join(r.dir, name)); err != nil {
+		r.write(Event{Type: EventError, VMID: vmid, Data: fmt.Sprintf("failed to record screenshot: %v", err)})
+		return
+	}
+
+	r.write(Event{Type: EventScreenshot, VMID: vmid, Image: name})
+}
+
+// RecordLine records a script line being executed
+func (r *Recorder) RecordLine(vmid string, line int, text string) {
+	r.Record(Event{Type: EventLine, VMID: vmid, Line: line, Data: text})
+}
+
+// Close stops recording
+func (r *Recorder) Close() error {
+	return r.file.Close()
+}
+
+// copyFile copies src to dst
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
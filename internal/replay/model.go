@@ -0,0 +1,282 @@
+package replay
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/jstein/qmp/internal/recording"
+)
+
+// speeds are the available playback speed multipliers
+var speeds = []float64{0.25, 0.5, 1, 2, 4, 8, 16}
+
+var (
+	titleStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("13"))
+	selectedStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("0")).Background(lipgloss.Color("14"))
+	dimStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	panelStyle    = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	statusStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("10"))
+)
+
+// tickMsg advances playback by one event
+type tickMsg struct{}
+
+// Model is the bubbletea model for the session timeline
+type Model struct {
+	dir    string
+	events []Event
+
+	cursor  int
+	playing bool
+	speed   int
+	status  string
+
+	width  int
+	height int
+}
+
+// Event is a session event as shown in the timeline
+type Event = recording.Event
+
+// New creates a timeline model for the events of a session
+func New(dir string, events []Event) Model {
+	return Model{
+		dir:    dir,
+		events: events,
+		speed:  2, // 1x
+	}
+}
+
+// Init implements tea.Model
+func (m Model) Init() tea.Cmd {
+	return nil
+}
+
+// Update implements tea.Model
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case tickMsg:
+		if !m.playing {
+			return m, nil
+		}
+		if m.cursor >= len(m.events)-1 {
+			m.playing = false
+			m.status = "End of session"
+			return m, nil
+		}
+		m.cursor++
+		return m, m.scheduleNext()
+
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c", "esc":
+			return m, tea.Quit
+		case "right", "l", "j", "down":
+			m.move(1)
+		case "left", "h", "k", "up":
+			m.move(-1)
+		case "pgdown":
+			m.move(10)
+		case "pgup":
+			m.move(-10)
+		case "home", "g":
+			m.cursor = 0
+		case "end", "G":
+			m.cursor = len(m.events) - 1
+		case "n":
+			m.jumpToScreenshot(1)
+		case "p":
+			m.jumpToScreenshot(-1)
+		case "+", "=":
+			if m.speed < len(speeds)-1 {
+				m.speed++
+			}
+		case "-":
+			if m.speed > 0 {
+				m.speed--
+			}
+		case " ":
+			m.playing = !m.playing
+			if m.playing {
+				m.status = "Playing"
+				return m, m.scheduleNext()
+			}
+			m.status = "Paused"
+		case "e":
+			m.status = m.exportFrame()
+		}
+	}
+
+	return m, nil
+}
+
+// move moves the cursor by delta events
+func (m *Model) move(delta int) {
+	m.cursor += delta
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+	if m.cursor > len(m.events)-1 {
+		m.cursor = len(m.events) - 1
+	}
+}
+
+// jumpToScreenshot moves to the next or previous screenshot event
+func (m *Model) jumpToScreenshot(direction int) {
+	for i := m.cursor + direction; i >= 0 && i < len(m.events); i += direction {
+		if m.events[i].Type == recording.EventScreenshot {
+			m.cursor = i
+			return
+		}
+	}
+}
+
+// scheduleNext waits for the recorded gap to the next event, scaled by speed
+func (m Model) scheduleNext() tea.Cmd {
+	if m.cursor >= len(m.events)-1 {
+		return func() tea.Msg { return tickMsg{} }
+	}
+
+	gap := m.events[m.cursor+1].Elapsed - m.events[m.cursor].Elapsed
+	gap = time.Duration(float64(gap) / speeds[m.speed])
+	if gap < 0 {
+		gap = 0
+	}
+	// Cap long idle gaps so playback never appears stuck
+	if gap > 5*time.Second {
+		gap = 5 * time.Second
+	}
+
+	return tea.Tick(gap, func(time.Time) tea.Msg { return tickMsg{} })
+}
+
+// currentScreenshot returns the latest screenshot at or before the cursor
+func (m Model) currentScreenshot() (Event, bool) {
+	for i := m.cursor; i >= 0; i-- {
+		if m.events[i].Type == recording.EventScreenshot {
+			return m.events[i], true
+		}
+	}
+	return Event{}, false
+}
+
+// exportFrame copies the current screenshot to the working directory
+func (m Model) exportFrame() string {
+	shot, ok := m.currentScreenshot()
+	if !ok {
+		return "No screenshot at this point"
+	}
+
+	src := filepath.Join(m.dir, shot.Image)
+	dst := fmt.Sprintf("frame-%06d%s", shot.Seq, filepath.Ext(shot.Image))
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Sprintf("Export failed: %v", err)
+	}
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		return fmt.Sprintf("Export failed: %v", err)
+	}
+	return fmt.Sprintf("Exported %s", dst)
+}
+
+// View implements tea.Model
+func (m Model) View() string {
+	if len(m.events) == 0 {
+		return "Session is empty\n"
+	}
+
+	var b strings.Builder
+	current := m.events[m.cursor]
+	total := m.events[len(m.events)-1].Elapsed
+
+	b.WriteString(titleStyle.Render(fmt.Sprintf("Session %s", m.dir)))
+	b.WriteString(fmt.Sprintf("  event %d/%d  %s / %s  speed %gx\n",
+		m.cursor+1, len(m.events), formatElapsed(current.Elapsed), formatElapsed(total), speeds[m.speed]))
+	b.WriteString(progressBar(m.cursor, len(m.events), m.barWidth()) + "\n")
+
+	// Timeline window around the cursor
+	rows := m.listHeight()
+	start := m.cursor - rows/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + rows
+	if end > len(m.events) {
+		end = len(m.events)
+		start = end - rows
+		if start < 0 {
+			start = 0
+		}
+	}
+
+	var list strings.Builder
+	for i := start; i < end; i++ {
+		e := m.events[i]
+		line := fmt.Sprintf("%10s  %-10s %s", formatElapsed(e.Elapsed), e.Type, e.Describe())
+		if m.width > 8 && len(line) > m.width-6 {
+			line = line[:m.width-6]
+		}
+		if i == m.cursor {
+			list.WriteString(selectedStyle.Render(line))
+		} else {
+			list.WriteString(line)
+		}
+		list.WriteString("\n")
+	}
+	b.WriteString(panelStyle.Render(strings.TrimRight(list.String(), "\n")) + "\n")
+
+	// Details for the selected event
+	details := fmt.Sprintf("Type: %s\nTime: %s\nData: %v", current.Type, current.Time.Format(time.RFC3339Nano), current.Data)
+	if shot, ok := m.currentScreenshot(); ok {
+		details += fmt.Sprintf("\nScreen: %s", filepath.Join(m.dir, shot.Image))
+	}
+	b.WriteString(panelStyle.Render(details) + "\n")
+
+	if m.status != "" {
+		b.WriteString(statusStyle.Render(m.status) + "\n")
+	}
+	b.WriteString(dimStyle.Render("←/→ step  pgup/pgdn jump  n/p screenshots  space play/pause  +/- speed  e export frame  q quit"))
+	return b.String()
+}
+
+// listHeight returns how many timeline rows fit on screen
+func (m Model) listHeight() int {
+	if m.height == 0 {
+		return 15
+	}
+	rows := m.height - 14
+	if rows < 5 {
+		rows = 5
+	}
+	return rows
+}
+
+// barWidth returns the width of the progress bar
+func (m Model) barWidth() int {
+	if m.width < 20 {
+		return 40
+	}
+	return m.width - 4
+}
+
+// progressBar renders the playback position
+func progressBar(pos int, total int, width int) string {
+	filled := 0
+	if total > 1 {
+		filled = pos * width / (total - 1)
+	}
+	return strings.Repeat("█", filled) + dimStyle.Render(strings.Repeat("░", width-filled))
+}
+
+// formatElapsed formats an offset from the start of the session
+func formatElapsed(d time.Duration) string {
+	return d.Truncate(time.Millisecond).String()
+}
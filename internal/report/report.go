@@ -0,0 +1,127 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jstein/qmp/internal/script"
+)
+
+// Supported report formats
+const (
+	FormatJUnit = "junit"
+	FormatTAP   = "tap"
+)
+
+// FormatForFile picks a report format from the file extension
+func FormatForFile(filename string) string {
+	if strings.EqualFold(filepath.Ext(filename), ".tap") {
+		return FormatTAP
+	}
+	return FormatJUnit
+}
+
+// WriteFile writes a script result to filename in the given format
+func WriteFile(filename string, format string, name string, result *script.Result) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %v", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case FormatJUnit:
+		return WriteJUnit(file, name, result)
+	case FormatTAP:
+		return WriteTAP(file, result)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// junitSuite is the <testsuite> element of a JUnit report
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+// junitCase is a <testcase> element of a JUnit report
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+// junitFailure is a <failure> element of a JUnit report
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes a JUnit XML report with one test case per script line
+func WriteJUnit(w io.Writer, name string, result *script.Result) error {
+	suite := junitSuite{
+		Name:     name,
+		Tests:    len(result.Steps),
+		Failures: len(result.Errors),
+		Time:     fmt.Sprintf("%.3f", result.Duration.Seconds()),
+	}
+
+	for _, step := range result.Steps {
+		tc := junitCase{
+			Name:      stepName(step),
+			ClassName: name,
+			Time:      fmt.Sprintf("%.3f", step.Duration.Seconds()),
+		}
+		if step.Error != "" {
+			tc.Failure = &junitFailure{Message: step.Error, Text: step.Error}
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(suite); err != nil {
+		return fmt.Errorf("failed to encode JUnit report: %v", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteTAP writes a TAP version 13 report with one test point per script line
+func WriteTAP(w io.Writer, result *script.Result) error {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(result.Steps))
+	for i, step := range result.Steps {
+		status := "ok"
+		if step.Error != "" {
+			status = "not ok"
+		}
+		fmt.Fprintf(w, "%s %d - %s\n", status, i+1, stepName(step))
+		if step.Error != "" {
+			fmt.Fprintf(w, "  ---\n  message: %q\n  line: %d\n  duration_ms: %d\n  ...\n",
+				step.Error, step.Line, step.Duration.Milliseconds())
+		}
+	}
+	if result.Aborted {
+		_, err := fmt.Fprintln(w, "Bail out! Script aborted by a failed assertion")
+		return err
+	}
+	return nil
+}
+
+// stepName returns a readable test name for a script line
+func stepName(step script.Step) string {
+	return fmt.Sprintf("line %d: %s", step.Line, step.Text)
+}
@@ -0,0 +1,52 @@
+package screen
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// captionHeight is the height of the caption bar added below an image
+const captionHeight = 20
+
+// Caption returns a copy of img with a bar below it showing text.
+// Text that does not fit is cut off with an ellipsis.
+func Caption(img image.Image, text string) image.Image {
+	bounds := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()+captionHeight))
+	draw.Draw(out, out.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.Draw(out, image.Rect(0, 0, bounds.Dx(), bounds.Dy()), img, bounds.Min, draw.Src)
+
+	face := basicfont.Face7x13
+	maxChars := (bounds.Dx() - 8) / face.Advance
+	if runes := []rune(text); maxChars > 0 && len(runes) > maxChars {
+		text = string(runes[:maxChars-1]) + "…"
+	}
+
+	drawer := &font.Drawer{
+		Dst:  out,
+		Src:  image.NewUniform(color.RGBA{255, 255, 0, 255}),
+		Face: face,
+		Dot:  fixed.P(4, bounds.Dy()+captionHeight-6),
+	}
+	drawer.DrawString(text)
+	return out
+}
+
+// PadToSize places img in the top left corner of a black width x height
+// canvas, so frames of different resolutions can be animated together
+func PadToSize(img image.Image, width int, height int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() == width && bounds.Dy() == height {
+		return img
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(out, out.Bounds(), image.Black, image.Point{}, draw.Src)
+	draw.Draw(out, image.Rect(0, 0, bounds.Dx(), bounds.Dy()), img, bounds.Min, draw.Src)
+	return out
+}
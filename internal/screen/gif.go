@@ -0,0 +1,57 @@
+package screen
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"time"
+)
+
+// SaveGIF writes frames as an animated GIF, showing each frame for delay
+func SaveGIF(frames []image.Image, delay time.Duration, filename string) error {
+	delays := make([]time.Duration, len(frames))
+	for i := range delays {
+		delays[i] = delay
+	}
+	return SaveGIFWithDelays(frames, delays, filename)
+}
+
+// SaveGIFWithDelays writes frames as an animated GIF, showing each frame
+// for its own delay
+func SaveGIFWithDelays(frames []image.Image, delays []time.Duration, filename string) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frames to encode")
+	}
+	if len(delays) != len(frames) {
+		return fmt.Errorf("got %d delays for %d frames", len(delays), len(frames))
+	}
+
+	anim := &gif.GIF{}
+	for i, frame := range frames {
+		// GIF delays are in hundredths of a second
+		centiseconds := int(delays[i] / (10 * time.Millisecond))
+		if centiseconds < 1 {
+			centiseconds = 1
+		}
+
+		bounds := frame.Bounds()
+		paletted := image.NewPaletted(bounds, palette.Plan9)
+		draw.FloydSteinberg.Draw(paletted, bounds, frame, bounds.Min)
+		anim.Image = append(anim.Image, paletted)
+		anim.Delay = append(anim.Delay, centiseconds)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	if err := gif.EncodeAll(file, anim); err != nil {
+		return fmt.Errorf("failed to encode GIF: %v", err)
+	}
+	return nil
+}
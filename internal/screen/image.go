@@ -0,0 +1,160 @@
+package screen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+)
+
+// DecodePPM decodes a binary (P6) PPM image as produced by QEMU screendump
+func DecodePPM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+
+	var magic string
+	var width, height, maxVal int
+	if _, err := fmt.Fscan(br, &magic); err != nil {
+		return nil, fmt.Errorf("failed to read PPM header: %v", err)
+	}
+	if magic != "P6" {
+		return nil, fmt.Errorf("unsupported PPM format %q", magic)
+	}
+
+	// Header values may be separated by comments
+	values := make([]int, 0, 3)
+	for len(values) < 3 {
+		token, err := readPPMToken(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read PPM header: %v", err)
+		}
+		var v int
+		if _, err := fmt.Sscan(token, &v); err != nil {
+			return nil, fmt.Errorf("invalid PPM header value %q", token)
+		}
+		values = append(values, v)
+	}
+	width, height, maxVal = values[0], values[1], values[2]
+	if maxVal <= 0 || maxVal > 255 {
+		return nil, fmt.Errorf("unsupported PPM max value %d", maxVal)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	row := make([]byte, width*3)
+	for y := 0; y < height; y++ {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, fmt.Errorf("failed to read PPM pixels: %v", err)
+		}
+		for x := 0; x < width; x++ {
+			offset := img.PixOffset(x, y)
+			img.Pix[offset] = row[x*3]
+			img.Pix[offset+1] = row[x*3+1]
+			img.Pix[offset+2] = row[x*3+2]
+			img.Pix[offset+3] = 255
+		}
+	}
+
+	return img, nil
+}
+
+// readPPMToken reads the next whitespace-separated header token, skipping comments.
+// It consumes exactly one whitespace character after the token.
+func readPPMToken(br *bufio.Reader) (string, error) {
+	var token strings.Builder
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case b == '#':
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r':
+			if token.Len() > 0 {
+				return token.String(), nil
+			}
+		default:
+			token.WriteByte(b)
+		}
+	}
+}
+
+// LoadImage loads a PPM or PNG image from a file
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+
+	return DecodeImage(file, path)
+}
+
+// DecodeImage decodes a PPM or PNG image; name selects PPM by extension
+func DecodeImage(r io.Reader, name string) (image.Image, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".ppm") {
+		return DecodePPM(r)
+	}
+
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return img, nil
+}
+
+// Crop returns the part of img inside rect, re-based at the origin
+func Crop(img image.Image, rect image.Rectangle) (image.Image, error) {
+	if !rect.In(img.Bounds()) {
+		return nil, fmt.Errorf("region %v is outside the %dx%d screen", rect, img.Bounds().Dx(), img.Bounds().Dy())
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			out.Set(x, y, img.At(rect.Min.X+x, rect.Min.Y+y))
+		}
+	}
+	return out, nil
+}
+
+// Compare returns the fraction (0..1) of pixels that differ between two
+// images of the same size. A pixel differs when any channel differs by
+// more than threshold (0..255).
+func Compare(a image.Image, b image.Image, threshold int) (float64, error) {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return 0, fmt.Errorf("image sizes differ: %dx%d vs %dx%d",
+			a.Bounds().Dx(), a.Bounds().Dy(), b.Bounds().Dx(), b.Bounds().Dy())
+	}
+
+	width, height := a.Bounds().Dx(), a.Bounds().Dy()
+	if width == 0 || height == 0 {
+		return 0, nil
+	}
+
+	different := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ca := color.RGBAModel.Convert(a.At(a.Bounds().Min.X+x, a.Bounds().Min.Y+y)).(color.RGBA)
+			cb := color.RGBAModel.Convert(b.At(b.Bounds().Min.X+x, b.Bounds().Min.Y+y)).(color.RGBA)
+			if channelDiff(ca.R, cb.R) > threshold || channelDiff(ca.G, cb.G) > threshold || channelDiff(ca.B, cb.B) > threshold {
+				different++
+			}
+		}
+	}
+
+	return float64(different) / float64(width*height), nil
+}
+
+// channelDiff returns the absolute difference of two channel values
+func channelDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
@@ -0,0 +1,77 @@
+package screen
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Region is a rectangle of character cells. End values are exclusive.
+type Region struct {
+	StartRow, EndRow int
+	StartCol, EndCol int
+}
+
+// ParseRange parses a "start:end" cell range
+func ParseRange(s string) (int, int, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q (use START:END)", s)
+	}
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range start %q", parts[0])
+	}
+	end, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid range end %q", parts[1])
+	}
+	if start < 0 || end <= start {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return start, end, nil
+}
+
+// ParseRegion parses row and column ranges such as "10:20" and "5:40"
+func ParseRegion(rows string, cols string) (Region, error) {
+	var r Region
+	var err error
+	if r.StartRow, r.EndRow, err = ParseRange(rows); err != nil {
+		return r, err
+	}
+	if r.StartCol, r.EndCol, err = ParseRange(cols); err != nil {
+		return r, err
+	}
+	return r, nil
+}
+
+// ParseCellSize parses a cell size such as "8x16"
+func ParseCellSize(s string) (int, int, error) {
+	var width, height int
+	if _, err := fmt.Sscanf(s, "%dx%d", &width, &height); err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid cell size %q (use WIDTHxHEIGHT)", s)
+	}
+	return width, height, nil
+}
+
+// Pixels converts the region to a pixel rectangle for the given cell size
+func (r Region) Pixels(cellWidth int, cellHeight int) image.Rectangle {
+	return image.Rect(r.StartCol*cellWidth, r.StartRow*cellHeight, r.EndCol*cellWidth, r.EndRow*cellHeight)
+}
+
+// ParseTolerance parses a tolerance such as "2%" or "0.02" into a fraction
+func ParseTolerance(s string) (float64, error) {
+	percent := strings.HasSuffix(s, "%")
+	value, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid tolerance %q", s)
+	}
+	if percent {
+		value /= 100
+	}
+	if value < 0 || value > 1 {
+		return 0, fmt.Errorf("tolerance %q out of range", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,54 @@
+package screen
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+)
+
+// SaveImage writes a captured image to a file in PPM or PNG format
+func SaveImage(img image.Image, filename string, format string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "png":
+		if err := png.Encode(file, img); err != nil {
+			return fmt.Errorf("failed to encode PNG: %v", err)
+		}
+	case "ppm":
+		if err := writePPM(file, img); err != nil {
+			return fmt.Errorf("failed to encode PPM: %v", err)
+		}
+	default:
+		return fmt.Errorf("unsupported image format: %s", format)
+	}
+
+	return nil
+}
+
+// writePPM encodes an image as a binary (P6) PPM
+func writePPM(f *os.File, img image.Image) error {
+	bounds := img.Bounds()
+	w := bufio.NewWriter(f)
+
+	if _, err := fmt.Fprintf(w, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy()); err != nil {
+		return err
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			if _, err := w.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.Flush()
+}
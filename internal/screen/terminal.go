@@ -0,0 +1,54 @@
+package screen
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+)
+
+// RenderANSI draws img scaled to fit within cols x rows terminal cells using
+// 24-bit colour half blocks (two pixels per cell, one above the other)
+func RenderANSI(img image.Image, cols int, rows int) string {
+	bounds := img.Bounds()
+	if cols <= 0 || rows <= 0 || bounds.Empty() {
+		return ""
+	}
+
+	// Keep the aspect ratio; each cell holds a 1x2 block of pixels
+	scale := float64(cols) / float64(bounds.Dx())
+	if s := float64(rows*2) / float64(bounds.Dy()); s < scale {
+		scale = s
+	}
+	width := max(1, int(float64(bounds.Dx())*scale))
+	height := max(2, int(float64(bounds.Dy())*scale)/2*2)
+
+	sample := func(x, y int) color.RGBA {
+		sx := bounds.Min.X + x*bounds.Dx()/width
+		sy := bounds.Min.Y + y*bounds.Dy()/height
+		r, g, b, _ := img.At(sx, sy).RGBA()
+		return color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), 255}
+	}
+
+	var sb strings.Builder
+	for y := 0; y < height; y += 2 {
+		var lastTop, lastBottom color.RGBA
+		for x := 0; x < width; x++ {
+			top, bottom := sample(x, y), sample(x, y+1)
+			// Only emit colour codes when they change to keep frames small
+			if x == 0 || top != lastTop {
+				fmt.Fprintf(&sb, "\x1b[38;2;%d;%d;%dm", top.R, top.G, top.B)
+			}
+			if x == 0 || bottom != lastBottom {
+				fmt.Fprintf(&sb, "\x1b[48;2;%d;%d;%dm", bottom.R, bottom.G, bottom.B)
+			}
+			sb.WriteString("▀")
+			lastTop, lastBottom = top, bottom
+		}
+		sb.WriteString("\x1b[0m")
+		if y+2 < height {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,67 @@
+package screen
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Zones maps names to screen regions, e.g. a status bar or prompt line
+type Zones map[string]Region
+
+// zoneSpec is a zone as written in a zones file
+type zoneSpec struct {
+	Rows string `yaml:"rows"`
+	Cols string `yaml:"cols"`
+}
+
+// LoadZones reads a YAML zones file:
+//
+//	statusbar:
+//	  rows: "0:1"
+//	  cols: "0:80"
+func LoadZones(filename string) (Zones, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zones file: %v", err)
+	}
+
+	specs := map[string]zoneSpec{}
+	if err := yaml.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse zones file %s: %v", filename, err)
+	}
+
+	zones := Zones{}
+	for name, spec := range specs {
+		region, err := ParseRegion(spec.Rows, spec.Cols)
+		if err != nil {
+			return nil, fmt.Errorf("zone %q: %v", name, err)
+		}
+		zones[name] = region
+	}
+	return zones, nil
+}
+
+// Get returns the named zone
+func (z Zones) Get(name string) (Region, error) {
+	region, ok := z[name]
+	if !ok {
+		if len(z) == 0 {
+			return Region{}, fmt.Errorf("unknown zone %q (no zones file loaded)", name)
+		}
+		return Region{}, fmt.Errorf("unknown zone %q (available: %v)", name, z.Names())
+	}
+	return region, nil
+}
+
+// Names returns the zone names in sorted order
+func (z Zones) Names() []string {
+	names := make([]string, 0, len(z))
+	for name := range z {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
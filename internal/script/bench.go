@@ -0,0 +1,102 @@
+package script
+
+import (
+	"sort"
+	"time"
+)
+
+// BenchSummary summarises repeated runs of a script
+type BenchSummary struct {
+	Iterations  int             `json:"iterations"`
+	Successes   int             `json:"successes"`
+	SuccessRate float64         `json:"success_rate"`
+	Durations   []time.Duration `json:"durations_ns"`
+	Min         time.Duration   `json:"min_ns"`
+	Mean        time.Duration   `json:"mean_ns"`
+	Median      time.Duration   `json:"median_ns"`
+	P95         time.Duration   `json:"p95_ns"`
+	Max         time.Duration   `json:"max_ns"`
+	// FailingLines lists every line that failed at least once
+	FailingLines []LineStats `json:"failing_lines"`
+}
+
+// LineStats counts the failures of one script line across runs
+type LineStats struct {
+	Line      int    `json:"line"`
+	Text      string `json:"text"`
+	Directive string `json:"directive"`
+	Runs      int    `json:"runs"`
+	Failures  int    `json:"failures"`
+	// Flaky is set when the line both failed and succeeded
+	Flaky bool `json:"flaky"`
+}
+
+// Summarize computes success rate, duration distribution and failing lines
+// for a set of runs of the same script
+func Summarize(results []*Result) *BenchSummary {
+	summary := &BenchSummary{
+		Iterations:   len(results),
+		Durations:    []time.Duration{},
+		FailingLines: []LineStats{},
+	}
+	if len(results) == 0 {
+		return summary
+	}
+
+	lines := map[int]*LineStats{}
+	var total time.Duration
+	for _, result := range results {
+		if result.Success {
+			summary.Successes++
+		}
+		summary.Durations = append(summary.Durations, result.Duration)
+		total += result.Duration
+
+		for _, step := range result.Steps {
+			stats, ok := lines[step.Line]
+			if !ok {
+				stats = &LineStats{Line: step.Line, Text: step.Text, Directive: step.Directive}
+				lines[step.Line] = stats
+			}
+			stats.Runs++
+			if step.Error != "" {
+				stats.Failures++
+			}
+		}
+	}
+
+	summary.SuccessRate = float64(summary.Successes) / float64(len(results))
+
+	sorted := append([]time.Duration{}, summary.Durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	summary.Min = sorted[0]
+	summary.Max = sorted[len(sorted)-1]
+	summary.Mean = total / time.Duration(len(sorted))
+	summary.Median = percentile(sorted, 0.5)
+	summary.P95 = percentile(sorted, 0.95)
+
+	for _, stats := range lines {
+		if stats.Failures == 0 {
+			continue
+		}
+		stats.Flaky = stats.Failures < stats.Runs
+		summary.FailingLines = append(summary.FailingLines, *stats)
+	}
+	sort.Slice(summary.FailingLines, func(i, j int) bool {
+		return summary.FailingLines[i].Line < summary.FailingLines[j].Line
+	})
+
+	return summary
+}
+
+// percentile returns the nearest-rank percentile p (0-1) of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(p*float64(len(sorted))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
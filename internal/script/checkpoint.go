@@ -0,0 +1,63 @@
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Checkpoint records how far a script run got so that it can be resumed
+type Checkpoint struct {
+	Script string `json:"script"`
+	VMID   string `json:"vmid"`
+	Line   int    `json:"line"`
+	// Sub is the position within the lines expanded from a macro call on Line
+	Sub  int    `json:"sub,omitempty"`
+	Name string `json:"name,omitempty"`
+	// NameLine and NameSub are the position of the last <checkpoint>
+	// directive reached
+	NameLine int       `json:"name_line,omitempty"`
+	NameSub  int       `json:"name_sub,omitempty"`
+	Updated  time.Time `json:"updated"`
+}
+
+// ResumeLine returns the line (and position within a macro expansion)
+// after which execution should continue. Named checkpoints are preferred
+// because they mark known-safe resume points.
+func (c *Checkpoint) ResumeLine() (int, int) {
+	if c.Name != "" {
+		return c.NameLine, c.NameSub
+	}
+	return c.Line, c.Sub
+}
+
+// LoadCheckpoint reads a checkpoint file
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file: %v", err)
+	}
+	return &checkpoint, nil
+}
+
+// Save writes the checkpoint atomically
+func (c *Checkpoint) Save(path string) error {
+	c.Updated = time.Now()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %v", err)
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %v", err)
+	}
+	return os.Rename(tempPath, path)
+}
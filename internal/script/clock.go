@@ -0,0 +1,121 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timePattern matches the time built-ins: $NOW, $DATE, $ELAPSED,
+// $LINE_ELAPSED (optionally as ${NAME}) and ${time:FORMAT}
+var timePattern = regexp.MustCompile(`\$\{time:([^}]*)\}|\$\{(NOW|DATE|ELAPSED|LINE_ELAPSED)\}|\$(NOW|DATE|ELAPSED|LINE_ELAPSED)\b`)
+
+// strftimeLayouts maps strftime conversions to Go time layouts
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM",
+	'b': "Jan", 'B': "January", 'a': "Mon", 'A': "Monday",
+	'j': "002", 'Z': "MST", 'z': "-0700",
+	'F': "2006-01-02", 'T': "15:04:05",
+}
+
+// formatTime formats t with a date(1) style format such as +%Y%m%d-%H%M
+func formatTime(t time.Time, format string) string {
+	format = strings.TrimPrefix(format, "+")
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i == len(format)-1 {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch c := format[i]; c {
+		case '%':
+			b.WriteByte('%')
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		default:
+			if layout, ok := strftimeLayouts[c]; ok {
+				b.WriteString(t.Format(layout))
+			} else {
+				b.WriteByte('%')
+				b.WriteByte(c)
+			}
+		}
+	}
+	return b.String()
+}
+
+// expandTime replaces the time built-ins in line
+func (e *Executor) expandTime(line string) string {
+	if !strings.Contains(line, "$") {
+		return line
+	}
+
+	now := time.Now()
+	return timePattern.ReplaceAllStringFunc(line, func(ref string) string {
+		if format, ok := strings.CutPrefix(ref, "${time:"); ok {
+			return formatTime(now, strings.TrimSuffix(format, "}"))
+		}
+		switch strings.Trim(ref, "${}") {
+		case "NOW":
+			return now.Format(time.RFC3339)
+		case "DATE":
+			return now.Format("2006-01-02")
+		case "ELAPSED":
+			if e.runStart.IsZero() {
+				return "0"
+			}
+			return strconv.Itoa(int(now.Sub(e.runStart).Seconds()))
+		case "LINE_ELAPSED":
+			return strconv.Itoa(int(e.lastLineDuration.Seconds()))
+		}
+		return ref
+	})
+}
+
+// parseClockTime returns the next time matching HH:MM, HH:MM:SS or an
+// RFC 3339 timestamp, relative to now
+func parseClockTime(value string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{"15:04:05", "15:04"} {
+		clock, err := time.Parse(layout, value)
+		if err != nil {
+			continue
+		}
+		target := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), clock.Second(), 0, now.Location())
+		// A time that has passed today means tomorrow
+		if !target.After(now) {
+			target = target.AddDate(0, 0, 1)
+		}
+		return target, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use HH:MM, HH:MM:SS or an RFC 3339 timestamp)", value)
+}
+
+// waitUntil handles <wait-until "HH:MM">: it pauses the script until the
+// next occurrence of the given local time
+func (e *Executor) waitUntil(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("Invalid wait-until command format. Use <wait-until \"03:00\">")
+	}
+
+	target, err := parseClockTime(args[0], time.Now())
+	if err != nil {
+		return err
+	}
+
+	wait := time.Until(target)
+	if wait <= 0 {
+		e.log().Debug("Wait-until time already passed", "time", target)
+		return nil
+	}
+	e.log().Info("Waiting until", "time", target.Format(time.RFC3339), "duration", wait.Round(time.Second))
+	defer e.watchMilestones(fmt.Sprintf("<wait-until %s>", target.Format(time.RFC3339)))()
+	return e.sleep(wait)
+}
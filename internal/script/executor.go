@@ -0,0 +1,1002 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/ga"
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/metrics"
+	"github.com/jstein/qmp/internal/notify"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/qmp/keymap"
+	"github.com/jstein/qmp/internal/recording"
+	"github.com/jstein/qmp/internal/screen"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Executor runs script lines against a VM
+type Executor struct {
+	conn *qmp.Manager
+
+	// Delay is the delay between key presses
+	Delay time.Duration
+	// ChunkSize and ChunkPause pause typing after every ChunkSize
+	// characters (0 disables chunking)
+	ChunkSize  int
+	ChunkPause time.Duration
+	// ScreenWidth and ScreenHeight are used to scale absolute mouse positions
+	ScreenWidth  int
+	ScreenHeight int
+	// CDROMDevice is the drive used by <eject cdrom> and <insert-iso>
+	CDROMDevice string
+	// CellWidth and CellHeight convert character cells to pixels for <assert-region>
+	CellWidth  int
+	CellHeight int
+	// Zones are the named regions usable as zone=NAME in <assert-region>
+	Zones screen.Zones
+	// Output receives per-line error messages
+	Output io.Writer
+	// LineBudget, when set, flags lines that take longer than this to run
+	LineBudget time.Duration
+	// FailOnPaused checks that the VM is running after every batch of keys
+	// and stops the script with a *qmp.PausedVMError when it is not
+	FailOnPaused bool
+	// FailureDir, when set, receives a screenshot of the screen after every
+	// failed line
+	FailureDir string
+
+	// LuaEnv lists the environment variables Lua's getenv() may read
+	LuaEnv []string
+
+	// Restricted confines scripts from untrusted sources, such as the HTTP
+	// API, to the VM: <qmp>, <insert-iso> and <connect-ssh> are rejected,
+	// files are only read from FileDir and ${secret:NAME} does not fall
+	// back to the environment
+	Restricted bool
+	// FileDir is where restricted scripts read files from; when empty they
+	// cannot read files at all
+	FileDir string
+
+	// Checkpoint, when set, is updated as lines complete and saved to
+	// CheckpointFile so an interrupted run can be resumed
+	Checkpoint     *Checkpoint
+	CheckpointFile string
+	// StartAfter skips all lines up to and including this line number and,
+	// within a macro call on that line, StartAfterSub expanded lines
+	StartAfter    int
+	StartAfterSub int
+
+	// VMID and Recorder, when set, record every executed line
+	VMID     string
+	Recorder *recording.Recorder
+
+	// Secrets resolves ${secret:NAME} references. Substituted values are
+	// masked in logs and session recordings.
+	Secrets *Secrets
+
+	// Notifier sends <notify> messages; nil when no providers are configured
+	Notifier *notify.Notifier
+	// WaitMilestone, when set, sends a notification each time a wait
+	// directive has run for another WaitMilestone (e.g. every 30m)
+	WaitMilestone time.Duration
+
+	// GuestAgent connects to the guest agent for <guest-exec>. When it is
+	// nil or fails, commands are typed on the console instead.
+	GuestAgent func() (*ga.Client, error)
+
+	// Capture, when set, replaces QMP screendump for screen polling, e.g.
+	// <wait-stable> and <wait-for-boot> reading the framebuffer over VNC
+	Capture func() (image.Image, error)
+
+	// LogFile, when set, receives the log records of this run, including
+	// the QMP traffic. Close closes it.
+	LogFile *logging.RunFile
+
+	// ctx is the context of the current run; cancelling it stops the script
+	ctx          context.Context
+	cleanups     []func() error
+	currentLine  int
+	currentSub   int
+	agent        *ga.Client
+	agentChecked bool
+	// ssh is set between <connect-ssh> and <disconnect-ssh>
+	ssh *sshTarget
+	// lua is shared by all <script lua> blocks of a run
+	lua *lua.LState
+	// blockLine and blockSub are the position of the outermost running
+	// <loop> or <try> block; blockLine is 0 outside blocks
+	blockLine int
+	blockSub  int
+	// runStart and lastLineDuration back $ELAPSED and $LINE_ELAPSED
+	runStart         time.Time
+	lastLineDuration time.Duration
+}
+
+// AssertionError is returned by assertion directives. Unlike other line
+// errors it stops the script.
+type AssertionError struct {
+	Message string
+}
+
+// Error implements error
+func (e *AssertionError) Error() string {
+	return "assertion failed: " + e.Message
+}
+
+// LineError describes a line that failed to execute
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+	// Screenshot is the failure screenshot saved to the executor's FailureDir
+	Screenshot string `json:"screenshot,omitempty"`
+}
+
+// Step records the outcome of a single executed line
+type Step struct {
+	Line      int           `json:"line"`
+	Text      string        `json:"text"`
+	Directive string        `json:"directive"`
+	Duration  time.Duration `json:"duration_ns"`
+	Error     string        `json:"error,omitempty"`
+	// OverBudget is set when the line took longer than the executor's LineBudget
+	OverBudget bool `json:"over_budget,omitempty"`
+}
+
+// Result summarises a script run
+type Result struct {
+	LinesExecuted int           `json:"lines_executed"`
+	Errors        []LineError   `json:"errors"`
+	Steps         []Step        `json:"steps"`
+	Duration      time.Duration `json:"duration_ns"`
+	Success       bool          `json:"success"`
+	// Aborted is set when an assertion failure stopped the script
+	Aborted bool `json:"aborted"`
+	// Interrupted is set when the run was cancelled; InterruptedLine is the
+	// line that was running or due to run next
+	Interrupted     bool `json:"interrupted"`
+	InterruptedLine int  `json:"interrupted_line,omitempty"`
+}
+
+// NewExecutor creates a new executor using the given managed connection
+func NewExecutor(conn *qmp.Manager, delay time.Duration) *Executor {
+	return &Executor{
+		conn:         conn,
+		Delay:        delay,
+		ScreenWidth:  1024,
+		ScreenHeight: 768,
+		CDROMDevice:  "drive-ide2",
+		CellWidth:    8,
+		CellHeight:   16,
+		Output:       os.Stdout,
+	}
+}
+
+// Run executes every line read from r. Failing lines are reported and
+// skipped; only a failure to read the script is returned as an error.
+func (e *Executor) Run(r io.Reader) (*Result, error) {
+	return e.RunContext(context.Background(), r)
+}
+
+// RunContext is like Run but stops when ctx is cancelled. The running line
+// is allowed to finish (sleeps end early), cleanup functions run and the
+// checkpoint is saved so the script can be resumed.
+func (e *Executor) RunContext(ctx context.Context, r io.Reader) (*Result, error) {
+	e.ctx = ctx
+	defer func() { e.ctx = nil }()
+
+	start := time.Now()
+	result := &Result{Errors: []LineError{}, Steps: []Step{}}
+	e.runStart = start
+
+	lines, err := readLines(r)
+	if err != nil {
+		return result, err
+	}
+	lines, err = expandMacros(lines)
+	if err != nil {
+		return result, err
+	}
+	lines, err = extractEmbedded(lines)
+	if err != nil {
+		return result, err
+	}
+	lines, lists, err := extractLists(lines)
+	if err != nil {
+		return result, err
+	}
+	lines, handlers, err := extractHandlers(lines)
+	if err != nil {
+		return result, err
+	}
+	loops, err := parseLoops(lines, lists)
+	if err != nil {
+		return result, err
+	}
+	tries, err := parseTries(lines)
+	if err != nil {
+		return result, err
+	}
+	defer func() { e.blockLine = 0 }()
+
+	// <on-exit> always runs, after any <on-error> block
+	if block, ok := handlers[HandlerExit]; ok {
+		e.AddCleanup(func() error { return e.runHandler(HandlerExit, block, nil) })
+	}
+
+	for pc := 0; pc < len(lines); pc++ {
+		line := lines[pc]
+		lineNum := line.Num
+
+		// Skip lines already executed by a previous run
+		if !line.after(e.StartAfter, e.StartAfterSub) {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			result.Interrupted = true
+			result.InterruptedLine = lineNum
+			break
+		}
+
+		next, ok, blockErr := loops.control(pc, line)
+		var pending *failure
+		if !ok {
+			next, ok, pending, blockErr = tries.control(pc, line)
+		}
+		if blockErr != nil {
+			fmt.Fprintf(e.Output, "Line %d: %v\n", lineNum, blockErr)
+			result.Errors = append(result.Errors, LineError{Line: lineNum, Message: blockErr.Error()})
+			result.Aborted = true
+			break
+		}
+		if pending != nil {
+			// A failure not caught inside the block it left
+			if next = e.raise(result, tries, pc, *pending); next < 0 {
+				break
+			}
+		}
+		if ok {
+			e.enterBlocks(lines, loops, tries, next)
+			pc = next - 1
+			continue
+		}
+		line.Text = tries.expand(loops.expand(line.Text))
+
+		e.currentLine, e.currentSub = lineNum, line.Sub
+		result.LinesExecuted++
+		if e.Recorder != nil {
+			e.Recorder.RecordLine(e.VMID, lineNum, line.Text)
+		}
+		metrics.ScriptLines.Inc()
+		step := Step{Line: lineNum, Text: line.Text, Directive: directiveName(line.Text)}
+		lineStart := time.Now()
+		err := e.executeScriptLine(line)
+		step.Duration = time.Since(lineStart)
+		e.lastLineDuration = step.Duration
+		if e.LineBudget > 0 && step.Duration > e.LineBudget {
+			step.OverBudget = true
+			e.log().Warn("Line exceeded time budget", "line", lineNum, "duration", step.Duration, "budget", e.LineBudget)
+		}
+		if errors.Is(err, context.Canceled) {
+			result.Interrupted = true
+			result.InterruptedLine = lineNum
+			step.Error = "interrupted"
+			result.Steps = append(result.Steps, step)
+			break
+		}
+		var failed *failure
+		if err != nil {
+			metrics.ScriptFailures.WithLabelValues(step.Directive).Inc()
+			message := maskError(err)
+			if line.Macro != "" {
+				message = fmt.Sprintf("in macro %s (line %d): %s", line.Macro, line.Source, message)
+			}
+			fmt.Fprintf(e.Output, "Line %d: %s\n", lineNum, message)
+			lineErr := LineError{Line: lineNum, Message: message}
+			if e.FailureDir != "" {
+				if lineErr.Screenshot = e.captureFailure(lineNum); lineErr.Screenshot != "" {
+					fmt.Fprintf(e.Output, "Line %d: screenshot saved to %s\n", lineNum, lineErr.Screenshot)
+				}
+			}
+			step.Error = message
+
+			var assertErr *AssertionError
+			var pausedErr *qmp.PausedVMError
+			failed = &failure{err: lineErr, abort: errors.As(err, &assertErr) || errors.As(err, &pausedErr)}
+		}
+		result.Steps = append(result.Steps, step)
+
+		// Failures go to the enclosing <try> blocks, if any
+		if failed != nil {
+			next := e.raise(result, tries, pc, *failed)
+			if next < 0 {
+				break
+			}
+			if next != pc+1 {
+				e.enterBlocks(lines, loops, tries, next)
+				pc = next - 1
+				continue
+			}
+		}
+
+		if e.Checkpoint != nil && !loops.active() && !tries.active() {
+			e.Checkpoint.Line, e.Checkpoint.Sub = lineNum, line.Sub
+			e.saveCheckpoint()
+		}
+	}
+
+	if result.Interrupted {
+		e.log().Warn("Script interrupted", "line", result.InterruptedLine)
+		e.saveCheckpoint()
+	}
+
+	// <on-error> runs with the last failure when the script did not succeed
+	if block, ok := handlers[HandlerError]; ok && len(result.Errors) > 0 {
+		lastErr := result.Errors[len(result.Errors)-1]
+		if err := e.runHandler(HandlerError, block, errorVars(lastErr)); err != nil {
+			fmt.Fprintf(e.Output, "Cleanup: %s\n", maskError(err))
+		}
+	}
+	e.runCleanups()
+
+	result.Duration = time.Since(start)
+	result.Success = len(result.Errors) == 0 && !result.Interrupted
+
+	return result, nil
+}
+
+// maskError returns the error message with secrets masked
+func maskError(err error) string {
+	return logging.Mask(err.Error())
+}
+
+// ExecuteLine executes a single (non-empty, non-comment) script line
+func (e *Executor) ExecuteLine(line string) error {
+	line = e.expandTime(line)
+	line, hasSecrets, err := e.expandSecrets(line)
+	if err != nil {
+		return err
+	}
+	if hasSecrets {
+		return logging.Redacted(func() error { return e.executeLine(line) })
+	}
+	return e.executeLine(line)
+}
+
+// expandSecrets substitutes ${secret:NAME} references and registers the
+// values for masking
+func (e *Executor) expandSecrets(line string) (string, bool, error) {
+	if !strings.Contains(line, "${secret:") {
+		return line, false, nil
+	}
+
+	secrets := e.Secrets
+	if secrets == nil {
+		secrets = NewSecrets()
+	}
+	if e.Restricted {
+		secrets = secrets.withoutEnv()
+	}
+
+	expanded, values, err := secrets.Expand(line)
+	if err != nil {
+		return "", false, err
+	}
+	for _, value := range values {
+		logging.AddSecret(value)
+		if e.Recorder != nil {
+			e.Recorder.AddSecret(value)
+		}
+	}
+	return expanded, len(values) > 0, nil
+}
+
+// directiveName returns the <directive> name of a line, or "type" for typed text
+func directiveName(line string) string {
+	if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+		if parts := strings.Fields(line[1 : len(line)-1]); len(parts) > 0 {
+			return parts[0]
+		}
+	}
+	return "type"
+}
+
+// executeLine executes a line after secrets have been expanded
+func (e *Executor) executeLine(line string) error {
+	// Check for special commands enclosed in <>
+	if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+		command := line[1 : len(line)-1] // Remove < and >
+		parts := strings.Fields(command)
+		if len(parts) > 0 {
+			return e.executeCommand(command, parts)
+		}
+	}
+
+	// Run the line over SSH once a connection has been made
+	if e.ssh != nil {
+		return e.executeSSHLine(line)
+	}
+
+	// Regular line - send as keyboard input
+	e.log().Info("Executing line", "line", line)
+	if err := e.conn.Do(func(c *qmp.Client) error { return c.PasteText(line, e.Delay, e.ChunkSize, e.ChunkPause) }); err != nil {
+		return fmt.Errorf("Error sending text: %v", err)
+	}
+
+	// Send Enter after each command
+	if err := e.conn.Do(func(c *qmp.Client) error { return c.SendKey("ret") }); err != nil {
+		return fmt.Errorf("Error sending return key: %v", err)
+	}
+	if err := e.verifyRunning(); err != nil {
+		return err
+	}
+
+	// Small delay between commands
+	time.Sleep(100 * time.Millisecond)
+	return nil
+}
+
+// sendInput sends keys through fn, then verifies the VM is running
+func (e *Executor) sendInput(fn func(c *qmp.Client) error) error {
+	if err := e.conn.Do(fn); err != nil {
+		return err
+	}
+	return e.verifyRunning()
+}
+
+// verifyRunning returns a *qmp.PausedVMError when FailOnPaused is set and
+// the VM is not running
+func (e *Executor) verifyRunning() error {
+	if !e.FailOnPaused {
+		return nil
+	}
+	return e.conn.DoPriority(qmp.PriorityQuery, func(c *qmp.Client) error { return c.CheckRunning() })
+}
+
+// sleep waits for d, returning early with the context error if the run is cancelled
+func (e *Executor) sleep(d time.Duration) error {
+	if e.ctx == nil {
+		time.Sleep(d)
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	}
+}
+
+// AddCleanup registers a function that runs when the script finishes, fails
+// or is interrupted. Cleanup functions run in reverse order of registration.
+func (e *Executor) AddCleanup(fn func() error) {
+	e.cleanups = append(e.cleanups, fn)
+}
+
+// runCleanups runs and clears the registered cleanup functions
+func (e *Executor) runCleanups() {
+	cleanups := e.cleanups
+	e.cleanups = nil
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		if err := cleanups[i](); err != nil {
+			fmt.Fprintf(e.Output, "Cleanup: %s\n", maskError(err))
+		}
+	}
+}
+
+// log returns the logger for this run
+func (e *Executor) log() *slog.Logger {
+	if e.LogFile != nil {
+		return e.LogFile.Logger()
+	}
+	return logging.Default()
+}
+
+// Close releases resources held by the executor
+func (e *Executor) Close() error {
+	if e.lua != nil {
+		e.lua.Close()
+		e.lua = nil
+	}
+	var err error
+	if e.agent != nil {
+		err = e.agent.Close()
+	}
+	if e.LogFile != nil {
+		e.conn.SetLogger(nil)
+		if cerr := e.LogFile.Close(); err == nil {
+			err = cerr
+		}
+		e.LogFile = nil
+	}
+	return err
+}
+
+// executeCommand runs a <command> special command
+func (e *Executor) executeCommand(command string, parts []string) error {
+	if err := e.checkRestricted(parts[0]); err != nil {
+		return err
+	}
+
+	switch parts[0] {
+	case "sleep":
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid sleep command format. Use <sleep N>")
+		}
+		var seconds float64
+		if _, err := fmt.Sscanf(parts[1], "%f", &seconds); err != nil {
+			return fmt.Errorf("Invalid sleep duration: %v", err)
+		}
+		sleepDuration := time.Duration(seconds * float64(time.Second))
+		e.log().Debug("Sleeping", "duration", sleepDuration)
+		return e.sleep(sleepDuration)
+	case "mouse-move", "mouse-move-rel", "mouse-click", "mouse-scroll":
+		return e.conn.Do(func(c *qmp.Client) error {
+			return e.executeMouseCommand(c, parts)
+		})
+	case "checkpoint":
+		if len(parts) < 2 {
+			return fmt.Errorf("Invalid checkpoint command format. Use <checkpoint \"name\">")
+		}
+		name := strings.Trim(strings.Join(parts[1:], " "), "\"")
+		e.log().Info("Reached checkpoint", "name", name, "line", e.currentLine)
+		if e.Checkpoint != nil {
+			e.Checkpoint.Name = name
+			e.Checkpoint.NameLine, e.Checkpoint.NameSub = e.currentLine, e.currentSub
+			// Inside a block, resume from the start of the outermost block
+			if e.blockLine > 0 {
+				e.Checkpoint.NameLine, e.Checkpoint.NameSub = e.blockLine, e.blockSub-1
+			}
+			e.saveCheckpoint()
+		}
+		return nil
+	case "guest-exec":
+		commandLine := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		commandLine = strings.Trim(commandLine, "\"")
+		if commandLine == "" {
+			return fmt.Errorf("Invalid guest-exec command format. Use <guest-exec \"command\">")
+		}
+		return e.guestExec(commandLine)
+	case "eject":
+		if len(parts) > 2 {
+			return fmt.Errorf("Invalid eject command format. Use <eject [DEVICE]>")
+		}
+		device := e.CDROMDevice
+		if len(parts) == 2 && parts[1] != "cdrom" {
+			device = parts[1]
+		}
+		e.log().Info("Ejecting medium", "device", device)
+		return e.conn.Do(func(c *qmp.Client) error { return c.Eject(device, true) })
+	case "insert-iso":
+		args := splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0])))
+		if len(args) < 1 || len(args) > 2 {
+			return fmt.Errorf("Invalid insert-iso command format. Use <insert-iso \"path.iso\" [DEVICE]>")
+		}
+		device := e.CDROMDevice
+		if len(args) == 2 && args[1] != "cdrom" {
+			device = args[1]
+		}
+		e.log().Info("Inserting ISO", "file", args[0], "device", device)
+		return e.conn.Do(func(c *qmp.Client) error { return c.ChangeMedium(device, args[0], "raw") })
+	case "snapshot-save", "snapshot-restore":
+		args := splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0])))
+		if len(args) != 1 {
+			return fmt.Errorf("Invalid %s command format. Use <%s \"name\">", parts[0], parts[0])
+		}
+		if parts[0] == "snapshot-save" {
+			e.log().Info("Saving snapshot", "name", args[0])
+			return e.conn.Do(func(c *qmp.Client) error { return c.SaveSnapshot(args[0]) })
+		}
+		e.log().Info("Restoring snapshot", "name", args[0])
+		return e.conn.Do(func(c *qmp.Client) error { return c.LoadSnapshot(args[0]) })
+	case "key":
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid key command format. Use <key NAME> (e.g. <key esc>, <key ctrl+c>)")
+		}
+		e.log().Debug("Sending key", "key", parts[1])
+		return e.sendInput(func(c *qmp.Client) error { return c.SendCombo(parts[1]) })
+	case "hold":
+		if len(parts) != 3 {
+			return fmt.Errorf("Invalid hold command format. Use <hold KEY DURATION> (e.g. <hold ctrl 2s>)")
+		}
+		duration, err := time.ParseDuration(parts[2])
+		if err != nil {
+			return fmt.Errorf("Invalid hold duration: %v", err)
+		}
+		e.log().Debug("Holding key", "key", parts[1], "duration", duration)
+		return e.sendInput(func(c *qmp.Client) error { return c.HoldKey(parts[1], duration) })
+	case "key-down", "key-up":
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid %s command format. Use <%s KEY>", parts[0], parts[0])
+		}
+		e.log().Debug("Sending key event", "event", parts[0], "key", parts[1])
+		if parts[0] == "key-down" {
+			return e.sendInput(func(c *qmp.Client) error { return c.KeyDown(parts[1]) })
+		}
+		return e.sendInput(func(c *qmp.Client) error { return c.KeyUp(parts[1]) })
+	case "keys":
+		sequence := strings.Trim(strings.TrimSpace(strings.TrimPrefix(command, parts[0])), "\"")
+		if sequence == "" {
+			return fmt.Errorf("Invalid keys command format. Use <keys \"ctrl+alt+del, wait 500ms, enter\">")
+		}
+		e.log().Debug("Sending key sequence", "keys", sequence)
+		return e.sendInput(func(c *qmp.Client) error { return c.SendKeySequence(sequence) })
+	case "qmp":
+		raw := strings.TrimSpace(strings.TrimPrefix(command, parts[0]))
+		raw = strings.Trim(raw, "'")
+		qmpCommand, err := qmp.ParseCommand([]byte(raw))
+		if err != nil {
+			return fmt.Errorf("%v. Use <qmp '{\"execute\":\"system_reset\"}'>", err)
+		}
+		e.log().Info("Sending QMP command", "command", qmpCommand.Execute)
+		return e.conn.Do(func(c *qmp.Client) error {
+			result, err := c.Execute(qmpCommand)
+			e.log().Debug("QMP command returned", "command", qmpCommand.Execute, "return", result)
+			return err
+		})
+	case "notify":
+		return e.notify(strings.TrimSpace(strings.TrimPrefix(command, parts[0])))
+	case "raw-keys":
+		return e.rawKeys(parts[1:])
+	case "type":
+		text := strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(command, parts[0])), "\"")
+		text = strings.TrimSuffix(text, "\"")
+		e.log().Debug("Typing text", "text", text)
+		return e.sendInput(func(c *qmp.Client) error { return c.PasteText(text, e.Delay, e.ChunkSize, e.ChunkPause) })
+	case "connect-ssh":
+		return e.connectSSH(command, parts)
+	case "disconnect-ssh":
+		if e.ssh != nil {
+			e.log().Info("Disconnected from SSH, typing lines on the console", "host", e.ssh.Host)
+		}
+		e.ssh = nil
+		return nil
+	case "paste-file":
+		return e.pasteFile(command, parts)
+	case "assert-region":
+		return e.assertRegion(parts[1:])
+	case "wait-stable":
+		return e.waitStable(parts[1:])
+	case "wait-for-boot":
+		return e.waitForBoot(parts[1:])
+	case "wait-until":
+		return e.waitUntil(splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0]))))
+	case "wait-net":
+		return e.waitNet(parts[1:])
+	case "script":
+		return e.runLuaFile(splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0]))))
+	case "loop", "end-loop", "for", "end-for", "break", "continue", "try", "catch", "finally", "end-try":
+		return fmt.Errorf("<%s> is only supported in the main script", parts[0])
+	case "timing":
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid timing command format. Use <timing PROFILE> (%s)", strings.Join(qmp.TimingProfileNames(), ", "))
+		}
+		profile, err := qmp.GetTimingProfile(parts[1])
+		if err != nil {
+			return err
+		}
+		e.log().Debug("Switching timing profile", "profile", profile.Name)
+		return e.SetTimingProfile(profile)
+	case "keymap":
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid keymap command format. Use <keymap NAME>")
+		}
+		layout, err := keymap.Get(parts[1])
+		if err != nil {
+			return err
+		}
+		e.log().Debug("Switching keymap", "keymap", layout.Name)
+		return e.conn.Do(func(c *qmp.Client) error {
+			c.SetKeymap(layout)
+			return nil
+		})
+	default:
+		return fmt.Errorf("Unknown special command: %s", parts[0])
+	}
+}
+
+// SetTimingProfile applies the key delay, hold time and chunking of a
+// timing profile to the rest of the script
+func (e *Executor) SetTimingProfile(profile qmp.TimingProfile) error {
+	e.Delay = profile.KeyDelay
+	e.ChunkSize = profile.ChunkSize
+	e.ChunkPause = profile.ChunkPause
+	return e.conn.Do(func(c *qmp.Client) error {
+		c.SetHoldTime(profile.HoldTime)
+		return nil
+	})
+}
+
+// guestExec runs a command through the guest agent, or types it on the
+// console when the agent is not available
+func (e *Executor) guestExec(commandLine string) error {
+	if !e.agentChecked {
+		e.agentChecked = true
+		if e.GuestAgent != nil {
+			agent, err := e.GuestAgent()
+			if err != nil {
+				e.log().Warn("Guest agent not available, typing commands instead", "error", err)
+			} else {
+				e.agent = agent
+			}
+		}
+	}
+
+	if e.agent == nil {
+		e.log().Info("Typing guest command", "command", commandLine)
+		return e.executeLine(commandLine)
+	}
+
+	e.log().Info("Running guest command through agent", "command", commandLine)
+	result, err := e.agent.Exec(commandLine, 5*time.Minute)
+	if err != nil {
+		return fmt.Errorf("guest-exec failed: %v", err)
+	}
+	e.log().Debug("Guest command finished", "exitcode", result.ExitCode, "stdout", result.Stdout, "stderr", result.Stderr)
+
+	if result.ExitCode != 0 {
+		return fmt.Errorf("guest command exited with code %d: %s", result.ExitCode, strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// pasteFile types the contents of a file in chunks.
+// Format: <paste-file "FILE" [rate=200cps] [chunk=64] [pause=250ms]>
+func (e *Executor) pasteFile(command string, parts []string) error {
+	args := splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0])))
+	if len(args) < 1 {
+		return fmt.Errorf("Invalid paste-file command format. Use <paste-file \"file\" [rate=200cps] [chunk=64] [pause=250ms]>")
+	}
+
+	delay, chunk, pause := e.Delay, 64, 250*time.Millisecond
+	for _, option := range args[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		var err error
+		switch key {
+		case "rate":
+			delay, err = qmp.ParseRate(value)
+		case "chunk":
+			chunk, err = strconv.Atoi(value)
+		case "pause":
+			pause, err = time.ParseDuration(value)
+		default:
+			err = fmt.Errorf("unknown paste-file option %q", option)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	data, err := e.readFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read paste file: %v", err)
+	}
+
+	e.log().Info("Pasting file", "file", args[0], "characters", len([]rune(string(data))), "delay", delay, "chunk", chunk)
+	return e.sendInput(func(c *qmp.Client) error { return c.PasteText(string(data), delay, chunk, pause) })
+}
+
+// assertRegion compares a screen region against a reference image.
+// Format: <assert-region ROWS COLS REFERENCE [tolerance=N%] [threshold=N]>
+func (e *Executor) assertRegion(args []string) error {
+	// The region is either ROWS COLS or zone=NAME
+	var region screen.Region
+	var regionName string
+	var err error
+	if len(args) > 0 && strings.HasPrefix(args[0], "zone=") {
+		regionName = args[0]
+		if region, err = e.Zones.Get(strings.TrimPrefix(args[0], "zone=")); err != nil {
+			return err
+		}
+		args = args[1:]
+	} else if len(args) > 2 {
+		regionName = args[0] + " " + args[1]
+		if region, err = screen.ParseRegion(args[0], args[1]); err != nil {
+			return err
+		}
+		args = args[2:]
+	}
+	if regionName == "" || len(args) < 1 {
+		return fmt.Errorf("Invalid assert-region command format. Use <assert-region ROWS COLS ref.png [tolerance=N%%]> or <assert-region zone=NAME ref.png>")
+	}
+	reference := strings.Trim(args[0], "\"")
+
+	tolerance, threshold := 0.0, 16
+	for _, option := range args[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "tolerance":
+			if tolerance, err = screen.ParseTolerance(value); err != nil {
+				return err
+			}
+		case "threshold":
+			if threshold, err = strconv.Atoi(value); err != nil {
+				return fmt.Errorf("invalid threshold %q", value)
+			}
+		default:
+			return fmt.Errorf("unknown assert-region option %q", option)
+		}
+	}
+
+	ref, err := e.loadImage(reference)
+	if err != nil {
+		return err
+	}
+
+	img, err := e.captureScreen()
+	if err != nil {
+		return err
+	}
+
+	cropped, err := screen.Crop(img, region.Pixels(e.CellWidth, e.CellHeight))
+	if err != nil {
+		return err
+	}
+
+	diff, err := screen.Compare(cropped, ref, threshold)
+	if err != nil {
+		return &AssertionError{Message: err.Error()}
+	}
+
+	e.log().Debug("Compared screen region", "reference", reference, "diff", diff, "tolerance", tolerance)
+	if diff > tolerance {
+		return &AssertionError{Message: fmt.Sprintf("region %s differs from %s by %.2f%% (tolerance %.2f%%)",
+			regionName, reference, diff*100, tolerance*100)}
+	}
+	return nil
+}
+
+// notify handles <notify "MESSAGE" [level=info|warn|error]>
+func (e *Executor) notify(args string) error {
+	fields := splitQuoted(args)
+	if len(fields) == 0 {
+		return fmt.Errorf("Invalid notify command format. Use <notify \"message\" [level=warn]>")
+	}
+
+	msg := notify.Message{Level: notify.LevelInfo, Title: fmt.Sprintf("Script notification from VM %s", e.VMID), Text: fields[0]}
+	for _, option := range fields[1:] {
+		value, ok := strings.CutPrefix(option, "level=")
+		if !ok {
+			return fmt.Errorf("unknown notify option %q", option)
+		}
+		level, err := notify.ParseLevel(value)
+		if err != nil {
+			return err
+		}
+		msg.Level = level
+	}
+
+	if !e.Notifier.Enabled() {
+		return fmt.Errorf("cannot send notification: no providers configured (see notify in the config file)")
+	}
+	e.log().Info("Sending notification", "level", msg.Level, "message", msg.Text)
+	return e.Notifier.Notify(msg)
+}
+
+// rawKeys handles <raw-keys SCANCODES... [press=DURATION]>
+func (e *Executor) rawKeys(args []string) error {
+	press := qmp.DefaultPressDuration
+	var codes []string
+	for _, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "press="); ok {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("Invalid press duration: %v", err)
+			}
+			press = duration
+			continue
+		}
+		codes = append(codes, arg)
+	}
+
+	chords, err := qmp.ParseScancodes(strings.Trim(strings.Join(codes, " "), "\""))
+	if err != nil {
+		return fmt.Errorf("Invalid raw-keys command: %v. Use <raw-keys 1d 38 e0 53 [press=100ms]>", err)
+	}
+	e.log().Debug("Sending scancodes", "scancodes", chords, "press", press)
+	return e.sendInput(func(c *qmp.Client) error { return c.SendScancodes(chords, press) })
+}
+
+// splitQuoted splits s on whitespace, keeping double-quoted sections together
+func splitQuoted(s string) []string {
+	var fields []string
+	var current strings.Builder
+	inQuotes, hasField := false, false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			hasField = true
+		case (r == ' ' || r == '\t') && !inQuotes:
+			if hasField {
+				fields = append(fields, current.String())
+				current.Reset()
+				hasField = false
+			}
+		default:
+			current.WriteRune(r)
+			hasField = true
+		}
+	}
+	if hasField {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// saveCheckpoint writes the current checkpoint to disk
+func (e *Executor) saveCheckpoint() {
+	if e.CheckpointFile == "" {
+		return
+	}
+	if err := e.Checkpoint.Save(e.CheckpointFile); err != nil {
+		e.log().Warn("Failed to save checkpoint", "file", e.CheckpointFile, "error", err)
+	}
+}
+
+// executeMouseCommand runs a <mouse-*> special command
+func (e *Executor) executeMouseCommand(client *qmp.Client, parts []string) error {
+	width, height := e.ScreenWidth, e.ScreenHeight
+
+	switch parts[0] {
+	case "mouse-move", "mouse-move-rel":
+		if len(parts) != 3 {
+			return fmt.Errorf("invalid %s command format. Use <%s X Y>", parts[0], parts[0])
+		}
+		x, errX := strconv.Atoi(parts[1])
+		y, errY := strconv.Atoi(parts[2])
+		if errX != nil || errY != nil {
+			return fmt.Errorf("invalid %s coordinates: %s %s", parts[0], parts[1], parts[2])
+		}
+		e.log().Debug("Moving mouse", "command", parts[0], "x", x, "y", y)
+		if parts[0] == "mouse-move-rel" {
+			return client.MouseMoveRel(x, y)
+		}
+		return client.MouseMove(x, y, width, height)
+
+	case "mouse-click":
+		if len(parts) < 3 || len(parts) > 4 {
+			return fmt.Errorf("invalid mouse-click command format. Use <mouse-click X Y [button]>")
+		}
+		x, errX := strconv.Atoi(parts[1])
+		y, errY := strconv.Atoi(parts[2])
+		if errX != nil || errY != nil {
+			return fmt.Errorf("invalid mouse-click coordinates: %s %s", parts[1], parts[2])
+		}
+		button := "left"
+		if len(parts) == 4 {
+			button = parts[3]
+		}
+		e.log().Debug("Clicking mouse", "x", x, "y", y, "button", button)
+		if err := client.MouseMove(x, y, width, height); err != nil {
+			return err
+		}
+		return client.MouseClick(button)
+
+	case "mouse-scroll":
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid mouse-scroll command format. Use <mouse-scroll N>")
+		}
+		steps, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid mouse-scroll steps: %v", err)
+		}
+		e.log().Debug("Scrolling mouse", "steps", steps)
+		return client.MouseScroll(steps)
+	}
+
+	return fmt.Errorf("unknown mouse command: %s", parts[0])
+}
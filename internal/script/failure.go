@@ -0,0 +1,36 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jstein/qmp/internal/screen"
+)
+
+// captureFailure saves a screenshot of the screen after line lineNum
+// failed and returns its path. Capture problems are logged and return "".
+func (e *Executor) captureFailure(lineNum int) string {
+	if err := os.MkdirAll(e.FailureDir, 0755); err != nil {
+		e.log().Warn("Unable to create failure directory", "dir", e.FailureDir, "error", err)
+		return ""
+	}
+
+	img, err := e.captureScreen()
+	if err != nil {
+		e.log().Warn("Unable to capture failure screenshot", "line", lineNum, "error", err)
+		return ""
+	}
+
+	name := e.VMID
+	if name == "" {
+		name = "script"
+	}
+	path := filepath.Join(e.FailureDir, fmt.Sprintf("%s-line%d-%s.png", name, lineNum, time.Now().Format("20060102-150405")))
+	if err := screen.SaveImage(img, path, "png"); err != nil {
+		e.log().Warn("Unable to save failure screenshot", "line", lineNum, "error", err)
+		return ""
+	}
+	return path
+}
@@ -0,0 +1,149 @@
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Handler block names
+const (
+	HandlerExit  = "on-exit"
+	HandlerError = "on-error"
+)
+
+// scriptLine is a non-empty, non-comment script line and its line number
+type scriptLine struct {
+	Num  int
+	Text string
+	// Code is the body of an inline <script lua> block
+	Code string
+	// Lines expanded from a macro keep the Num of the call. Sub numbers
+	// them (1, 2, ...) so each has its own checkpoint position, and Macro
+	// and Source name the macro and the body line they came from.
+	Sub    int
+	Macro  string
+	Source int
+}
+
+// after reports whether the line comes after position num/sub
+func (l scriptLine) after(num int, sub int) bool {
+	return l.Num > num || (l.Num == num && l.Sub > sub)
+}
+
+// readLines reads the executable lines of a script. A trailing backslash
+// continues a line on the next one; the joined line keeps the number of
+// its first line.
+func readLines(r io.Reader) ([]scriptLine, error) {
+	var lines []scriptLine
+	var pending *scriptLine
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		if pending != nil {
+			pending.Text += " " + line
+		} else {
+			// Skip empty lines and comments
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			pending = &scriptLine{Num: lineNum, Text: line}
+		}
+
+		if strings.HasSuffix(pending.Text, "\\") {
+			pending.Text = strings.TrimSpace(strings.TrimSuffix(pending.Text, "\\"))
+			continue
+		}
+		lines = append(lines, *pending)
+		pending = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading script file: %v", err)
+	}
+	if pending != nil {
+		return nil, fmt.Errorf("line %d: line continuation at end of script", pending.Num)
+	}
+	return lines, nil
+}
+
+// extractHandlers removes <on-exit> ... <end> and <on-error> ... <end>
+// blocks from lines and returns them by name
+func extractHandlers(lines []scriptLine) ([]scriptLine, map[string][]scriptLine, error) {
+	var body []scriptLine
+	handlers := map[string][]scriptLine{}
+	current, start := "", 0
+
+	for _, line := range lines {
+		switch line.Text {
+		case "<" + HandlerExit + ">", "<" + HandlerError + ">":
+			if current != "" {
+				return nil, nil, fmt.Errorf("line %d: <%s> block started on line %d is missing <end>", line.Num, current, start)
+			}
+			current, start = line.Text[1:len(line.Text)-1], line.Num
+			if _, ok := handlers[current]; ok {
+				return nil, nil, fmt.Errorf("line %d: duplicate <%s> block", line.Num, current)
+			}
+			handlers[current] = []scriptLine{}
+		case "<end>":
+			if current == "" {
+				return nil, nil, fmt.Errorf("line %d: <end> without <on-exit> or <on-error>", line.Num)
+			}
+			current = ""
+		default:
+			if current != "" {
+				handlers[current] = append(handlers[current], line)
+			} else {
+				body = append(body, line)
+			}
+		}
+	}
+	if current != "" {
+		return nil, nil, fmt.Errorf("line %d: <%s> block is missing <end>", start, current)
+	}
+	return body, handlers, nil
+}
+
+// runHandler executes the lines of a handler block, substituting $NAME and
+// ${NAME} variables. Errors are reported but do not stop the block.
+func (e *Executor) runHandler(name string, lines []scriptLine, vars map[string]string) error {
+	var pairs []string
+	for key, value := range vars {
+		pairs = append(pairs, "${"+key+"}", value, "$"+key, value)
+	}
+	replacer := strings.NewReplacer(pairs...)
+
+	// Handlers also run after the script was cancelled
+	ctx := e.ctx
+	e.ctx = nil
+	defer func() { e.ctx = ctx }()
+
+	failed := 0
+	for _, line := range lines {
+		e.currentLine, e.currentSub = line.Num, line.Sub
+		text := replacer.Replace(line.Text)
+		if e.Recorder != nil {
+			e.Recorder.RecordLine(e.VMID, line.Num, text)
+		}
+		if err := e.executeScriptLine(scriptLine{Num: line.Num, Text: text, Code: line.Code}); err != nil {
+			failed++
+			fmt.Fprintf(e.Output, "Line %d: %s\n", line.Num, maskError(err))
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d line(s) of the <%s> block failed", failed, name)
+	}
+	return nil
+}
+
+// errorVars returns the variables available to an <on-error> block
+func errorVars(lineErr LineError) map[string]string {
+	return map[string]string{
+		"ERROR_LINE":    strconv.Itoa(lineErr.Line),
+		"ERROR_MESSAGE": lineErr.Message,
+	}
+}
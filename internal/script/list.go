@@ -0,0 +1,58 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// listPattern matches list definitions: NAME=(ITEM ITEM "ITEM WITH SPACES")
+var listPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)=\((.*)\)$`)
+
+// extractLists removes list definitions from lines and returns the lists by
+// name. Lists are defined before the script runs, so a <for> can use a list
+// defined anywhere in the script.
+func extractLists(lines []scriptLine) ([]scriptLine, map[string][]string, error) {
+	var body []scriptLine
+	lists := map[string][]string{}
+
+	for _, line := range lines {
+		match := listPattern.FindStringSubmatch(line.Text)
+		if match == nil || line.Code != "" {
+			body = append(body, line)
+			continue
+		}
+		if _, ok := lists[match[1]]; ok {
+			return nil, nil, fmt.Errorf("line %d: list %q is already defined", line.Num, match[1])
+		}
+		lists[match[1]] = append([]string{}, splitQuoted(match[2])...)
+	}
+	return body, lists, nil
+}
+
+// parseForHeader parses <for NAME in ITEM...>. Items are words, quoted
+// strings or $LIST / ${LIST} references, which insert the items of a list.
+func parseForHeader(text string, lists map[string][]string) (loopFrame, error) {
+	parts := splitQuoted(text[1 : len(text)-1])
+	if len(parts) < 3 || parts[2] != "in" {
+		return loopFrame{}, fmt.Errorf("Invalid for command format. Use <for NAME in ITEM... | $LIST>")
+	}
+	if !loopNamePattern.MatchString(parts[1]) {
+		return loopFrame{}, fmt.Errorf("invalid loop variable name %q", parts[1])
+	}
+
+	items := []string{}
+	for _, part := range parts[3:] {
+		if ref := varPattern.FindString(part); ref == "" || ref != part {
+			items = append(items, part)
+			continue
+		}
+		name := strings.Trim(part, "${}")
+		list, ok := lists[name]
+		if !ok {
+			return loopFrame{}, fmt.Errorf("undefined list %q", name)
+		}
+		items = append(items, list...)
+	}
+	return loopFrame{name: parts[1], items: items, to: len(items) - 1, step: 1}, nil
+}
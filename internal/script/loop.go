@@ -0,0 +1,212 @@
+package script
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// loopFrame is an active <loop> or <for> block
+type loopFrame struct {
+	name  string
+	value int
+	to    int
+	step  int
+	// items are the values of a <for> loop; value is the index of the
+	// current item. items is nil for <loop>.
+	items []string
+	// start and end are the indexes of the <loop> or <for> line and of
+	// the line ending it
+	start int
+	end   int
+}
+
+// loops tracks the <loop> and <for> blocks of a script and the loops being run
+type loops struct {
+	// ends maps the index of each <loop> and <for> line to its end line
+	ends  map[int]int
+	lists map[string][]string
+	stack []loopFrame
+}
+
+// loopEnds maps the loop directives to the lines that end them
+var loopEnds = map[string]string{"loop": "end-loop", "for": "end-for"}
+
+// loopNamePattern matches valid loop variable names
+var loopNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// varPattern matches $NAME and ${NAME} references
+var varPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// parseLoops matches <loop> and <for> lines with their <end-loop> and
+// <end-for> and checks that <break> and <continue> only appear inside loops.
+// lists holds the lists <for> loops can iterate.
+func parseLoops(lines []scriptLine, lists map[string][]string) (*loops, error) {
+	l := &loops{ends: map[int]int{}, lists: lists}
+	var open []int
+
+	for i, line := range lines {
+		switch name := directiveName(line.Text); name {
+		case "loop", "for":
+			if _, err := l.parseHeader(line.Text); err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.Num, err)
+			}
+			open = append(open, i)
+		case "end-loop", "end-for":
+			if len(open) == 0 {
+				return nil, fmt.Errorf("line %d: <%s> without <%s>", line.Num, name, strings.TrimPrefix(name, "end-"))
+			}
+			start := lines[open[len(open)-1]]
+			if loopEnds[directiveName(start.Text)] != name {
+				return nil, fmt.Errorf("line %d: <%s> cannot end the <%s> block started on line %d", line.Num, name, directiveName(start.Text), start.Num)
+			}
+			l.ends[open[len(open)-1]] = i
+			open = open[:len(open)-1]
+		case "break", "continue":
+			if len(open) == 0 {
+				return nil, fmt.Errorf("line %d: <%s> outside of a <loop> or <for> block", line.Num, name)
+			}
+		}
+	}
+	if len(open) > 0 {
+		start := lines[open[len(open)-1]]
+		name := directiveName(start.Text)
+		return nil, fmt.Errorf("line %d: <%s> block is missing <%s>", start.Num, name, loopEnds[name])
+	}
+	return l, nil
+}
+
+// parseHeader parses a <loop> or <for> line
+func (l *loops) parseHeader(text string) (loopFrame, error) {
+	if directiveName(text) == "for" {
+		return parseForHeader(text, l.lists)
+	}
+	return parseLoopHeader(text)
+}
+
+// parseLoopHeader parses <loop NAME from A to B [step S]>. The step
+// defaults to 1, or -1 when counting down.
+func parseLoopHeader(text string) (loopFrame, error) {
+	usage := fmt.Errorf("Invalid loop command format. Use <loop NAME from A to B [step S]>")
+	parts := strings.Fields(text[1 : len(text)-1])
+	if (len(parts) != 6 && len(parts) != 8) || parts[2] != "from" || parts[4] != "to" {
+		return loopFrame{}, usage
+	}
+	if !loopNamePattern.MatchString(parts[1]) {
+		return loopFrame{}, fmt.Errorf("invalid loop variable name %q", parts[1])
+	}
+
+	from, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return loopFrame{}, fmt.Errorf("invalid loop start %q", parts[3])
+	}
+	to, err := strconv.Atoi(parts[5])
+	if err != nil {
+		return loopFrame{}, fmt.Errorf("invalid loop end %q", parts[5])
+	}
+
+	step := 1
+	if from > to {
+		step = -1
+	}
+	if len(parts) == 8 {
+		if parts[6] != "step" {
+			return loopFrame{}, usage
+		}
+		if step, err = strconv.Atoi(parts[7]); err != nil || step == 0 {
+			return loopFrame{}, fmt.Errorf("invalid loop step %q", parts[7])
+		}
+	}
+	return loopFrame{name: parts[1], value: from, to: to, step: step}, nil
+}
+
+// done reports whether the loop counter has passed its end value
+func (f loopFrame) done() bool {
+	if f.step > 0 {
+		return f.value > f.to
+	}
+	return f.value < f.to
+}
+
+// control runs a loop control line at index pc and returns the index of the
+// next line to run. handled is false for all other lines.
+func (l *loops) control(pc int, line scriptLine) (next int, handled bool, err error) {
+	name := directiveName(line.Text)
+	switch name {
+	case "loop", "for":
+		frame, _ := l.parseHeader(line.Text)
+		frame.start, frame.end = pc, l.ends[pc]
+		if frame.done() {
+			return frame.end + 1, true, nil
+		}
+		l.stack = append(l.stack, frame)
+		return pc + 1, true, nil
+	case "end-loop", "end-for", "break", "continue":
+		// A resumed run can start inside a loop whose header was skipped
+		if len(l.stack) == 0 {
+			return pc, true, fmt.Errorf("<%s> outside a running loop (was the run resumed inside a loop?)", name)
+		}
+	default:
+		return pc, false, nil
+	}
+
+	switch name {
+	case "end-loop", "end-for":
+		frame := &l.stack[len(l.stack)-1]
+		frame.value += frame.step
+		if !frame.done() {
+			return frame.start + 1, true, nil
+		}
+		l.stack = l.stack[:len(l.stack)-1]
+		return pc + 1, true, nil
+	case "break":
+		frame := l.stack[len(l.stack)-1]
+		l.stack = l.stack[:len(l.stack)-1]
+		return frame.end + 1, true, nil
+	default:
+		// <continue> runs the <end-loop> or <end-for> line to advance the counter
+		return l.stack[len(l.stack)-1].end, true, nil
+	}
+}
+
+// active reports whether a loop is running
+func (l *loops) active() bool {
+	return len(l.stack) > 0
+}
+
+// unwind stops the running loops that do not contain the line at index pc,
+// e.g. after a failure jumped to a <catch> outside them
+func (l *loops) unwind(pc int) {
+	for len(l.stack) > 0 {
+		frame := l.stack[len(l.stack)-1]
+		if pc > frame.start && pc <= frame.end {
+			return
+		}
+		l.stack = l.stack[:len(l.stack)-1]
+	}
+}
+
+// expand replaces $NAME and ${NAME} references to loop variables in text.
+// In a <for> loop, NAME is the current item and NAME_INDEX its index.
+// Inner loops shadow outer loops with the same variable name.
+func (l *loops) expand(text string) string {
+	if len(l.stack) == 0 {
+		return text
+	}
+	return varPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		name := strings.Trim(ref, "${}")
+		for i := len(l.stack) - 1; i >= 0; i-- {
+			frame := l.stack[i]
+			switch {
+			case frame.name == name && frame.items != nil:
+				return frame.items[frame.value]
+			case frame.name == name:
+				return strconv.Itoa(frame.value)
+			case frame.name+"_INDEX" == name && frame.items != nil:
+				return strconv.Itoa(frame.value)
+			}
+		}
+		return ref
+	})
+}
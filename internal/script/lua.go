@@ -0,0 +1,188 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/qmp"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// luaBlockEnd ends an inline <script lua> block
+const luaBlockEnd = "<end-script>"
+
+// extractEmbedded folds inline <script lua> ... <end-script> blocks into a
+// single line carrying the block's code. <script lua "FILE"> lines are left
+// as they are and load their code when executed.
+func extractEmbedded(lines []scriptLine) ([]scriptLine, error) {
+	var out []scriptLine
+	var block *scriptLine
+	var code []string
+
+	for _, line := range lines {
+		if block != nil {
+			if line.Text != luaBlockEnd {
+				code = append(code, line.Text)
+				continue
+			}
+			if len(code) > 0 {
+				block.Code = strings.Join(code, "\n")
+				out = append(out, *block)
+			}
+			block, code = nil, nil
+			continue
+		}
+
+		switch {
+		case line.Text == luaBlockEnd:
+			return nil, fmt.Errorf("line %d: %s without <script lua>", line.Num, luaBlockEnd)
+		case directiveName(line.Text) == "script":
+			args := splitQuoted(strings.TrimSpace(line.Text[len("<script") : len(line.Text)-1]))
+			if len(args) == 0 || args[0] != "lua" {
+				return nil, fmt.Errorf("line %d: unsupported embedded language (use <script lua> or <script lua \"FILE\">)", line.Num)
+			}
+			if len(args) == 1 {
+				block = &scriptLine{Num: line.Num, Text: line.Text}
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+
+	if block != nil {
+		return nil, fmt.Errorf("line %d: <script lua> block is missing %s", block.Num, luaBlockEnd)
+	}
+	return out, nil
+}
+
+// executeScriptLine runs a script line, or the code of an embedded block
+func (e *Executor) executeScriptLine(line scriptLine) error {
+	if line.Code != "" {
+		return e.runLua(line.Code, fmt.Sprintf("<script lua> at line %d", line.Num))
+	}
+	return e.ExecuteLine(line.Text)
+}
+
+// runLuaFile runs the Lua code in a file for <script lua "FILE">
+func (e *Executor) runLuaFile(args []string) error {
+	if len(args) != 2 || args[0] != "lua" {
+		return fmt.Errorf("Invalid script command format. Use <script lua \"FILE\"> or a <script lua> ... %s block", luaBlockEnd)
+	}
+	code, err := e.readFile(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to read Lua script: %v", err)
+	}
+	return e.runLua(string(code), args[1])
+}
+
+// runLua runs Lua code. All blocks of a run share one Lua state, so
+// globals set in one block are visible in later ones.
+func (e *Executor) runLua(code string, name string) error {
+	if e.lua == nil {
+		e.lua = e.newLuaState()
+	}
+	if e.ctx != nil {
+		e.lua.SetContext(e.ctx)
+		defer e.lua.RemoveContext()
+	}
+
+	e.log().Debug("Running Lua code", "chunk", name)
+	fn, err := e.lua.Load(strings.NewReader(code), name)
+	if err != nil {
+		return fmt.Errorf("Lua syntax error: %v", err)
+	}
+	e.lua.Push(fn)
+	if err := e.lua.PCall(0, lua.MultRet, nil); err != nil {
+		if e.ctx != nil && e.ctx.Err() != nil {
+			return e.ctx.Err()
+		}
+		// Report the error value without the Lua stack traceback
+		if apiErr, ok := err.(*lua.ApiError); ok {
+			return fmt.Errorf("Lua error: %s", apiErr.Object.String())
+		}
+		return fmt.Errorf("Lua error: %v", err)
+	}
+	return nil
+}
+
+// newLuaState creates a Lua state with the script bindings:
+//
+//	sendText(text)    type text without pressing Enter
+//	sendLine(text)    type text and press Enter
+//	sendKeys(keys)    send keys and waits, e.g. "ctrl+alt+del, wait 500ms, enter"
+//	sleep(seconds)    pause the script
+//	run(line)         execute any script line or directive, e.g. run("<wait-stable>")
+//	log(message)      write a message to the log
+//	getenv(name)      read an environment variable listed in LuaEnv
+//
+// Only the base, table, string and math libraries are opened, and dofile,
+// loadfile, require and module are removed. What the bindings can reach is
+// what the executor allows: run() goes through ExecuteLine, so restricted
+// executors reject the same directives there as in the script itself.
+func (e *Executor) newLuaState() *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.open))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	for _, name := range []string{"dofile", "loadfile", "require", "module"} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	e.registerLua(L, "sendText", func(L *lua.LState) error {
+		text := L.CheckString(1)
+		return e.sendInput(func(c *qmp.Client) error { return c.PasteText(text, e.Delay, e.ChunkSize, e.ChunkPause) })
+	})
+	e.registerLua(L, "sendLine", func(L *lua.LState) error {
+		text := L.CheckString(1)
+		if err := e.conn.Do(func(c *qmp.Client) error { return c.PasteText(text, e.Delay, e.ChunkSize, e.ChunkPause) }); err != nil {
+			return err
+		}
+		return e.sendInput(func(c *qmp.Client) error { return c.SendKey("ret") })
+	})
+	e.registerLua(L, "sendKeys", func(L *lua.LState) error {
+		keys := L.CheckString(1)
+		return e.sendInput(func(c *qmp.Client) error { return c.SendKeySequence(keys) })
+	})
+	e.registerLua(L, "sleep", func(L *lua.LState) error {
+		return e.sleep(time.Duration(float64(L.CheckNumber(1)) * float64(time.Second)))
+	})
+	e.registerLua(L, "run", func(L *lua.LState) error {
+		return e.ExecuteLine(strings.TrimSpace(L.CheckString(1)))
+	})
+	e.registerLua(L, "log", func(L *lua.LState) error {
+		e.log().Info(L.CheckString(1), "line", e.currentLine)
+		return nil
+	})
+	L.SetGlobal("getenv", L.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		if !slices.Contains(e.LuaEnv, name) {
+			L.RaiseError("getenv: %s is not an allowed environment variable", name)
+		}
+		L.Push(lua.LString(os.Getenv(name)))
+		return 1
+	}))
+	return L
+}
+
+// registerLua exposes fn to Lua as a global function; errors are raised as Lua errors
+func (e *Executor) registerLua(L *lua.LState, name string, fn func(*lua.LState) error) {
+	L.SetGlobal(name, L.NewFunction(func(L *lua.LState) int {
+		if err := fn(L); err != nil {
+			L.RaiseError("%s: %v", name, err)
+		}
+		return 0
+	}))
+}
@@ -0,0 +1,226 @@
+package script
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxMacroDepth limits nested macro calls so recursive macros fail cleanly
+const maxMacroDepth = 10
+
+// builtinDirectives lists the directive names that macros may not shadow
+var builtinDirectives = map[string]bool{
+	"sleep": true, "mouse-move": true, "mouse-move-rel": true, "mouse-click": true,
+	"mouse-scroll": true, "checkpoint": true, "guest-exec": true, "eject": true,
+	"insert-iso": true, "snapshot-save": true, "snapshot-restore": true, "key": true,
+	"hold": true, "key-down": true, "key-up": true, "keys": true, "qmp": true,
+	"notify": true, "raw-keys": true, "type": true, "connect-ssh": true,
+	"disconnect-ssh": true, "paste-file": true, "assert-region": true,
+	"wait-stable": true, "wait-for-boot": true, "wait-net": true, "wait-until": true,
+	"script": true, "end-script": true, "loop": true, "end-loop": true, "break": true,
+	"continue": true, "timing": true, "keymap": true, "on-exit": true,
+	"on-error": true, "end": true, "macro": true, "end-macro": true, "try": true,
+	"catch": true, "finally": true, "end-try": true, "for": true, "end-for": true,
+}
+
+// macro is a named block of lines defined with <macro NAME [PARAM[=DEFAULT]]...>
+type macro struct {
+	name string
+	// params are the parameter names in definition order
+	params []string
+	// defaults holds default values; parameters without one are required
+	defaults map[string]string
+	body     []scriptLine
+}
+
+// expandMacros removes <macro> ... <end-macro> definitions from lines and
+// replaces every call of a defined macro with its body. Expanded lines keep
+// the line number of the call.
+func expandMacros(lines []scriptLine) ([]scriptLine, error) {
+	macros := map[string]*macro{}
+	var body []scriptLine
+	var current *macro
+	start := 0
+
+	for _, line := range lines {
+		switch directiveName(line.Text) {
+		case "macro":
+			if current != nil {
+				return nil, fmt.Errorf("line %d: macro definitions cannot be nested", line.Num)
+			}
+			m, err := parseMacroHeader(line.Text)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line.Num, err)
+			}
+			if _, ok := macros[m.name]; ok {
+				return nil, fmt.Errorf("line %d: macro %q is already defined", line.Num, m.name)
+			}
+			macros[m.name] = m
+			current, start = m, line.Num
+		case "end-macro":
+			if current == nil {
+				return nil, fmt.Errorf("line %d: <end-macro> without <macro>", line.Num)
+			}
+			current = nil
+		default:
+			if current != nil {
+				current.body = append(current.body, line)
+			} else {
+				body = append(body, line)
+			}
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("line %d: <macro %s> is missing <end-macro>", start, current.name)
+	}
+	if len(macros) == 0 {
+		return body, nil
+	}
+	return callMacros(body, macros, 0)
+}
+
+// callMacros replaces macro calls in lines with the expanded macro bodies
+func callMacros(lines []scriptLine, macros map[string]*macro, depth int) ([]scriptLine, error) {
+	var out []scriptLine
+	for _, line := range lines {
+		m, ok := macros[directiveName(line.Text)]
+		if !ok {
+			out = append(out, line)
+			continue
+		}
+		if depth >= maxMacroDepth {
+			return nil, fmt.Errorf("line %d: macro calls nested more than %d deep (recursive macro %q?)", line.Num, maxMacroDepth, m.name)
+		}
+
+		args := splitQuoted(strings.TrimSpace(line.Text[1+len(m.name) : len(line.Text)-1]))
+		values, err := m.bind(args)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.Num, err)
+		}
+
+		expanded := make([]scriptLine, 0, len(m.body))
+		for _, bodyLine := range m.body {
+			expanded = append(expanded, scriptLine{
+				Num:    line.Num,
+				Text:   substituteVars(bodyLine.Text, values),
+				Macro:  m.name,
+				Source: bodyLine.Num,
+			})
+		}
+		expanded, err = callMacros(expanded, macros, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		// Number the fully expanded lines of a top-level call
+		if depth == 0 {
+			for i := range expanded {
+				expanded[i].Sub = i + 1
+			}
+		}
+		out = append(out, expanded...)
+	}
+	return out, nil
+}
+
+// parseMacroHeader parses <macro NAME [PARAM[=DEFAULT]]...>
+func parseMacroHeader(text string) (*macro, error) {
+	fields := splitQuoted(strings.TrimSpace(text[len("<macro") : len(text)-1]))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("Invalid macro command format. Use <macro NAME [PARAM[=DEFAULT]]...>")
+	}
+
+	m := &macro{name: fields[0], defaults: map[string]string{}}
+	if strings.ContainsAny(m.name, "<>=\"") {
+		return nil, fmt.Errorf("invalid macro name %q", m.name)
+	}
+	if builtinDirectives[m.name] {
+		return nil, fmt.Errorf("macro name %q is a built-in directive", m.name)
+	}
+
+	for _, field := range fields[1:] {
+		name, value, hasDefault := strings.Cut(field, "=")
+		if !loopNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid macro parameter name %q", name)
+		}
+		m.params = append(m.params, name)
+		if hasDefault {
+			m.defaults[name] = value
+		}
+	}
+	return m, nil
+}
+
+// bind matches NAME=VALUE call arguments to the macro's parameters
+func (m *macro) bind(args []string) (map[string]string, error) {
+	values := map[string]string{}
+	for name, value := range m.defaults {
+		values[name] = value
+	}
+
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid argument %q for macro %s (use NAME=VALUE)", arg, m.name)
+		}
+		if _, known := m.defaults[name]; !known && !m.hasParam(name) {
+			return nil, fmt.Errorf("macro %s has no parameter %q", m.name, name)
+		}
+		values[name] = value
+	}
+
+	for _, name := range m.params {
+		if _, ok := values[name]; !ok {
+			return nil, fmt.Errorf("macro %s requires parameter %q", m.name, name)
+		}
+	}
+	return values, nil
+}
+
+// hasParam reports whether the macro declares the parameter
+func (m *macro) hasParam(name string) bool {
+	for _, param := range m.params {
+		if param == name {
+			return true
+		}
+	}
+	return false
+}
+
+// substituteVars replaces $NAME and ${NAME} references to the given
+// variables, leaving other references for later expansion
+func substituteVars(text string, vars map[string]string) string {
+	return varPattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if value, ok := vars[strings.Trim(ref, "${}")]; ok {
+			return value
+		}
+		return ref
+	})
+}
+
+// ExpandedLine is a script line after macro expansion
+type ExpandedLine struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Expand reads a script and returns its lines with macros expanded, as
+// they would be executed. Lua blocks are shown as a single line.
+func Expand(r io.Reader) ([]ExpandedLine, error) {
+	lines, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+	if lines, err = expandMacros(lines); err != nil {
+		return nil, err
+	}
+	if lines, err = extractEmbedded(lines); err != nil {
+		return nil, err
+	}
+
+	expanded := make([]ExpandedLine, 0, len(lines))
+	for _, line := range lines {
+		expanded = append(expanded, ExpandedLine{Line: line.Num, Text: line.Text})
+	}
+	return expanded, nil
+}
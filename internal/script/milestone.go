@@ -0,0 +1,44 @@
+package script
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jstein/qmp/internal/notify"
+)
+
+// watchMilestones sends a notification every WaitMilestone while a wait
+// directive runs, so an unattended install that wedges is noticed long
+// before its timeout. The returned function stops the notifications.
+func (e *Executor) watchMilestones(what string) func() {
+	if e.WaitMilestone <= 0 || !e.Notifier.Enabled() {
+		return func() {}
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(e.WaitMilestone)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				elapsed := time.Since(start).Round(time.Second)
+				msg := notify.Message{
+					Level: notify.LevelInfo,
+					Title: fmt.Sprintf("Script on VM %s still waiting", e.VMID),
+					Text:  fmt.Sprintf("%s has been running for %v", what, elapsed),
+				}
+				if err := e.Notifier.Notify(msg); err != nil {
+					e.log().Warn("Failed to send wait milestone notification", "error", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
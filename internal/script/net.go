@@ -0,0 +1,64 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/netwait"
+)
+
+// Defaults for <wait-net>
+const (
+	defaultNetPort     = 22
+	defaultNetTimeout  = 300 * time.Second
+	defaultNetInterval = 2 * time.Second
+)
+
+// waitNet handles <wait-net HOST [port=22] [timeout=300s] [interval=2s]>: it
+// waits until a TCP port on the guest is reachable from this host, e.g.
+// before handing over to SSH or Ansible
+func (e *Executor) waitNet(args []string) error {
+	if len(args) < 1 || strings.Contains(args[0], "=") {
+		return fmt.Errorf("Invalid wait-net command format. Use <wait-net HOST [port=22] [timeout=300s] [interval=2s]>")
+	}
+	host := args[0]
+
+	port := defaultNetPort
+	var options []string
+	for _, option := range args[1:] {
+		if value, ok := strings.CutPrefix(option, "port="); ok {
+			var err error
+			if port, err = strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+				return fmt.Errorf("Invalid wait-net port %q", value)
+			}
+			continue
+		}
+		options = append(options, option)
+	}
+
+	timeout, interval := defaultNetTimeout, defaultNetInterval
+	if err := parseWaitOptions("wait-net", options, map[string]*time.Duration{
+		"timeout":  &timeout,
+		"interval": &interval,
+	}); err != nil {
+		return err
+	}
+
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	address := netwait.Address(host, port)
+	e.log().Info("Waiting for network", "address", address, "timeout", timeout)
+	defer e.watchMilestones(fmt.Sprintf("<wait-net %s>", address))()
+	result, err := netwait.Wait(ctx, address, timeout, interval)
+	if err != nil {
+		return err
+	}
+	e.log().Info("Network reachable", "address", address, "elapsed", result.Elapsed.Round(time.Millisecond))
+	return nil
+}
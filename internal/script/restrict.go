@@ -0,0 +1,69 @@
+package script
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/jstein/qmp/internal/screen"
+)
+
+// restrictedDirectives reach the host running the script rather than the
+// VM: raw QMP can make QEMU run commands or open host files, <insert-iso>
+// takes a host path and <connect-ssh> uses this host's keys
+var restrictedDirectives = map[string]bool{
+	"qmp":         true,
+	"insert-iso":  true,
+	"connect-ssh": true,
+}
+
+// checkRestricted rejects directives a restricted script may not use
+func (e *Executor) checkRestricted(directive string) error {
+	if e.Restricted && restrictedDirectives[directive] {
+		return fmt.Errorf("<%s> is not allowed in restricted scripts", directive)
+	}
+	return nil
+}
+
+// openFile opens a file named by a directive. Restricted scripts can only
+// open relative paths inside FileDir.
+func (e *Executor) openFile(name string) (*os.File, error) {
+	if !e.Restricted {
+		return os.Open(name)
+	}
+	if e.FileDir == "" {
+		return nil, fmt.Errorf("reading files is not allowed in restricted scripts")
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("file %q must be a relative path inside the scripts directory", name)
+	}
+
+	root, err := os.OpenRoot(e.FileDir)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	return root.Open(name)
+}
+
+// loadImage loads a reference image named by a directive, see openFile
+func (e *Executor) loadImage(name string) (image.Image, error) {
+	file, err := e.openFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open image: %v", err)
+	}
+	defer file.Close()
+	return screen.DecodeImage(file, name)
+}
+
+// readFile reads a file named by a directive, see openFile
+func (e *Executor) readFile(name string) ([]byte, error) {
+	file, err := e.openFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
@@ -0,0 +1,81 @@
+package script
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// secretPattern matches ${secret:NAME} references in script lines
+var secretPattern = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_.-]*)\}`)
+
+// Secrets resolves ${secret:NAME} references from a secrets file, falling
+// back to environment variables of the same name
+type Secrets struct {
+	values map[string]string
+	// noEnv disables the environment fallback
+	noEnv bool
+}
+
+// NewSecrets creates an empty secret store that only resolves from the environment
+func NewSecrets() *Secrets {
+	return &Secrets{values: map[string]string{}}
+}
+
+// LoadSecrets reads a YAML file of NAME: value pairs
+func LoadSecrets(filename string) (*Secrets, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %v", err)
+	}
+
+	values := map[string]string{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse secrets file %s: %v", filename, err)
+	}
+
+	return &Secrets{values: values}, nil
+}
+
+// Lookup returns the value of a secret from the file or the environment
+func (s *Secrets) Lookup(name string) (string, bool) {
+	if value, ok := s.values[name]; ok {
+		return value, true
+	}
+	if s.noEnv {
+		return "", false
+	}
+	return os.LookupEnv(name)
+}
+
+// withoutEnv returns a copy of the store that only resolves from the file
+func (s *Secrets) withoutEnv() *Secrets {
+	return &Secrets{values: s.values, noEnv: true}
+}
+
+// Expand replaces every ${secret:NAME} reference in line. It also returns
+// the values that were substituted so the caller can mask them.
+func (s *Secrets) Expand(line string) (string, []string, error) {
+	var used []string
+	var missing string
+
+	expanded := secretPattern.ReplaceAllStringFunc(line, func(ref string) string {
+		name := secretPattern.FindStringSubmatch(ref)[1]
+		value, ok := s.Lookup(name)
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return ref
+		}
+		used = append(used, value)
+		return value
+	})
+
+	if missing != "" {
+		return "", nil, fmt.Errorf("secret %q is not set in the secrets file or environment", missing)
+	}
+	return expanded, used, nil
+}
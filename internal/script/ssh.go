@@ -0,0 +1,97 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// sshTarget describes the guest that lines are sent to after <connect-ssh>
+type sshTarget struct {
+	Host string
+	User string
+	Key  string
+	Port string
+}
+
+// args returns the ssh command line for running command on the target
+func (t *sshTarget) args(command string) []string {
+	args := []string{
+		"-o", "BatchMode=yes",
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "ConnectTimeout=10",
+	}
+	if t.Key != "" {
+		args = append(args, "-i", t.Key)
+	}
+	if t.Port != "" {
+		args = append(args, "-p", t.Port)
+	}
+
+	destination := t.Host
+	if t.User != "" {
+		destination = t.User + "@" + t.Host
+	}
+	return append(args, destination, "--", command)
+}
+
+// connectSSH switches line execution to SSH.
+// Format: <connect-ssh HOST [user=USER] [key=PATH] [port=PORT]>
+func (e *Executor) connectSSH(command string, parts []string) error {
+	args := splitQuoted(strings.TrimSpace(strings.TrimPrefix(command, parts[0])))
+	if len(args) < 1 {
+		return fmt.Errorf("Invalid connect-ssh command format. Use <connect-ssh HOST [user=USER] [key=PATH] [port=PORT]>")
+	}
+
+	target := &sshTarget{Host: args[0]}
+	for _, option := range args[1:] {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "user":
+			target.User = value
+		case "key":
+			target.Key = value
+		case "port":
+			target.Port = value
+		default:
+			return fmt.Errorf("unknown connect-ssh option %q", option)
+		}
+	}
+
+	// Check that the guest is reachable before switching over
+	e.log().Info("Connecting over SSH", "host", target.Host, "user", target.User)
+	if _, err := runSSH(target, "true"); err != nil {
+		return fmt.Errorf("SSH connection to %s failed: %v", target.Host, err)
+	}
+
+	e.ssh = target
+	return nil
+}
+
+// runSSH runs a command on the target and returns its combined output
+func runSSH(target *sshTarget, command string) (string, error) {
+	cmd := exec.Command("ssh", target.args(command)...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return output.String(), fmt.Errorf("command exited with code %d: %s", exitErr.ExitCode(), strings.TrimSpace(output.String()))
+	}
+	if err != nil {
+		return output.String(), fmt.Errorf("failed to run ssh: %v", err)
+	}
+	return output.String(), nil
+}
+
+// executeSSHLine runs a script line over SSH instead of typing it
+func (e *Executor) executeSSHLine(line string) error {
+	e.log().Info("Executing line over SSH", "host", e.ssh.Host, "line", line)
+	output, err := runSSH(e.ssh, line)
+	if output != "" {
+		e.log().Debug("SSH command output", "output", strings.TrimSpace(output))
+	}
+	return err
+}
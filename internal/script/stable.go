@@ -0,0 +1,187 @@
+package script
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/screen"
+)
+
+// Defaults for <wait-stable> and <wait-for-boot>
+const (
+	defaultStableTimeout  = 120 * time.Second
+	defaultStableInterval = time.Second
+	defaultBootTimeout    = 300 * time.Second
+	defaultBootQuiet      = 10 * time.Second
+	defaultBootInterval   = 2 * time.Second
+)
+
+// stability tracks how long the screen has been unchanged
+type stability struct {
+	previous image.Image
+	since    time.Time
+}
+
+// update records a capture and returns how long the screen has been unchanged
+func (s *stability) update(img image.Image) time.Duration {
+	if s.previous == nil {
+		s.since = time.Now()
+	} else if diff, err := screen.Compare(img, s.previous, 0); err != nil || diff > 0 {
+		// A resolution change counts as a change
+		s.since = time.Now()
+	}
+	s.previous = img
+	return time.Since(s.since)
+}
+
+// parseWaitOptions parses KEY=DURATION options into the given durations
+func parseWaitOptions(directive string, args []string, options map[string]*time.Duration) error {
+	for _, option := range args {
+		key, value, _ := strings.Cut(option, "=")
+		target, ok := options[key]
+		if !ok {
+			return fmt.Errorf("unknown %s option %q", directive, option)
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("Invalid %s %s: %v", directive, key, err)
+		}
+		*target = duration
+	}
+	return nil
+}
+
+// captureScreen takes a screenshot of the VM display
+func (e *Executor) captureScreen() (image.Image, error) {
+	if e.Capture != nil {
+		return e.Capture()
+	}
+
+	var img image.Image
+	err := e.conn.DoPriority(qmp.PriorityCapture, func(c *qmp.Client) error {
+		var err error
+		img, err = c.CaptureImage()
+		return err
+	})
+	return img, err
+}
+
+// waitStable handles <wait-stable QUIET [timeout=D] [interval=D]>: it waits
+// until the screen has not changed for the quiet period, e.g. after package
+// installs or boot storms where no specific output is known
+func (e *Executor) waitStable(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("Invalid wait-stable command format. Use <wait-stable 5s [timeout=120s] [interval=1s]>")
+	}
+	quiet, err := time.ParseDuration(args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid wait-stable duration: %v", err)
+	}
+
+	timeout, interval := defaultStableTimeout, defaultStableInterval
+	if err := parseWaitOptions("wait-stable", args[1:], map[string]*time.Duration{
+		"timeout":  &timeout,
+		"interval": &interval,
+	}); err != nil {
+		return err
+	}
+
+	defer e.watchMilestones(fmt.Sprintf("<wait-stable %v>", quiet))()
+
+	deadline := time.Now().Add(timeout)
+	var tracker stability
+	for {
+		img, err := e.captureScreen()
+		if err != nil {
+			return err
+		}
+		if tracker.update(img) >= quiet {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("screen did not stay unchanged for %v within %v", quiet, timeout)
+		}
+		if err := e.sleep(interval); err != nil {
+			return err
+		}
+	}
+
+	e.log().Debug("Screen stable", "quiet", quiet)
+	return nil
+}
+
+// waitForBoot handles <wait-for-boot [timeout=300s] [quiet=10s] [interval=2s]>.
+// The guest counts as booted once the VM is running and either the guest
+// agent responds or the screen has been unchanged for the quiet period.
+func (e *Executor) waitForBoot(args []string) error {
+	timeout, quiet, interval := defaultBootTimeout, defaultBootQuiet, defaultBootInterval
+	if err := parseWaitOptions("wait-for-boot", args, map[string]*time.Duration{
+		"timeout":  &timeout,
+		"quiet":    &quiet,
+		"interval": &interval,
+	}); err != nil {
+		return err
+	}
+
+	defer e.watchMilestones("<wait-for-boot>")()
+
+	deadline := time.Now().Add(timeout)
+	var tracker stability
+	for {
+		booted, reason, err := e.bootCheck(&tracker, quiet)
+		if err != nil {
+			return err
+		}
+		if booted {
+			e.log().Info("Guest finished booting", "reason", reason)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("guest did not finish booting within %v", timeout)
+		}
+		if err := e.sleep(interval); err != nil {
+			return err
+		}
+	}
+}
+
+// bootCheck runs the boot heuristics once
+func (e *Executor) bootCheck(tracker *stability, quiet time.Duration) (bool, string, error) {
+	var status map[string]interface{}
+	if err := e.conn.DoPriority(qmp.PriorityQuery, func(c *qmp.Client) error {
+		var err error
+		status, err = c.QueryStatus()
+		return err
+	}); err != nil {
+		return false, "", err
+	}
+	if running, _ := status["running"].(bool); !running {
+		e.log().Debug("Waiting for VM to run", "status", status["status"])
+		return false, "", nil
+	}
+
+	// A responding guest agent means userspace is up
+	if e.agent == nil && e.GuestAgent != nil {
+		if agent, err := e.GuestAgent(); err == nil {
+			if err := agent.Ping(); err == nil {
+				e.agent, e.agentChecked = agent, true
+				return true, "guest agent responding", nil
+			}
+			agent.Close()
+		}
+	} else if e.agent != nil && e.agent.Ping() == nil {
+		return true, "guest agent responding", nil
+	}
+
+	img, err := e.captureScreen()
+	if err != nil {
+		return false, "", err
+	}
+	if unchanged := tracker.update(img); unchanged >= quiet {
+		return true, fmt.Sprintf("screen unchanged for %v", unchanged.Truncate(time.Second)), nil
+	}
+	return false, "", nil
+}
@@ -0,0 +1,39 @@
+package script
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadValues reads a YAML file of template values
+func LoadValues(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read values file: %v", err)
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse values file %s: %v", filename, err)
+	}
+	return values, nil
+}
+
+// Render expands Go template syntax ({{ .Hostname }}, {{ range .Disks }})
+// in a script using the given values. Referencing a missing value is an error.
+func Render(name string, source []byte, values map[string]interface{}) ([]byte, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse script template: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return nil, fmt.Errorf("failed to render script template: %v", err)
+	}
+	return out.Bytes(), nil
+}
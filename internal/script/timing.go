@@ -0,0 +1,27 @@
+package script
+
+import "sort"
+
+// Slowest returns up to n executed steps ordered by duration, slowest first
+func (r *Result) Slowest(n int) []Step {
+	steps := make([]Step, len(r.Steps))
+	copy(steps, r.Steps)
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Duration > steps[j].Duration
+	})
+	if n >= 0 && len(steps) > n {
+		steps = steps[:n]
+	}
+	return steps
+}
+
+// OverBudget returns the steps that took longer than the line budget
+func (r *Result) OverBudget() []Step {
+	var steps []Step
+	for _, step := range r.Steps {
+		if step.OverBudget {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
@@ -0,0 +1,246 @@
+package script
+
+import (
+	"fmt"
+	"strings"
+)
+
+// tryBlock holds the indexes of the <catch>, <finally> and <end-try> lines
+// of a <try> block; catch and finally are -1 when the block has none
+type tryBlock struct {
+	catch   int
+	finally int
+	end     int
+}
+
+// tryFrame is an active <try> block
+type tryFrame struct {
+	block tryBlock
+	// start is the index of the <try> line
+	start int
+	// caught is the failure handled by the <catch> section
+	caught *LineError
+	// pending is a failure that leaves the block once <finally> has run
+	pending *failure
+}
+
+// failure is a failed script line. abort is set for failures that stop the
+// script when nothing catches them (failed assertions, a paused VM).
+type failure struct {
+	err   LineError
+	abort bool
+}
+
+// tries tracks the <try> blocks of a script and the blocks being run
+type tries struct {
+	// blocks maps the index of each <try> line to its layout
+	blocks map[int]tryBlock
+	stack  []tryFrame
+}
+
+// parseTries matches <try>, <catch>, <finally> and <end-try> lines and
+// checks that try blocks and loops do not overlap
+func parseTries(lines []scriptLine) (*tries, error) {
+	t := &tries{blocks: map[int]tryBlock{}}
+	// open holds the indexes of the unfinished <try>, <loop> and <for> lines
+	var open []int
+	inTry := func() bool {
+		return len(open) > 0 && directiveName(lines[open[len(open)-1]].Text) == "try"
+	}
+
+	for i, line := range lines {
+		name := directiveName(line.Text)
+		switch name {
+		case "try":
+			if line.Text != "<try>" {
+				return nil, fmt.Errorf("line %d: Invalid try command format. Use <try>", line.Num)
+			}
+			open = append(open, i)
+			t.blocks[i] = tryBlock{catch: -1, finally: -1}
+		case "loop", "for":
+			open = append(open, i)
+		case "end-loop", "end-for":
+			if inTry() {
+				return nil, fmt.Errorf("line %d: <%s> inside the <try> block started on line %d", line.Num, name, lines[open[len(open)-1]].Num)
+			}
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case "catch", "finally", "end-try":
+			if line.Text != "<"+name+">" {
+				return nil, fmt.Errorf("line %d: Invalid %s command format. Use <%s>", line.Num, name, name)
+			}
+			if !inTry() && len(open) > 0 {
+				start := lines[open[len(open)-1]]
+				return nil, fmt.Errorf("line %d: <%s> inside the <%s> block started on line %d", line.Num, name, directiveName(start.Text), start.Num)
+			}
+			if !inTry() {
+				return nil, fmt.Errorf("line %d: <%s> without <try>", line.Num, name)
+			}
+			start := open[len(open)-1]
+			block := t.blocks[start]
+			switch {
+			case name == "catch" && (block.catch >= 0 || block.finally >= 0):
+				return nil, fmt.Errorf("line %d: <catch> must come once, before <finally>", line.Num)
+			case name == "catch":
+				block.catch = i
+			case name == "finally" && block.finally >= 0:
+				return nil, fmt.Errorf("line %d: duplicate <finally>", line.Num)
+			case name == "finally":
+				block.finally = i
+			case block.catch < 0 && block.finally < 0:
+				return nil, fmt.Errorf("line %d: <try> block needs a <catch> or <finally>", lines[start].Num)
+			default:
+				block.end = i
+				open = open[:len(open)-1]
+			}
+			t.blocks[start] = block
+		}
+	}
+	for _, i := range open {
+		if directiveName(lines[i].Text) == "try" {
+			return nil, fmt.Errorf("line %d: <try> block is missing <end-try>", lines[i].Num)
+		}
+	}
+	return t, nil
+}
+
+// control runs a try control line at index pc and returns the index of the
+// next line to run. handled is false for all other lines. At <end-try>,
+// pending is the failure that leaves the block, if any.
+func (t *tries) control(pc int, line scriptLine) (next int, handled bool, pending *failure, err error) {
+	name := directiveName(line.Text)
+	switch name {
+	case "try":
+		t.stack = append(t.stack, tryFrame{block: t.blocks[pc], start: pc})
+		return pc + 1, true, nil, nil
+	case "catch", "finally", "end-try":
+		// A resumed run can start inside a block whose <try> was skipped
+		if len(t.stack) == 0 {
+			return pc, true, nil, fmt.Errorf("<%s> outside a running try block (was the run resumed inside a try block?)", name)
+		}
+	default:
+		return pc, false, nil, nil
+	}
+
+	frame := t.stack[len(t.stack)-1]
+	switch name {
+	case "catch":
+		// The body finished without failing
+		if frame.block.finally >= 0 {
+			return frame.block.finally + 1, true, nil, nil
+		}
+		return frame.block.end, true, nil, nil
+	case "finally":
+		return pc + 1, true, nil, nil
+	default:
+		t.stack = t.stack[:len(t.stack)-1]
+		return pc + 1, true, frame.pending, nil
+	}
+}
+
+// raise passes a failure of the line at index pc to the innermost running
+// try block that handles it, and returns the index of the next line to run.
+// caught is set when a <catch> section takes the failure. next is -1 when
+// no block handles it and the failure counts against the script.
+func (t *tries) raise(pc int, f failure) (next int, caught bool) {
+	for i := len(t.stack) - 1; i >= 0; i-- {
+		frame := &t.stack[i]
+		block := frame.block
+		switch {
+		case block.catch >= 0 && pc < block.catch:
+			frame.caught = &f.err
+			t.stack = t.stack[:i+1]
+			return block.catch + 1, true
+		case block.finally >= 0 && pc < block.finally:
+			// From the body without a <catch>, or from the <catch> section
+			frame.pending = &f
+			t.stack = t.stack[:i+1]
+			return block.finally, false
+		}
+		// Failures in <finally>, or in <catch> without <finally>, leave the
+		// block; the enclosing block sees them at the <try> line
+		pc = frame.start
+	}
+	return -1, false
+}
+
+// unwind stops the running try blocks that do not contain the line at
+// index pc, e.g. after <break> left a loop from inside one
+func (t *tries) unwind(pc int) {
+	for len(t.stack) > 0 {
+		frame := t.stack[len(t.stack)-1]
+		if pc > frame.start && pc <= frame.block.end {
+			return
+		}
+		t.stack = t.stack[:len(t.stack)-1]
+	}
+}
+
+// active reports whether a try block is running
+func (t *tries) active() bool {
+	return len(t.stack) > 0
+}
+
+// expand replaces $ERROR_LINE and $ERROR_MESSAGE (or ${...}) with the
+// failure caught by the innermost running <catch> section
+func (t *tries) expand(text string) string {
+	for i := len(t.stack) - 1; i >= 0; i-- {
+		if t.stack[i].caught == nil {
+			continue
+		}
+		vars := errorVars(*t.stack[i].caught)
+		return varPattern.ReplaceAllStringFunc(text, func(ref string) string {
+			if value, ok := vars[strings.Trim(ref, "${}")]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+	return text
+}
+
+// raise passes a failure of the line at index pc to the running try blocks
+// and returns the index of the next line to run. A failure no block handles
+// counts against the script; -1 is returned when it stops the script.
+func (e *Executor) raise(result *Result, tries *tries, pc int, f failure) int {
+	next, caught := tries.raise(pc, f)
+	if caught {
+		e.log().Info("Caught failure", "line", f.err.Line, "error", f.err.Message)
+	}
+	if next >= 0 {
+		return next
+	}
+
+	result.Errors = append(result.Errors, f.err)
+	if f.abort {
+		result.Aborted = true
+		return -1
+	}
+	return pc + 1
+}
+
+// enterBlocks updates the running blocks after a jump to the line at index
+// next, and saves progress when no block is running
+func (e *Executor) enterBlocks(lines []scriptLine, loops *loops, tries *tries, next int) {
+	loops.unwind(next)
+	tries.unwind(next)
+
+	start := -1
+	if loops.active() {
+		start = loops.stack[0].start
+	}
+	if tries.active() && (start < 0 || tries.stack[0].start < start) {
+		start = tries.stack[0].start
+	}
+
+	e.blockLine = 0
+	if start >= 0 {
+		e.blockLine, e.blockSub = lines[start].Num, lines[start].Sub
+	} else if e.Checkpoint != nil {
+		// Progress is only saved between blocks, so a resumed run starts
+		// an interrupted block from its beginning
+		e.Checkpoint.Line, e.Checkpoint.Sub = lines[next-1].Num, lines[next-1].Sub
+		e.saveCheckpoint()
+	}
+}
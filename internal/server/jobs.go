@@ -0,0 +1,239 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/qmp"
+	"github.com/jstein/qmp/internal/script"
+)
+
+// Job states
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobCompleted = "completed"
+	JobFailed    = "failed"
+)
+
+// Job is an asynchronous script run
+type Job struct {
+	ID       string         `json:"id"`
+	VMID     string         `json:"vmid"`
+	Status   string         `json:"status"`
+	Error    string         `json:"error,omitempty"`
+	Result   *script.Result `json:"result,omitempty"`
+	Created  time.Time      `json:"created"`
+	Started  *time.Time     `json:"started,omitempty"`
+	Finished *time.Time     `json:"finished,omitempty"`
+}
+
+// jobStore keeps track of all jobs
+type jobStore struct {
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*Job
+}
+
+// newJobStore creates an empty job store
+func newJobStore() *jobStore {
+	return &jobStore{jobs: map[string]*Job{}}
+}
+
+// create registers a new pending job
+func (js *jobStore) create(vmid string) *Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.nextID++
+	job := &Job{
+		ID:      fmt.Sprintf("%d", js.nextID),
+		VMID:    vmid,
+		Status:  JobPending,
+		Created: time.Now(),
+	}
+	js.jobs[job.ID] = job
+	return job
+}
+
+// update applies fn to a job while holding the store lock
+func (js *jobStore) update(job *Job, fn func(*Job)) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	fn(job)
+}
+
+// get returns a copy of a job
+func (js *jobStore) get(id string) (Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	job, ok := js.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// list returns copies of all jobs ordered by creation time
+func (js *jobStore) list() []Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	jobs := make([]Job, 0, len(js.jobs))
+	for _, job := range js.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Created.Before(jobs[j].Created) })
+	return jobs
+}
+
+// runScriptRequest is the body of POST /scripts/run
+type runScriptRequest struct {
+	VMID string `json:"vmid"`
+	// Script holds the script contents; File is a path relative to the
+	// server's scripts directory
+	Script  string `json:"script"`
+	File    string `json:"file"`
+	DelayMS int    `json:"delay_ms"`
+}
+
+// handleRunScript starts a script run in the background and returns its job
+func (s *Server) handleRunScript(w http.ResponseWriter, r *http.Request) {
+	var req runScriptRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := validateVMID(req.VMID); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if (req.Script == "") == (req.File == "") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("exactly one of script or file is required"))
+		return
+	}
+
+	content := req.Script
+	if req.File != "" {
+		data, err := s.readScriptFile(req.File)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		content = string(data)
+	}
+
+	job := s.jobs.create(req.VMID)
+	go s.runJob(job, content, s.delay(req.DelayMS))
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// readScriptFile reads a script from the scripts directory. Absolute paths,
+// ".." and symlinks leading outside the directory are rejected.
+func (s *Server) readScriptFile(name string) ([]byte, error) {
+	if s.ScriptsDir == "" {
+		return nil, fmt.Errorf("script files are disabled (no scripts directory configured)")
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("script file %q must be a relative path inside the scripts directory", name)
+	}
+
+	root, err := os.OpenRoot(s.ScriptsDir)
+	if err != nil {
+		return nil, fmt.Errorf("error opening scripts directory: %v", err)
+	}
+	defer root.Close()
+
+	file, err := root.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("error opening script file: %v", err)
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// runJob executes a script for a job
+func (s *Server) runJob(job *Job, content string, delay time.Duration) {
+	logging.Info("Starting script job", "job", job.ID, "vmid", job.VMID)
+
+	// Other requests for this VM get 409 until the job finishes
+	s.lockVMForJob(job.VMID, job.ID)
+	defer s.unlockVM(job.VMID)
+
+	now := time.Now()
+	s.jobs.update(job, func(j *Job) {
+		j.Status = JobRunning
+		j.Started = &now
+	})
+
+	conn := qmp.NewManager(s.newClient(job.VMID))
+	var result *script.Result
+	var run *logging.RunFile
+	var err error
+	if s.LogFile != "" {
+		run, err = logging.OpenRunFile(logging.ExpandLogPath(s.LogFile, job.VMID, now), s.LogKeep)
+		if err == nil {
+			conn.SetLogger(run.Logger())
+		}
+	}
+	if err == nil {
+		err = conn.Connect()
+	}
+	if err == nil {
+		executor := script.NewExecutor(conn, delay)
+		executor.ScreenWidth, executor.ScreenHeight = s.ScreenWidth, s.ScreenHeight
+		executor.Output = io.Discard
+		executor.LogFile, run = run, nil
+		// API scripts must not reach this host's files, keys or environment
+		executor.Restricted, executor.FileDir = true, s.ScriptsDir
+		result, err = executor.Run(strings.NewReader(content))
+		executor.Close()
+		conn.Close()
+	}
+	if run != nil {
+		run.Close()
+	}
+
+	finished := time.Now()
+	s.jobs.update(job, func(j *Job) {
+		j.Finished = &finished
+		j.Result = result
+		switch {
+		case err != nil:
+			j.Status = JobFailed
+			j.Error = err.Error()
+		case !result.Success:
+			j.Status = JobFailed
+			j.Error = fmt.Sprintf("%d line(s) failed", len(result.Errors))
+		default:
+			j.Status = JobCompleted
+		}
+	})
+
+	logging.Info("Finished script job", "job", job.ID, "vmid", job.VMID, "error", err)
+}
+
+// handleListJobs returns all jobs
+func (s *Server) handleListJobs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.jobs.list())
+}
+
+// handleGetJob returns a single job for status polling
+func (s *Server) handleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := s.jobs.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("job %s not found", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+	"github.com/jstein/qmp/internal/metrics"
+	"github.com/jstein/qmp/internal/qmp"
+)
+
+// vmidPattern matches the VM IDs accepted by the API. VM IDs end up in socket
+// paths and remote shell commands, so nothing else is let through.
+var vmidPattern = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
+
+// validateVMID checks a VM ID taken from a request
+func validateVMID(vmid string) error {
+	if !vmidPattern.MatchString(vmid) {
+		return fmt.Errorf("invalid vmid %q (use letters, digits, '-' and '_')", vmid)
+	}
+	return nil
+}
+
+// ClientFactory creates an unconnected QMP client for a VM
+type ClientFactory func(vmid string) *qmp.Client
+
+// Server exposes VM control over HTTP
+type Server struct {
+	newClient ClientFactory
+
+	// Delay is the default delay between key presses
+	Delay time.Duration
+	// ScreenWidth and ScreenHeight are used by scripts for mouse positions
+	ScreenWidth  int
+	ScreenHeight int
+
+	// Token, when set, must be sent as "Authorization: Bearer TOKEN" with
+	// every request. It is required to listen on non-loopback addresses.
+	Token string
+	// ScriptsDir is the directory "file" in POST /scripts/run is resolved
+	// in; when empty, only inline scripts are accepted
+	ScriptsDir string
+	// LogFile, when set, is the path template of a log file written for
+	// each script job ({vmid} and {time} are expanded); LogKeep rotated
+	// files are kept
+	LogFile string
+	LogKeep int
+
+	// QEMU only serves one QMP client per socket, so requests for the same
+	// VM are serialised
+	vmLocksMu sync.Mutex
+	vmLocks   map[string]*vmLock
+
+	jobs *jobStore
+}
+
+// New creates a new server using the given client factory
+func New(newClient ClientFactory) *Server {
+	return &Server{
+		newClient:    newClient,
+		Delay:        50 * time.Millisecond,
+		ScreenWidth:  1024,
+		ScreenHeight: 768,
+		vmLocks:      map[string]*vmLock{},
+		jobs:         newJobStore(),
+	}
+}
+
+// Handler returns the HTTP handler for the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /vms/{id}/status", s.handleStatus)
+	mux.HandleFunc("POST /vms/{id}/keys", s.handleKeys)
+	mux.HandleFunc("POST /vms/{id}/text", s.handleText)
+	mux.HandleFunc("GET /vms/{id}/ocr", s.handleOCR)
+	mux.HandleFunc("POST /scripts/run", s.handleRunScript)
+	mux.HandleFunc("GET /jobs", s.handleListJobs)
+	mux.HandleFunc("GET /jobs/{id}", s.handleGetJob)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	var handler http.Handler = mux
+	if s.Token != "" {
+		handler = requireToken(s.Token, handler)
+	}
+	return logRequests(handler)
+}
+
+// ListenAndServe starts serving the API on addr. Without a token only
+// loopback addresses are allowed, since scripts can drive the VM console.
+func (s *Server) ListenAndServe(addr string) error {
+	if s.Token == "" && !isLoopback(addr) {
+		return fmt.Errorf("refusing to listen on %s without a token (set one or listen on 127.0.0.1)", addr)
+	}
+	logging.Info("Starting HTTP API server", "listen", addr, "auth", s.Token != "")
+	return http.ListenAndServe(addr, s.Handler())
+}
+
+// isLoopback reports whether a listen address only accepts local connections
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requireToken rejects requests without the bearer token
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("missing or invalid token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// vmLock guards access to a VM's QMP socket. Script jobs hold it for their
+// whole run; short requests fail with a busyError instead of waiting for them.
+type vmLock struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	inUse bool
+	// job is the ID of the script job holding the VM, if any
+	job string
+}
+
+// busyError is returned when a VM is held by a script job
+type busyError struct {
+	vmid string
+	job  string
+}
+
+// Error implements error
+func (e *busyError) Error() string {
+	return fmt.Sprintf("VM %s is busy running script job %s", e.vmid, e.job)
+}
+
+// vmLockFor returns the lock for a VM, creating it on first use
+func (s *Server) vmLockFor(vmid string) *vmLock {
+	s.vmLocksMu.Lock()
+	defer s.vmLocksMu.Unlock()
+
+	lock, ok := s.vmLocks[vmid]
+	if !ok {
+		lock = &vmLock{}
+		lock.cond = sync.NewCond(&lock.mu)
+		s.vmLocks[vmid] = lock
+	}
+	return lock
+}
+
+// lockVM takes the lock for a VM for a single request. It waits for other
+// requests but returns a busyError while a script job holds the VM.
+func (s *Server) lockVM(vmid string) error {
+	lock := s.vmLockFor(vmid)
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	for lock.inUse {
+		if lock.job != "" {
+			return &busyError{vmid: vmid, job: lock.job}
+		}
+		lock.cond.Wait()
+	}
+	lock.inUse = true
+	return nil
+}
+
+// lockVMForJob takes the lock for a VM for a whole script job. Jobs never
+// fail to get the lock; they queue behind requests and earlier jobs.
+func (s *Server) lockVMForJob(vmid string, job string) {
+	lock := s.vmLockFor(vmid)
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	for lock.inUse {
+		lock.cond.Wait()
+	}
+	lock.inUse, lock.job = true, job
+}
+
+// unlockVM releases the lock taken by lockVM or lockVMForJob
+func (s *Server) unlockVM(vmid string) {
+	lock := s.vmLockFor(vmid)
+
+	lock.mu.Lock()
+	lock.inUse, lock.job = false, ""
+	lock.mu.Unlock()
+	lock.cond.Broadcast()
+}
+
+// errorStatus returns the HTTP status for a failed VM request
+func errorStatus(err error) int {
+	var busy *busyError
+	if errors.As(err, &busy) {
+		return http.StatusConflict
+	}
+	return http.StatusBadGateway
+}
+
+// withClient connects to a VM, runs fn and disconnects
+func (s *Server) withClient(vmid string, fn func(*qmp.Client) error) error {
+	if err := s.lockVM(vmid); err != nil {
+		return err
+	}
+	defer s.unlockVM(vmid)
+
+	client := s.newClient(vmid)
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("error connecting to VM %s: %v", vmid, err)
+	}
+	defer client.Close()
+
+	return fn(client)
+}
+
+// handleStatus returns the QMP status of a VM
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	vmid := r.PathValue("id")
+	if err := validateVMID(vmid); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var status map[string]interface{}
+	err := s.withClient(vmid, func(c *qmp.Client) error {
+		var err error
+		status, err = c.QueryStatus()
+		return err
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vmid":   vmid,
+		"status": status,
+	})
+}
+
+// keysRequest is the body of POST /vms/{id}/keys
+type keysRequest struct {
+	Keys    []string `json:"keys"`
+	DelayMS int      `json:"delay_ms"`
+}
+
+// handleKeys sends a sequence of key presses
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	vmid := r.PathValue("id")
+	if err := validateVMID(vmid); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req keysRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if len(req.Keys) == 0 {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("no keys given"))
+		return
+	}
+
+	delay := s.delay(req.DelayMS)
+	err := s.withClient(vmid, func(c *qmp.Client) error {
+		return c.SendKeys(req.Keys, delay)
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vmid": vmid,
+		"keys": req.Keys,
+	})
+}
+
+// textRequest is the body of POST /vms/{id}/text
+type textRequest struct {
+	Text    string `json:"text"`
+	DelayMS int    `json:"delay_ms"`
+}
+
+// handleText types a string of text
+func (s *Server) handleText(w http.ResponseWriter, r *http.Request) {
+	vmid := r.PathValue("id")
+	if err := validateVMID(vmid); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var req textRequest
+	if err := decodeJSON(r.Body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	delay := s.delay(req.DelayMS)
+	err := s.withClient(vmid, func(c *qmp.Client) error {
+		return c.SendString(req.Text, delay)
+	})
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"vmid":   vmid,
+		"length": len([]rune(req.Text)),
+	})
+}
+
+// handleOCR is a placeholder until the controller gains OCR support
+func (s *Server) handleOCR(w http.ResponseWriter, r *http.Request) {
+	writeError(w, http.StatusNotImplemented, fmt.Errorf("OCR is not supported by this build"))
+}
+
+// delay returns the requested key delay or the server default
+func (s *Server) delay(ms int) time.Duration {
+	if ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return s.Delay
+}
+
+// decodeJSON decodes a request body, rejecting unknown fields
+func decodeJSON(body io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.Warn("Failed to write response", "error", err)
+	}
+}
+
+// writeError writes an error as a JSON response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// logRequests logs every request at debug level
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		logging.Debug("HTTP request", "method", r.Method, "path", r.URL.Path, "duration", time.Since(start))
+	})
+}
@@ -0,0 +1,477 @@
+package vnc
+
+import (
+	"bufio"
+	"crypto/des"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jstein/qmp/internal/logging"
+)
+
+// RFB security types
+const (
+	securityNone    = 1
+	securityVNCAuth = 2
+)
+
+// RFB client-to-server message types
+const (
+	msgSetPixelFormat           = 0
+	msgSetEncodings             = 2
+	msgFramebufferUpdateRequest = 3
+)
+
+// RFB server-to-client message types
+const (
+	msgFramebufferUpdate   = 0
+	msgSetColourMapEntries = 1
+	msgBell                = 2
+	msgServerCutText       = 3
+)
+
+// encodingRaw is the only framebuffer encoding requested from the server
+const encodingRaw = 0
+
+// maxStringLength caps the length of server strings (desktop name, failure
+// reasons, clipboard text) so a bad server cannot force a huge allocation
+const maxStringLength = 64 * 1024
+
+// Default timeouts for reading server replies
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultChangeWait = 250 * time.Millisecond
+)
+
+// Client is a minimal RFB (VNC) client that keeps a local copy of the
+// remote framebuffer and refreshes it with incremental updates
+type Client struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	address  string
+	password string
+
+	width  int
+	height int
+	name   string
+
+	framebuffer *image.RGBA
+	primed      bool
+	// pending is set while an incremental update request is unanswered
+	pending bool
+
+	// Timeout bounds the wait for a full framebuffer and for the rest of a
+	// message once it has started
+	Timeout time.Duration
+	// ChangeWait is how long Capture waits for an incremental update. The
+	// server only answers once the screen changes, so when nothing arrives
+	// in time the current framebuffer is returned unchanged.
+	ChangeWait time.Duration
+}
+
+// New creates a new VNC client for the given address.
+// The address is either "unix:/path/to/socket" or "host:port".
+func New(address string, password string) *Client {
+	return &Client{
+		address:    address,
+		password:   password,
+		Timeout:    defaultTimeout,
+		ChangeWait: defaultChangeWait,
+	}
+}
+
+// DefaultAddress returns the Proxmox VNC socket path for a VM
+func DefaultAddress(vmid string) string {
+	return fmt.Sprintf("unix:/var/run/qemu-server/%s.vnc", vmid)
+}
+
+// Connect establishes the connection and performs the RFB handshake
+func (c *Client) Connect() error {
+	network, addr := "tcp", c.address
+	if strings.HasPrefix(c.address, "unix:") {
+		network, addr = "unix", strings.TrimPrefix(c.address, "unix:")
+	}
+
+	logging.Debug("Connecting to VNC server", "network", network, "address", addr)
+	conn, err := net.DialTimeout(network, addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to VNC server: %v", err)
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+
+	// Bound the handshake as well, e.g. a server that never sends its version
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	if err := c.handshake(); err != nil {
+		c.conn.Close()
+		return err
+	}
+
+	c.conn.SetDeadline(time.Time{})
+
+	logging.Info("Connected to VNC server", "name", c.name, "width", c.width, "height", c.height)
+	return nil
+}
+
+// Close closes the VNC connection
+func (c *Client) Close() error {
+	if c.conn != nil {
+		logging.Debug("Closing VNC connection", "address", c.address)
+		return c.conn.Close()
+	}
+	return nil
+}
+
+// Size returns the framebuffer dimensions
+func (c *Client) Size() (int, int) {
+	return c.width, c.height
+}
+
+// handshake performs protocol version negotiation, security and initialisation
+func (c *Client) handshake() error {
+	// Protocol version
+	version := make([]byte, 12)
+	if _, err := io.ReadFull(c.reader, version); err != nil {
+		return fmt.Errorf("failed to read protocol version: %v", err)
+	}
+	logging.Debug("VNC server version", "version", strings.TrimSpace(string(version)))
+
+	var major, minor int
+	if _, err := fmt.Sscanf(string(version), "RFB %03d.%03d\n", &major, &minor); err != nil {
+		return fmt.Errorf("invalid protocol version %q", string(version))
+	}
+	if major != 3 || minor < 3 {
+		return fmt.Errorf("unsupported protocol version %d.%d", major, minor)
+	}
+	if minor > 8 {
+		minor = 8
+	}
+	if minor != 3 && minor != 7 && minor != 8 {
+		minor = 3
+	}
+	if _, err := fmt.Fprintf(c.conn, "RFB 003.%03d\n", minor); err != nil {
+		return fmt.Errorf("failed to send protocol version: %v", err)
+	}
+
+	// Security
+	securityType, err := c.negotiateSecurity(minor)
+	if err != nil {
+		return err
+	}
+
+	if securityType == securityVNCAuth {
+		if err := c.authenticate(); err != nil {
+			return err
+		}
+	}
+
+	// Security result (always sent in 3.8, and in 3.3/3.7 only after VNC auth)
+	if minor >= 8 || securityType == securityVNCAuth {
+		var result uint32
+		if err := binary.Read(c.reader, binary.BigEndian, &result); err != nil {
+			return fmt.Errorf("failed to read security result: %v", err)
+		}
+		if result != 0 {
+			reason := ""
+			if minor >= 8 {
+				reason, _ = c.readString()
+			}
+			return fmt.Errorf("VNC authentication failed: %s", reason)
+		}
+	}
+
+	// ClientInit: request a shared session so other viewers stay connected
+	if _, err := c.conn.Write([]byte{1}); err != nil {
+		return fmt.Errorf("failed to send client init: %v", err)
+	}
+
+	// ServerInit
+	var serverInit struct {
+		Width       uint16
+		Height      uint16
+		PixelFormat [16]byte
+	}
+	if err := binary.Read(c.reader, binary.BigEndian, &serverInit); err != nil {
+		return fmt.Errorf("failed to read server init: %v", err)
+	}
+	name, err := c.readString()
+	if err != nil {
+		return fmt.Errorf("failed to read desktop name: %v", err)
+	}
+
+	c.width = int(serverInit.Width)
+	c.height = int(serverInit.Height)
+	c.name = name
+	c.framebuffer = image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+
+	// Ask for 32bpp little-endian true colour so decoding is trivial
+	pixelFormat := []byte{
+		msgSetPixelFormat, 0, 0, 0,
+		32, 24, 0, 1, // bpp, depth, big-endian, true-colour
+		0, 255, 0, 255, 0, 255, // red/green/blue max
+		16, 8, 0, // red/green/blue shift
+		0, 0, 0, // padding
+	}
+	if _, err := c.conn.Write(pixelFormat); err != nil {
+		return fmt.Errorf("failed to set pixel format: %v", err)
+	}
+
+	encodings := []byte{msgSetEncodings, 0, 0, 1, 0, 0, 0, encodingRaw}
+	if _, err := c.conn.Write(encodings); err != nil {
+		return fmt.Errorf("failed to set encodings: %v", err)
+	}
+
+	return nil
+}
+
+// negotiateSecurity selects a security type supported by both sides
+func (c *Client) negotiateSecurity(minor int) (uint32, error) {
+	if minor == 3 {
+		// In 3.3 the server decides the security type
+		var securityType uint32
+		if err := binary.Read(c.reader, binary.BigEndian, &securityType); err != nil {
+			return 0, fmt.Errorf("failed to read security type: %v", err)
+		}
+		if securityType == 0 {
+			reason, _ := c.readString()
+			return 0, fmt.Errorf("VNC server refused connection: %s", reason)
+		}
+		if securityType != securityNone && securityType != securityVNCAuth {
+			return 0, fmt.Errorf("unsupported security type %d", securityType)
+		}
+		return securityType, nil
+	}
+
+	count, err := c.reader.ReadByte()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read security types: %v", err)
+	}
+	if count == 0 {
+		reason, _ := c.readString()
+		return 0, fmt.Errorf("VNC server refused connection: %s", reason)
+	}
+
+	types := make([]byte, count)
+	if _, err := io.ReadFull(c.reader, types); err != nil {
+		return 0, fmt.Errorf("failed to read security types: %v", err)
+	}
+
+	var selected byte
+	for _, t := range types {
+		if t == securityNone {
+			selected = t
+			break
+		}
+		if t == securityVNCAuth && c.password != "" {
+			selected = t
+		}
+	}
+	if selected == 0 {
+		return 0, fmt.Errorf("no supported security type offered by server (offered %v)", types)
+	}
+
+	if _, err := c.conn.Write([]byte{selected}); err != nil {
+		return 0, fmt.Errorf("failed to select security type: %v", err)
+	}
+	return uint32(selected), nil
+}
+
+// authenticate answers the VNC authentication DES challenge
+func (c *Client) authenticate() error {
+	challenge := make([]byte, 16)
+	if _, err := io.ReadFull(c.reader, challenge); err != nil {
+		return fmt.Errorf("failed to read auth challenge: %v", err)
+	}
+
+	// VNC uses the password (padded to 8 bytes) with each byte bit-reversed as the DES key
+	key := make([]byte, 8)
+	copy(key, c.password)
+	for i, b := range key {
+		var reversed byte
+		for bit := 0; bit < 8; bit++ {
+			if b&(1<<bit) != 0 {
+				reversed |= 1 << (7 - bit)
+			}
+		}
+		key[i] = reversed
+	}
+
+	cipher, err := des.NewCipher(key)
+	if err != nil {
+		return fmt.Errorf("failed to create auth cipher: %v", err)
+	}
+
+	response := make([]byte, 16)
+	cipher.Encrypt(response[:8], challenge[:8])
+	cipher.Encrypt(response[8:], challenge[8:])
+
+	if _, err := c.conn.Write(response); err != nil {
+		return fmt.Errorf("failed to send auth response: %v", err)
+	}
+	return nil
+}
+
+// readString reads a length-prefixed string
+func (c *Client) readString() (string, error) {
+	var length uint32
+	if err := binary.Read(c.reader, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	if length > maxStringLength {
+		return "", fmt.Errorf("server string of %d bytes exceeds the %d byte limit", length, maxStringLength)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, data); err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// Capture returns the current screen contents. The first call fetches the
+// full framebuffer, later calls only fetch regions that changed since and
+// return the previous contents if the screen stays static for ChangeWait.
+// The returned image is owned by the client and updated in place.
+func (c *Client) Capture() (*image.RGBA, error) {
+	if c.conn == nil {
+		return nil, fmt.Errorf("not connected to VNC server")
+	}
+
+	// An unanswered incremental request from an earlier call is still valid,
+	// and sending another one would leave a reply queued behind it
+	if !c.pending {
+		incremental := byte(0)
+		if c.primed {
+			incremental = 1
+		}
+
+		request := make([]byte, 10)
+		request[0] = msgFramebufferUpdateRequest
+		request[1] = incremental
+		binary.BigEndian.PutUint16(request[6:], uint16(c.width))
+		binary.BigEndian.PutUint16(request[8:], uint16(c.height))
+		if _, err := c.conn.Write(request); err != nil {
+			return nil, fmt.Errorf("failed to request framebuffer update: %v", err)
+		}
+		c.pending = c.primed
+	}
+
+	for {
+		wait := c.Timeout
+		if c.primed {
+			wait = c.ChangeWait
+		}
+		c.conn.SetReadDeadline(time.Now().Add(wait))
+
+		msgType, err := c.reader.ReadByte()
+		if err != nil {
+			var netErr net.Error
+			if c.primed && errors.As(err, &netErr) && netErr.Timeout() {
+				// Nothing changed; the request stays pending for the next call
+				return c.framebuffer, nil
+			}
+			return nil, fmt.Errorf("failed to read server message: %v", err)
+		}
+
+		// A message has started, so the rest of it must follow promptly
+		c.conn.SetReadDeadline(time.Now().Add(c.Timeout))
+
+		switch msgType {
+		case msgFramebufferUpdate:
+			if err := c.readFramebufferUpdate(); err != nil {
+				return nil, err
+			}
+			c.primed, c.pending = true, false
+			return c.framebuffer, nil
+		case msgSetColourMapEntries:
+			if err := c.skipColourMap(); err != nil {
+				return nil, err
+			}
+		case msgBell:
+			// Nothing to do
+		case msgServerCutText:
+			if err := c.skipCutText(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unsupported server message type %d", msgType)
+		}
+	}
+}
+
+// readFramebufferUpdate applies the rectangles of a FramebufferUpdate message
+func (c *Client) readFramebufferUpdate() error {
+	header := make([]byte, 3)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return fmt.Errorf("failed to read update header: %v", err)
+	}
+	rects := int(binary.BigEndian.Uint16(header[1:]))
+
+	for i := 0; i < rects; i++ {
+		var rect struct {
+			X, Y, Width, Height uint16
+			Encoding            int32
+		}
+		if err := binary.Read(c.reader, binary.BigEndian, &rect); err != nil {
+			return fmt.Errorf("failed to read rectangle header: %v", err)
+		}
+		if rect.Encoding != encodingRaw {
+			return fmt.Errorf("unsupported rectangle encoding %d", rect.Encoding)
+		}
+
+		row := make([]byte, int(rect.Width)*4)
+		for y := 0; y < int(rect.Height); y++ {
+			if _, err := io.ReadFull(c.reader, row); err != nil {
+				return fmt.Errorf("failed to read pixel data: %v", err)
+			}
+			py := int(rect.Y) + y
+			if py >= c.height {
+				continue
+			}
+			for x := 0; x < int(rect.Width); x++ {
+				px := int(rect.X) + x
+				if px >= c.width {
+					continue
+				}
+				// Little-endian pixel with red at shift 16, green at 8, blue at 0
+				offset := c.framebuffer.PixOffset(px, py)
+				c.framebuffer.Pix[offset] = row[x*4+2]
+				c.framebuffer.Pix[offset+1] = row[x*4+1]
+				c.framebuffer.Pix[offset+2] = row[x*4]
+				c.framebuffer.Pix[offset+3] = 255
+			}
+		}
+	}
+
+	return nil
+}
+
+// skipColourMap discards a SetColourMapEntries message
+func (c *Client) skipColourMap() error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	colours := int(binary.BigEndian.Uint16(header[3:]))
+	_, err := io.CopyN(io.Discard, c.reader, int64(colours*6))
+	return err
+}
+
+// skipCutText discards a ServerCutText message
+func (c *Client) skipCutText() error {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header[3:])
+	if length > maxStringLength {
+		return fmt.Errorf("server cut text of %d bytes exceeds the %d byte limit", length, maxStringLength)
+	}
+	_, err := io.CopyN(io.Discard, c.reader, int64(length))
+	return err
+}